@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bitnami/healthcheck-tools/pkg/apache"
+)
+
+// Severity of a lint finding
+type Severity string
+
+// Severities of the lint findings
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a possible misconfiguration detected in the Apache configuration
+type Finding struct {
+	ID       string   `json:"id"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+}
+
+// Location returns the source location of the finding as <file>:<line>
+func (f Finding) Location() string {
+	return fmt.Sprintf("%s:%d", f.File, f.Line)
+}
+
+func newFinding(id string, severity Severity, d *apache.Directive, format string, a ...interface{}) Finding {
+	return Finding{ID: id, Severity: severity, Message: fmt.Sprintf(format, a...), File: d.File, Line: d.Line}
+}
+
+// lintContext contains the views of the configuration shared by all the lint checks
+type lintContext struct {
+	config     *apache.Config
+	directives []*apache.Directive
+	modules    map[string]bool
+	vhosts     *apache.VirtualHostMap
+}
+
+// lintCheck is a single lint rule
+type lintCheck func(ctx *lintContext) []Finding
+
+var lintChecks = []lintCheck{
+	lintDuplicateListen,
+	lintVirtualHostWithoutListen,
+	lintSSLWithoutCertificate,
+	lintModuleNotLoaded,
+	lintDuplicateServerName,
+	lintMissingDocumentRoot,
+}
+
+// listenAddress returns the host and port of a Listen directive ([IP:]port [protocol])
+func listenAddress(d *apache.Directive) (string, string) {
+	if _, err := strconv.Atoi(d.Value()); err == nil {
+		return "*", d.Value()
+	}
+	host, port := apache.SplitAddress(d.Value())
+	if host == "0.0.0.0" || host == "::" {
+		host = "*"
+	}
+	return host, port
+}
+
+// lintDuplicateListen detects Listen directives that bind the same address twice, which prevents Apache from starting
+func lintDuplicateListen(ctx *lintContext) []Finding {
+	res := []Finding{}
+	seen := []*apache.Directive{}
+	for _, d := range apache.Find(ctx.directives, "Listen") {
+		host, port := listenAddress(d)
+		for _, previous := range seen {
+			previousHost, previousPort := listenAddress(previous)
+			if port == previousPort && (host == previousHost || host == "*" || previousHost == "*") {
+				res = append(res, newFinding("duplicate-listen", SeverityError, d,
+					"Listen %s overlaps with Listen %s at %s", d.Value(), previous.Value(), previous.Location()))
+				break
+			}
+		}
+		seen = append(seen, d)
+	}
+	return res
+}
+
+// lintVirtualHostWithoutListen detects virtual hosts on ports Apache does not listen on
+func lintVirtualHostWithoutListen(ctx *lintContext) []Finding {
+	res := []Finding{}
+	ports := map[string]bool{}
+	for _, d := range apache.Find(ctx.directives, "Listen") {
+		_, port := listenAddress(d)
+		ports[port] = true
+	}
+	for _, vh := range ctx.vhosts.VirtualHosts {
+		for _, address := range vh.Addresses {
+			if _, port := apache.SplitAddress(address); port != "*" && !ports[port] {
+				res = append(res, Finding{ID: "vhost-without-listen", Severity: SeverityWarning,
+					Message: fmt.Sprintf("VirtualHost %s (%s) is defined on port %s but there is no Listen directive for it", address, vh.ServerName, port),
+					File:    vh.File, Line: vh.Line})
+			}
+		}
+	}
+	return res
+}
+
+// lintSSLWithoutCertificate detects virtual hosts with SSL enabled but no certificate configured
+func lintSSLWithoutCertificate(ctx *lintContext) []Finding {
+	res := []Finding{}
+	mainCertificate := apache.FindLast(ctx.directives, "SSLCertificateFile")
+	for _, vh := range ctx.vhosts.VirtualHosts {
+		if !vh.SSL || mainCertificate != nil || apache.FindLast(vh.Directives, "SSLCertificateFile") != nil {
+			continue
+		}
+		finding := Finding{ID: "ssl-without-certificate", Severity: SeverityError,
+			Message: fmt.Sprintf("SSLEngine is on for VirtualHost %s (%s) but no SSLCertificateFile is set", strings.Join(vh.Addresses, " "), vh.ServerName),
+			File:    vh.File, Line: vh.Line}
+		if engine := apache.FindLast(vh.Directives, "SSLEngine"); engine != nil {
+			finding.File, finding.Line = engine.File, engine.Line
+		}
+		res = append(res, finding)
+	}
+	return res
+}
+
+// lintModuleNotLoaded detects directives provided by modules that are not loaded, which Apache rejects as
+// "Invalid command". Directives inside <IfModule> sections for missing modules are ignored, as Apache does
+func lintModuleNotLoaded(ctx *lintContext) []Finding {
+	res := []Finding{}
+	// Without any LoadModule, Apache was built with static modules that cannot be known from the configuration
+	if len(apache.Find(ctx.directives, "LoadModule")) == 0 {
+		return res
+	}
+	var walk func(directives []*apache.Directive)
+	walk = func(directives []*apache.Directive) {
+		for _, d := range directives {
+			if module := apache.DirectiveModule(d.Name); !apache.ModuleLoaded(module, ctx.modules) {
+				res = append(res, newFinding("module-not-loaded", SeverityError, d,
+					"%s requires %s, which is not loaded", d.Name, module))
+			}
+			walk(d.Children)
+		}
+	}
+	walk(ctx.directives)
+	return res
+}
+
+// lintDuplicateServerName detects virtual hosts answering on the same address with the same name,
+// so only the first one will ever be used
+func lintDuplicateServerName(ctx *lintContext) []Finding {
+	res := []Finding{}
+	for _, mapping := range ctx.vhosts.Addresses {
+		seen := map[string]*apache.VirtualHost{}
+		for _, vh := range mapping.VirtualHosts {
+			if vh.ServerName == "" {
+				continue
+			}
+			if previous, ok := seen[vh.ServerName]; ok {
+				res = append(res, Finding{ID: "duplicate-servername", Severity: SeverityWarning,
+					Message: fmt.Sprintf("ServerName %s on %s is already used by the VirtualHost at %s", vh.ServerName, mapping.Address, previous.Location()),
+					File:    vh.File, Line: vh.Line})
+				continue
+			}
+			seen[vh.ServerName] = vh
+		}
+	}
+	return res
+}
+
+// lintMissingDocumentRoot detects DocumentRoot directives pointing to directories that do not exist
+func lintMissingDocumentRoot(ctx *lintContext) []Finding {
+	res := []Finding{}
+	documentRoots := apache.Find(ctx.directives, "DocumentRoot")
+	for _, section := range apache.Find(ctx.directives, "VirtualHost") {
+		documentRoots = append(documentRoots, apache.Find(section.Children, "DocumentRoot")...)
+	}
+	for _, d := range documentRoots {
+		dir := ctx.config.ResolvePath(d.Value())
+		info, err := os.Stat(dir)
+		if err != nil {
+			res = append(res, newFinding("missing-documentroot", SeverityWarning, d, "DocumentRoot %s does not exist", dir))
+		} else if !info.IsDir() {
+			res = append(res, newFinding("missing-documentroot", SeverityWarning, d, "DocumentRoot %s is not a directory", dir))
+		}
+	}
+	return res
+}
+
+// Lint runs all the lint checks against an Apache configuration
+func Lint(config *apache.Config) []Finding {
+	ctx := &lintContext{
+		config:     config,
+		directives: config.Effective(),
+		modules:    config.LoadedModules(),
+		vhosts:     apache.ResolveVirtualHosts(config),
+	}
+	res := []Finding{}
+	for _, check := range lintChecks {
+		res = append(res, check(ctx)...)
+	}
+	return res
+}
+
+// printFindings prints the lint findings as a table
+func printFindings(out io.Writer, findings []Finding) error {
+	if len(findings) == 0 {
+		fmt.Fprintln(out, "No issues found in the Apache configuration")
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tID\tLOCATION\tMESSAGE")
+	for _, f := range findings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Severity, f.ID, f.Location(), f.Message)
+	}
+	return w.Flush()
+}
+
+// runLint implements the lint command
+func runLint(args []string) error {
+	var options apacheOptions
+	var output string
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	options.register(fs)
+	fs.StringVar(&output, "output", "table", "Output format (table or json)")
+	fs.Parse(args)
+
+	config, err := options.load()
+	if err != nil {
+		return err
+	}
+	findings := Lint(config)
+	switch output {
+	case "table":
+		err = printFindings(os.Stdout, findings)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(findings)
+	default:
+		err = fmt.Errorf("unknown output format %q (use table or json)", output)
+	}
+	if err != nil {
+		return err
+	}
+	errorCount := 0
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			errorCount++
+		}
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("found %d errors in the Apache configuration", errorCount)
+	}
+	return nil
+}
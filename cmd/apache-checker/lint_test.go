@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitnami/healthcheck-tools/pkg/apache"
+)
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "htdocs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(dir, "httpd.conf")
+	err := os.WriteFile(conf, []byte(`
+LoadModule ssl_module modules/mod_ssl.so
+Listen 80
+Listen 0.0.0.0:80
+Listen 443
+DocumentRoot "htdocs"
+RewriteEngine on
+<IfModule rewrite_module>
+    RewriteRule ^ - [L]
+</IfModule>
+<VirtualHost *:80>
+    ServerName example.com
+    DocumentRoot "/does/not/exist"
+</VirtualHost>
+<VirtualHost *:80>
+    ServerName example.com
+</VirtualHost>
+<VirtualHost *:8080>
+    ServerName example.com
+</VirtualHost>
+<VirtualHost *:443>
+    ServerName example.com
+    SSLEngine on
+</VirtualHost>
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := apache.LoadConfig(conf, dir)
+	if err != nil {
+		t.Fatalf("Error loading configuration: %v", err)
+	}
+
+	expected := []Finding{
+		{"duplicate-listen", SeverityError, "", conf, 4},
+		{"vhost-without-listen", SeverityWarning, "", conf, 18},
+		{"ssl-without-certificate", SeverityError, "", conf, 23},
+		{"module-not-loaded", SeverityError, "", conf, 7},
+		{"duplicate-servername", SeverityWarning, "", conf, 15},
+		{"missing-documentroot", SeverityWarning, "", conf, 13},
+	}
+	t.Run("Check lint findings", func(t *testing.T) {
+		findings := Lint(config)
+		if len(findings) != len(expected) {
+			t.Fatalf("Incorrect number of findings detected, expected: %d, got: %d (%+v)", len(expected), len(findings), findings)
+		}
+		for i, f := range findings {
+			if f.ID != expected[i].ID || f.Severity != expected[i].Severity || f.Location() != expected[i].Location() {
+				t.Errorf("Incorrect finding detected, expected: %s %s at %s, got: %s %s at %s (%s)", expected[i].Severity,
+					expected[i].ID, expected[i].Location(), f.Severity, f.ID, f.Location(), f.Message)
+			}
+		}
+	})
+}
+
+func TestLintModSecurity(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "httpd.conf")
+	err := os.WriteFile(conf, []byte(`
+LoadModule ssl_module modules/mod_ssl.so
+Listen 80
+SecRuleEngine On
+SecRule ARGS "@contains attack" "id:1,deny"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := apache.LoadConfig(conf, dir)
+	if err != nil {
+		t.Fatalf("Error loading configuration: %v", err)
+	}
+	t.Run("Check ModSecurity directives without the module", func(t *testing.T) {
+		findings := Lint(config)
+		if len(findings) != 2 {
+			t.Fatalf("Incorrect number of findings detected, expected: 2, got: %d (%+v)", len(findings), findings)
+		}
+		for i, f := range findings {
+			if f.ID != "module-not-loaded" || f.Line != i+4 {
+				t.Errorf("Incorrect finding detected, expected: module-not-loaded at line %d, got: %s at %s (%s)", i+4, f.ID, f.Location(), f.Message)
+			}
+		}
+	})
+}
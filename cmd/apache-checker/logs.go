@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bitnami/healthcheck-tools/pkg/apache"
+)
+
+const (
+	sslRemediation = "https://docs.bitnami.com/general/how-to/troubleshoot-ssl-issues/"
+)
+
+// logSignature is a known failure that can be recognised in the error log
+type logSignature struct {
+	id          string
+	description string
+	re          *regexp.Regexp
+	remediation string
+}
+
+var logSignatures = []logSignature{
+	{"AH02572", "SSL certificate and private key could not be configured (mismatched key)",
+		regexp.MustCompile(`AH02572:`), sslRemediation},
+	{"AH02565", "SSL certificate or key file not found or not matching",
+		regexp.MustCompile(`AH02565:`), sslRemediation},
+	{"AH00558", "ServerName is not set, Apache cannot determine the server's fully qualified domain name",
+		regexp.MustCompile(`AH00558:`), "https://httpd.apache.org/docs/2.4/mod/core.html#servername"},
+	{"segfault", "Apache child process crashed with a segmentation fault",
+		regexp.MustCompile(`exit signal Segmentation fault`), "https://httpd.apache.org/dev/debugging.html#crashes"},
+	{"max-request-workers", "Server reached the MaxRequestWorkers setting, requests were queued",
+		regexp.MustCompile(`server reached Max(RequestWorkers|Clients) setting`), "https://httpd.apache.org/docs/2.4/mod/mpm_common.html#maxrequestworkers"},
+}
+
+// SignatureMatch groups the log entries matching a known failure signature
+type SignatureMatch struct {
+	ID          string    `json:"id"`
+	Description string    `json:"description"`
+	Remediation string    `json:"remediation"`
+	Count       int       `json:"count"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Example     string    `json:"example"`
+}
+
+// logAnalyzer accumulates the matches of the known signatures across several log files
+type logAnalyzer struct {
+	since   time.Time
+	matches map[string]*SignatureMatch
+}
+
+func newLogAnalyzer(since time.Time) *logAnalyzer {
+	return &logAnalyzer{since: since, matches: map[string]*SignatureMatch{}}
+}
+
+// scan looks for the known signatures in the entries of an error log newer than the analyzer start time
+func (a *logAnalyzer) scan(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry, ok := apache.ParseErrorLogLine(scanner.Text())
+		if !ok || entry.Time.Before(a.since) {
+			continue
+		}
+		for _, s := range logSignatures {
+			if !s.re.MatchString(entry.Message) {
+				continue
+			}
+			m, ok := a.matches[s.id]
+			if !ok {
+				m = &SignatureMatch{ID: s.id, Description: s.description, Remediation: s.remediation,
+					FirstSeen: entry.Time, Example: entry.Message}
+				a.matches[s.id] = m
+			}
+			m.Count++
+			if entry.Time.Before(m.FirstSeen) {
+				m.FirstSeen = entry.Time
+			}
+			if entry.Time.After(m.LastSeen) {
+				m.LastSeen = entry.Time
+				m.Example = entry.Message
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// scanFile scans a log file and all its rotated copies
+func (a *logAnalyzer) scanFile(logPath string) error {
+	files, err := apache.RotatedLogFiles(logPath)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fmt.Fprintf(os.Stderr, "Scanning %q\n", file)
+		r, err := apache.OpenLogFile(file)
+		if err != nil {
+			return err
+		}
+		err = a.scan(r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// results returns the matched signatures in the order they are defined
+func (a *logAnalyzer) results() []*SignatureMatch {
+	res := []*SignatureMatch{}
+	for _, s := range logSignatures {
+		if m, ok := a.matches[s.id]; ok {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// printSignatureMatches prints the matched signatures as a table
+func printSignatureMatches(out io.Writer, matches []*SignatureMatch) error {
+	if len(matches) == 0 {
+		fmt.Fprintln(out, "No known failure signatures found in the error logs")
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCOUNT\tFIRST SEEN\tLAST SEEN\tDESCRIPTION\tREMEDIATION")
+	for _, m := range matches {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", m.ID, m.Count, m.FirstSeen.Format(time.RFC3339),
+			m.LastSeen.Format(time.RFC3339), m.Description, m.Remediation)
+	}
+	return w.Flush()
+}
+
+// runLogs implements the logs command
+func runLogs(args []string) error {
+	var options apacheOptions
+	var output, logs string
+	var since time.Duration
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	options.register(fs)
+	fs.StringVar(&output, "output", "table", "Output format (table or json)")
+	fs.StringVar(&logs, "error-log", "", "Comma-separated list of error logs to scan instead of the ones in the Apache configuration")
+	fs.DurationVar(&since, "since", 7*24*time.Hour, "Only scan the entries logged within this period")
+	fs.Parse(args)
+
+	var logPaths []string
+	if logs != "" {
+		logPaths = strings.Split(logs, ",")
+	} else {
+		config, err := options.load()
+		if err != nil {
+			return err
+		}
+		logPaths = apache.ErrorLogs(config)
+	}
+	if len(logPaths) == 0 {
+		return fmt.Errorf("no error log files found in the Apache configuration, use -error-log to indicate them")
+	}
+
+	analyzer := newLogAnalyzer(time.Now().Add(-since))
+	for _, p := range logPaths {
+		if err := analyzer.scanFile(p); err != nil {
+			return err
+		}
+	}
+	matches := analyzer.results()
+	var err error
+	switch output {
+	case "table":
+		err = printSignatureMatches(os.Stdout, matches)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(matches)
+	default:
+		err = fmt.Errorf("unknown output format %q (use table or json)", output)
+	}
+	if err != nil {
+		return err
+	}
+	if len(matches) > 0 {
+		return fmt.Errorf("found %d known failure signatures in the error logs", len(matches))
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogAnalyzer(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "error_log")
+	err := os.WriteFile(logPath, []byte(`[Wed Mar 15 09:00:00.000000 2023] [mpm_event:error] [pid 1] AH00484: server reached MaxRequestWorkers setting, consider raising the MaxRequestWorkers setting
+[Wed Mar 15 10:00:00.000000 2023] [ssl:emerg] [pid 1] AH02572: Failed to configure at least one certificate and key for localhost:443
+[Wed Mar 15 11:00:00.000000 2023] [core:notice] [pid 1] AH00052: child pid 25 exit signal Segmentation fault (11)
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, "error_log.1.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte(`[Mon Mar 13 08:00:00.000000 2023] [ssl:emerg] [pid 1] AH02572: Failed to configure at least one certificate and key for localhost:443
+[Sat Mar 11 08:00:00.000000 2023] [ssl:emerg] [pid 1] AH02572: Failed to configure at least one certificate and key for old:443
+AH00558: httpd: Could not reliably determine the server's fully qualified domain name
+`))
+	gz.Close()
+	f.Close()
+
+	t.Run("Check matched signatures", func(t *testing.T) {
+		analyzer := newLogAnalyzer(time.Date(2023, 3, 12, 0, 0, 0, 0, time.Local))
+		if err := analyzer.scanFile(logPath); err != nil {
+			t.Fatalf("Error scanning error log: %v", err)
+		}
+		matches := analyzer.results()
+		if len(matches) != 3 {
+			t.Fatalf("Incorrect number of signatures detected, expected: 3, got: %d (%+v)", len(matches), matches)
+		}
+		ssl := matches[0]
+		if ssl.ID != "AH02572" || ssl.Count != 2 || ssl.Remediation != sslRemediation {
+			t.Errorf("Incorrect SSL signature detected, expected: AH02572 twice, got: %s %d times", ssl.ID, ssl.Count)
+		}
+		if !ssl.FirstSeen.Equal(time.Date(2023, 3, 13, 8, 0, 0, 0, time.Local)) || !ssl.LastSeen.Equal(time.Date(2023, 3, 15, 10, 0, 0, 0, time.Local)) {
+			t.Errorf("Incorrect first/last seen detected, got: %s/%s", ssl.FirstSeen, ssl.LastSeen)
+		}
+		if matches[1].ID != "segfault" || matches[1].Count != 1 {
+			t.Errorf("Incorrect segfault signature detected, got: %s %d times", matches[1].ID, matches[1].Count)
+		}
+		if matches[2].ID != "max-request-workers" || matches[2].Count != 1 {
+			t.Errorf("Incorrect MaxRequestWorkers signature detected, got: %s %d times", matches[2].ID, matches[2].Count)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/bitnami/healthcheck-tools/pkg/apache"
+)
+
+// These variables will be overwritten automatically by the build system
+var VERSION = "devel"
+var BUILD_DATE = ""
+var COMMIT = ""
+
+// command is an apache-checker subcommand
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"vhosts", "Show the virtual hosts Apache serves on each address:port (like 'apachectl -S')", runVirtualHosts},
+	{"lint", "Detect common misconfigurations in the Apache configuration", runLint},
+	{"status", "Check the runtime status reported by mod_status", runStatus},
+	{"logs", "Look for known failure signatures in the error logs", runLogs},
+}
+
+// apacheOptions contains the flags shared by all the subcommands to locate the Apache configuration
+type apacheOptions struct {
+	root string
+	conf string
+}
+
+func (o *apacheOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.root, "apache-root", "/opt/bitnami/apache2/", "Root of Apache installation")
+	fs.StringVar(&o.conf, "apache-conf", "/opt/bitnami/apache2/conf/httpd.conf",
+		"Path to the root Apache configuration file")
+}
+
+func (o *apacheOptions) load() (*apache.Config, error) {
+	return apache.LoadConfig(o.conf, o.root)
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-version] <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-10s %s\n", c.name, c.description)
+	}
+	fmt.Fprintf(flag.CommandLine.Output(), "\nRun '%s <command> -h' to show the flags of each command\n", os.Args[0])
+}
+
+func main() {
+	var getVersion bool
+	flag.BoolVar(&getVersion, "version", false, "Show current version")
+	flag.Usage = usage
+	flag.Parse()
+	if getVersion {
+		fmt.Printf("apache-checker %s\n", VERSION)
+		fmt.Printf("Built on: %s\n", BUILD_DATE)
+		fmt.Printf("Commit: %s\n", COMMIT)
+		os.Exit(0)
+	}
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == flag.Arg(0) {
+			if err := c.run(flag.Args()[1:]); err != nil {
+				log.Fatalf("%s: %v", c.name, err)
+			}
+			return
+		}
+	}
+	usage()
+	log.Fatalf("unknown command %q", flag.Arg(0))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/bitnami/healthcheck-tools/pkg/apache"
+)
+
+// checkServerStatus cross-references the runtime status with the MPM settings (if known) and returns
+// the problems found
+func checkServerStatus(status *apache.ServerStatus, mpm *apache.MPMSettings, threshold float64) []string {
+	res := []string{}
+	maxWorkers := status.Slots()
+	limitName := "scoreboard slots"
+	if mpm != nil {
+		maxWorkers = mpm.MaxRequestWorkers
+		limitName = "MaxRequestWorkers"
+		if status.ServerMPM != "" && status.ServerMPM != mpm.Module {
+			res = append(res, fmt.Sprintf("running MPM %q does not match the configured MPM %q, restart Apache to apply the configuration", status.ServerMPM, mpm.Module))
+		}
+	}
+	if maxWorkers > 0 {
+		usage := float64(status.BusyWorkers) / float64(maxWorkers)
+		if usage >= threshold {
+			res = append(res, fmt.Sprintf("%d of %d workers are busy (%.0f%%), %s is close to be exhausted: new requests will be queued. Increase MaxRequestWorkers (and ServerLimit) if the server has resources for it",
+				status.BusyWorkers, maxWorkers, usage*100, limitName))
+		}
+	}
+	return res
+}
+
+// printServerStatus prints the runtime status
+func printServerStatus(out io.Writer, status *apache.ServerStatus, mpm *apache.MPMSettings) {
+	fmt.Fprintf(out, `Server version: %s
+Server MPM: %s
+Uptime: %s
+Total accesses: %d
+Busy workers: %d
+Idle workers: %d
+Scoreboard slots: %d
+`, status.ServerVersion, status.ServerMPM, status.Uptime, status.TotalAccesses, status.BusyWorkers, status.IdleWorkers, status.Slots())
+	states := []string{}
+	for state := range status.States {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	for _, state := range states {
+		fmt.Fprintf(out, "  - %s: %d\n", state, status.States[state])
+	}
+	if mpm != nil {
+		fmt.Fprintf(out, "Configured %s\n", mpm)
+	}
+}
+
+// loadMPMSettings reads the MPM settings from the Apache configuration
+func loadMPMSettings(options apacheOptions) (apache.MPMSettings, error) {
+	config, err := options.load()
+	if err != nil {
+		return apache.MPMSettings{}, err
+	}
+	return apache.ReadMPMSettings(config)
+}
+
+// runStatus implements the status command
+func runStatus(args []string) error {
+	var options apacheOptions
+	var url string
+	var threshold float64
+	var timeout time.Duration
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	options.register(fs)
+	fs.StringVar(&url, "url", "http://localhost/server-status?auto", "URL of the mod_status page")
+	fs.Float64Var(&threshold, "threshold", 0.9, "Fraction of busy workers over MaxRequestWorkers to warn about")
+	fs.DurationVar(&timeout, "timeout", 10*time.Second, "Timeout for the request to the status page")
+	fs.Parse(args)
+
+	var mpm *apache.MPMSettings
+	if settings, err := loadMPMSettings(options); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read the MPM settings, MaxRequestWorkers will not be checked: %v\n", err)
+	} else {
+		mpm = &settings
+	}
+
+	status, err := apache.FetchServerStatus(url, timeout)
+	if err != nil {
+		return err
+	}
+	printServerStatus(os.Stdout, status, mpm)
+	problems := checkServerStatus(status, mpm, threshold)
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems in the Apache runtime status", len(problems))
+	}
+	fmt.Println("Apache runtime status is healthy!")
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bitnami/healthcheck-tools/pkg/apache"
+)
+
+func TestCheckServerStatus(t *testing.T) {
+	status := &apache.ServerStatus{ServerMPM: "event", BusyWorkers: 95, IdleWorkers: 5, Scoreboard: "WWWW____"}
+	testData := []struct {
+		name     string
+		mpm      *apache.MPMSettings
+		problems int
+	}{
+		{"Check workers within limits", &apache.MPMSettings{Module: "event", MaxRequestWorkers: 400}, 0},
+		{"Check MaxRequestWorkers close to exhausted", &apache.MPMSettings{Module: "event", MaxRequestWorkers: 100}, 1},
+		{"Check MPM mismatch", &apache.MPMSettings{Module: "prefork", MaxRequestWorkers: 400}, 1},
+		{"Check scoreboard without MPM settings", nil, 1},
+	}
+	for _, tt := range testData {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := checkServerStatus(status, tt.mpm, 0.9)
+			if len(problems) != tt.problems {
+				t.Errorf("Incorrect number of problems detected, expected: %d, got: %d (%q)", tt.problems, len(problems), problems)
+			}
+		})
+	}
+}
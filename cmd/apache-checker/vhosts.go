@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bitnami/healthcheck-tools/pkg/apache"
+)
+
+// printVirtualHostMap prints the virtual host map as a table
+func printVirtualHostMap(out io.Writer, vhosts *apache.VirtualHostMap) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDRESS\tDEFAULT\tSERVER NAME\tALIASES\tSSL\tDOCUMENT ROOT\tDEFINED IN")
+	for _, mapping := range vhosts.Addresses {
+		for _, vh := range mapping.VirtualHosts {
+			isDefault := ""
+			if vh == mapping.Default {
+				isDefault = "*"
+			}
+			ssl := "no"
+			if vh.SSL {
+				ssl = "yes"
+			}
+			aliases := strings.Join(vh.ServerAliases, ",")
+			if aliases == "" {
+				aliases = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", mapping.Address, isDefault, vh.ServerName, aliases, ssl,
+				vh.DocumentRoot, vh.Location())
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, `
+ServerRoot: %q
+Main ServerName: %q
+Main DocumentRoot: %q
+Listen: %s
+`, vhosts.ServerRoot, vhosts.MainServer.ServerName, vhosts.MainServer.DocumentRoot, strings.Join(vhosts.Listen, ", "))
+	return nil
+}
+
+// runVirtualHosts implements the vhosts command
+func runVirtualHosts(args []string) error {
+	var options apacheOptions
+	var output string
+	fs := flag.NewFlagSet("vhosts", flag.ExitOnError)
+	options.register(fs)
+	fs.StringVar(&output, "output", "table", "Output format (table or json)")
+	fs.Parse(args)
+
+	config, err := options.load()
+	if err != nil {
+		return err
+	}
+	vhosts := apache.ResolveVirtualHosts(config)
+	switch output {
+	case "table":
+		return printVirtualHostMap(os.Stdout, vhosts)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(vhosts)
+	default:
+		return fmt.Errorf("unknown output format %q (use table or json)", output)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bitnami/healthcheck-tools/pkg/apache"
+)
+
+func TestPrintVirtualHostMap(t *testing.T) {
+	t.Run("Check virtual host table", func(t *testing.T) {
+		directives, err := apache.ParseConfig(`
+ServerName localhost
+DocumentRoot "/opt/bitnami/apache/htdocs"
+Listen 80
+<VirtualHost *:80>
+    ServerName example.com
+    ServerAlias www.example.com
+</VirtualHost>
+<VirtualHost *:80>
+    ServerName other.com
+</VirtualHost>
+`, "httpd.conf")
+		if err != nil {
+			t.Fatalf("Error parsing configuration: %v", err)
+		}
+		config := &apache.Config{ServerRoot: "/opt/bitnami/apache", Directives: directives}
+		var out bytes.Buffer
+		if err := printVirtualHostMap(&out, apache.ResolveVirtualHosts(config)); err != nil {
+			t.Fatalf("Error printing virtual hosts: %v", err)
+		}
+		lines := strings.Split(out.String(), "\n")
+		expected := []string{
+			"ADDRESS  DEFAULT  SERVER NAME  ALIASES          SSL  DOCUMENT ROOT               DEFINED IN",
+			"*:80     *        example.com  www.example.com  no   /opt/bitnami/apache/htdocs  httpd.conf:5",
+			"*:80              other.com    -                no   /opt/bitnami/apache/htdocs  httpd.conf:9",
+		}
+		for i, line := range expected {
+			if lines[i] != line {
+				t.Errorf("Incorrect table line detected, expected: %q, got: %q", line, lines[i])
+			}
+		}
+		if !strings.Contains(out.String(), `Main DocumentRoot: "/opt/bitnami/apache/htdocs"`) {
+			t.Errorf("Main DocumentRoot not found in output: %s", out.String())
+		}
+	})
+}
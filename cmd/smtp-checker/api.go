@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/juju/errors"
+)
+
+// apiResponseLimit is the size of the API response shown in the errors
+const apiResponseLimit = 512
+
+// RunAPIChecks checks the provider accepts the credentials of an application that sends the mails
+// with its API instead of SMTP
+func RunAPIChecks(ctx context.Context, request *apps.APIRequest) error {
+	req, err := http.NewRequestWithContext(ctx, request.Method, request.URL, strings.NewReader(request.Body))
+	if err != nil {
+		return errors.Errorf("invalid %s API request: %v", request.Provider, err)
+	}
+	req.Header = request.Header.Clone()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs}}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Errorf("unable to connect to the %s API: %v", request.Provider, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, apiResponseLimit))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		fmt.Printf("%s API accepted the credentials (%s)\n", request.Provider, resp.Status)
+		return nil
+	case resp.StatusCode == http.StatusBadRequest, resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return errors.Errorf("%s API rejected the credentials (%s): %s", request.Provider, resp.Status, strings.TrimSpace(string(body)))
+	case resp.StatusCode == http.StatusNotFound:
+		return errors.Errorf("%s API did not find the resource (%s), check the domain or account settings: %s", request.Provider, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return errors.Errorf("unexpected %s API response (%s): %s", request.Provider, resp.Status, strings.TrimSpace(string(body)))
+}
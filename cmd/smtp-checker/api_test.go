@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+)
+
+func TestRunAPIChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "api" || pass != "key-valid" {
+			http.Error(w, "Forbidden", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v3/domains/mg.example.com" {
+			http.Error(w, `{"message": "Domain not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"domain": {"state": "active"}}`))
+	}))
+	defer server.Close()
+	tests := []struct {
+		name   string
+		key    string
+		domain string
+		err    string
+	}{
+		{"valid credentials", "key-valid", "mg.example.com", ""},
+		{"invalid credentials", "key-invalid", "mg.example.com", "rejected the credentials (401 Unauthorized): Forbidden"},
+		{"unknown domain", "key-valid", "example.com", "did not find the resource (404 Not Found)"},
+	}
+	for _, test := range tests {
+		t.Run("Check API with "+test.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			request.SetBasicAuth("api", test.key)
+			err := RunAPIChecks(context.Background(), &apps.APIRequest{
+				Provider: "Mailgun",
+				Method:   http.MethodGet,
+				URL:      server.URL + "/v3/domains/" + test.domain,
+				Header:   request.Header,
+			})
+			if test.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -3,34 +3,112 @@ package apps
 import (
 	"flag"
 	"fmt"
+	"net/http"
+	"net/mail"
 	"os"
+	"strings"
 
 	"github.com/ghodss/yaml"
 )
 
-// Application is a structure that contains the info
-// about each supported application and its configuration file.
-type Application struct {
-	Name       string
-	ConfigFile string
+// ConnectionSecurity is the way the connection with the SMTP server is secured
+type ConnectionSecurity string
+
+// Supported connection security modes. When it is not set, STARTTLS is used if the server offers it
+const (
+	SecurityNone        ConnectionSecurity = "none"
+	SecuritySTARTTLS    ConnectionSecurity = "starttls"
+	SecurityImplicitTLS ConnectionSecurity = "implicit-tls"
+)
+
+// String implements flag.Value
+func (s *ConnectionSecurity) String() string {
+	return string(*s)
+}
+
+// Set implements flag.Value
+func (s *ConnectionSecurity) Set(value string) error {
+	switch ConnectionSecurity(value) {
+	case "", SecurityNone, SecuritySTARTTLS, SecurityImplicitTLS:
+		*s = ConnectionSecurity(value)
+		return nil
+	}
+	return fmt.Errorf("invalid connection security %q (use %s, %s or %s)", value, SecurityNone, SecuritySTARTTLS, SecurityImplicitTLS)
+}
+
+// SecurityForPort returns the connection security expected on the standard SMTP ports, or an
+// empty string when the port does not imply any
+func SecurityForPort(port int) ConnectionSecurity {
+	switch port {
+	case 465:
+		return SecurityImplicitTLS
+	case 587:
+		return SecuritySTARTTLS
+	}
+	return ""
+}
+
+// AuthMechanism is the SASL mechanism used to authenticate with the SMTP server
+type AuthMechanism string
+
+// Supported authentication mechanisms. When it is not set, it is negotiated with the server.
+// With XOAUTH2, the password is the OAuth 2.0 access token
+const (
+	AuthNone    AuthMechanism = "NONE"
+	AuthPlain   AuthMechanism = "PLAIN"
+	AuthLogin   AuthMechanism = "LOGIN"
+	AuthCRAMMD5 AuthMechanism = "CRAM-MD5"
+	AuthXOAUTH2 AuthMechanism = "XOAUTH2"
+)
+
+// String implements flag.Value
+func (m *AuthMechanism) String() string {
+	return string(*m)
+}
+
+// Set implements flag.Value
+func (m *AuthMechanism) Set(value string) error {
+	switch mechanism := AuthMechanism(strings.ToUpper(value)); mechanism {
+	case "", AuthNone, AuthPlain, AuthLogin, AuthCRAMMD5, AuthXOAUTH2:
+		*m = mechanism
+		return nil
+	}
+	return fmt.Errorf("invalid authentication mechanism %q (use %s, %s, %s, %s or %s)", value, AuthNone, AuthPlain, AuthLogin, AuthCRAMMD5, AuthXOAUTH2)
 }
 
 // SMTPSettings is a structure that contains the SMTP
 // credentials to use on the SMTP checks
 type SMTPSettings struct {
-	Host string `default:"localhost"`
-	Port int    `default:"25"`
-	User string
-	Pass string
+	Host     string `default:"localhost"`
+	Port     int    `default:"25"`
+	User     string
+	Pass     string
+	Security ConnectionSecurity
+	Auth     AuthMechanism
+	// From is the address used as sender, e.g. "WordPress <wordpress@example.com>"
+	From string
+}
+
+// FromAddress returns the sender address. When no sender is configured, the SMTP user is used as is
+func (s *SMTPSettings) FromAddress() (*mail.Address, error) {
+	if s.From == "" {
+		return &mail.Address{Address: s.User}, nil
+	}
+	return mail.ParseAddress(s.From)
 }
 
 // NewSMTPSettingsFromFlags creates a SMTPSettings from the provided command line flags
 func NewSMTPSettingsFromFlags(fs *flag.FlagSet) *SMTPSettings {
 	smtp := SMTPSettings{}
-	flag.StringVar(&smtp.Host, "smtp_host", "localhost", "SMTP Host")
-	flag.IntVar(&smtp.Port, "smtp_port", 25, "SMTP Port")
-	flag.StringVar(&smtp.User, "smtp_user", "", "SMTP User")
-	flag.StringVar(&smtp.Pass, "smtp_password", "", "SMTP Password")
+	fs.StringVar(&smtp.Host, "smtp_host", "localhost", "SMTP Host")
+	fs.IntVar(&smtp.Port, "smtp_port", 25, "SMTP Port")
+	fs.StringVar(&smtp.User, "smtp_user", "", "SMTP User")
+	fs.StringVar(&smtp.Pass, "smtp_password", "", "SMTP Password")
+	fs.Var(&smtp.Security, "smtp_security", fmt.Sprintf("SMTP connection security: %s, %s or %s (by default, based on the port)",
+		SecurityNone, SecuritySTARTTLS, SecurityImplicitTLS))
+	fs.Var(&smtp.Auth, "smtp_auth", fmt.Sprintf("SMTP authentication mechanism: %s, %s, %s, %s or %s (by default, negotiated with the server)",
+		AuthNone, AuthPlain, AuthLogin, AuthCRAMMD5, AuthXOAUTH2))
+	fs.StringVar(&smtp.From, "mail_from", "", "Mail sender (by default, the application one or the SMTP user)")
 	return &smtp
 }
 
@@ -40,6 +118,60 @@ type ApplicationConfig interface {
 	ValidateSMTPSettings() error
 }
 
+// Mailer is the way an application sends the mails
+type Mailer string
+
+// Supported mailers. The local ones hand the mails to the local MTA instead of a SMTP server
+const (
+	MailerSMTP     Mailer = "smtp"
+	MailerPHPMail  Mailer = "mail"
+	MailerSendmail Mailer = "sendmail"
+)
+
+// Local reports whether the mails are handed to the local MTA
+func (m Mailer) Local() bool {
+	return m == MailerPHPMail || m == MailerSendmail
+}
+
+// MailerConfig is implemented by the application configs that can send mails without SMTP
+type MailerConfig interface {
+	Mailer() Mailer
+}
+
+// APIRequest is a request to the HTTP API of a mail provider that checks the credentials of an
+// application which sends the mails with the API instead of SMTP
+type APIRequest struct {
+	Provider string
+	Method   string
+	URL      string
+	Header   http.Header
+	Body     string
+}
+
+// APIConfig is implemented by the application configs that can send mails with the API of a provider
+type APIConfig interface {
+	// APIRequest returns nil when the mails are not sent with an API
+	APIRequest() *APIRequest
+}
+
+// SiteConfig is a configuration shared by some of the sites of an installation
+type SiteConfig struct {
+	Sites  []string
+	Config ApplicationConfig
+}
+
+// MultiSiteConfig is implemented by the application configs of installations with several sites,
+// e.g. a WordPress multisite network. The checks run once for each distinct configuration
+type MultiSiteConfig interface {
+	SiteConfigs() []SiteConfig
+}
+
+// SendmailConfig is implemented by the application configs that run their own sendmail command
+// instead of the sendmail_path of PHP
+type SendmailConfig interface {
+	SendmailCommand() string
+}
+
 // UnmarshalYAMLFile reads a config file and unmarshals it into a config struct
 func UnmarshalYAMLFile(configFile string, config interface{}) error {
 	source, err := os.ReadFile(configFile)
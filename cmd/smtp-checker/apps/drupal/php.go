@@ -0,0 +1,327 @@
+package drupal
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps/php"
+	"github.com/juju/errors"
+	"github.com/yvasiyarov/php_session_decoder/php_serialize"
+)
+
+// phpExpression is a value of settings.php that is not a literal, e.g. getenv('DB_HOST')
+type phpExpression string
+
+// assignment is an assignment to a variable of settings.php, e.g. $databases['default']['default'] = [...]
+type assignment struct {
+	path  []php_serialize.PhpValue
+	value php_serialize.PhpValue
+}
+
+// phpParser reads the assignments of literal values of a PHP file: strings, numbers, booleans,
+// null and arrays
+type phpParser struct {
+	src string
+	pos int
+}
+
+func (p *phpParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+// skipComment skips a comment at the current position, reporting whether there was one
+func (p *phpParser) skipComment() bool {
+	rest := p.src[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, "/*"):
+		end := strings.Index(rest[2:], "*/")
+		if end < 0 {
+			p.pos = len(p.src)
+		} else {
+			p.pos += end + 4
+		}
+	case strings.HasPrefix(rest, "//"), strings.HasPrefix(rest, "#"):
+		end := strings.IndexByte(rest, '\n')
+		if end < 0 {
+			p.pos = len(p.src)
+		} else {
+			p.pos += end + 1
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// skipSpace skips the whitespace and comments
+func (p *phpParser) skipSpace() {
+	for !p.eof() {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\r', '\n':
+			p.pos++
+		default:
+			if !p.skipComment() {
+				return
+			}
+		}
+	}
+}
+
+// consume skips a token if it is at the current position
+func (p *phpParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+// word reads an identifier at the current position
+func (p *phpParser) word() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.src[p.pos]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// quoted reads a single or double quoted string. The variables of the double quoted strings are
+// not interpolated
+func (p *phpParser) quoted() (string, error) {
+	quote := p.src[p.pos]
+	var res strings.Builder
+	for p.pos++; !p.eof(); p.pos++ {
+		c := p.src[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return res.String(), nil
+		case c == '\\' && p.pos+1 < len(p.src):
+			next := p.src[p.pos+1]
+			switch {
+			case next == quote, next == '\\':
+				res.WriteByte(next)
+			case quote == '"' && next == 'n':
+				res.WriteByte('\n')
+			case quote == '"' && next == 't':
+				res.WriteByte('\t')
+			case quote == '"' && next == '$':
+				res.WriteByte('$')
+			default:
+				res.WriteByte(c)
+				res.WriteByte(next)
+			}
+			p.pos++
+		default:
+			res.WriteByte(c)
+		}
+	}
+	return "", errors.New("unterminated string")
+}
+
+// expression skips an expression that is not a literal, up to the end of the array element or
+// the statement
+func (p *phpParser) expression() phpExpression {
+	start, depth := p.pos, 0
+	for !p.eof() {
+		switch c := p.src[p.pos]; c {
+		case '\'', '"':
+			if _, err := p.quoted(); err != nil {
+				return phpExpression(p.src[start:])
+			}
+			continue
+		case '(', '[':
+			depth++
+		case ')', ']':
+			if depth == 0 {
+				return phpExpression(strings.TrimSpace(p.src[start:p.pos]))
+			}
+			depth--
+		case ',', ';':
+			if depth == 0 {
+				return phpExpression(strings.TrimSpace(p.src[start:p.pos]))
+			}
+		}
+		p.pos++
+	}
+	return phpExpression(strings.TrimSpace(p.src[start:]))
+}
+
+// array reads the elements of an array up to its closing character
+func (p *phpParser) array(closing string) (php_serialize.PhpArray, error) {
+	res := php_serialize.PhpArray{}
+	next := 0
+	for {
+		if p.consume(closing) {
+			return res, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		var key php_serialize.PhpValue = next
+		if p.consume("=>") {
+			key = php.ArrayKey(value)
+			if value, err = p.value(); err != nil {
+				return nil, err
+			}
+		}
+		res[key] = value
+		if n, ok := key.(int); ok && n >= next {
+			next = n + 1
+		}
+		if p.consume(",") {
+			continue
+		}
+		if p.consume(closing) {
+			return res, nil
+		}
+		return nil, errors.Errorf("expected %q at offset %d", closing, p.pos)
+	}
+}
+
+// value reads a literal value, or skips an expression
+func (p *phpParser) value() (php_serialize.PhpValue, error) {
+	p.skipSpace()
+	if p.eof() {
+		return nil, errors.New("unexpected end of file")
+	}
+	switch c := p.src[p.pos]; {
+	case c == '\'' || c == '"':
+		return p.quoted()
+	case c == '[':
+		p.pos++
+		return p.array("]")
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		start := p.pos
+		for !p.eof() && strings.IndexByte("0123456789+-.eE", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		number := p.src[start:p.pos]
+		if n, err := strconv.Atoi(number); err == nil {
+			return n, nil
+		}
+		if f, err := strconv.ParseFloat(number, 64); err == nil {
+			return f, nil
+		}
+		p.pos = start
+		return p.expression(), nil
+	}
+	start := p.pos
+	switch word := strings.ToLower(p.word()); word {
+	case "true", "false":
+		return word == "true", nil
+	case "null":
+		return nil, nil
+	case "array":
+		if p.consume("(") {
+			return p.array(")")
+		}
+	}
+	p.pos = start
+	return p.expression(), nil
+}
+
+// assignments returns the assignments to a variable, in the order they are run
+func assignments(source string, variable string) ([]assignment, error) {
+	var res []assignment
+	p := &phpParser{src: source}
+	for !p.eof() {
+		switch c := p.src[p.pos]; {
+		case c == '\'' || c == '"':
+			if _, err := p.quoted(); err != nil {
+				return nil, err
+			}
+			continue
+		case c == '$':
+			p.pos++
+			if p.word() != variable {
+				continue
+			}
+			var a assignment
+			for p.consume("[") {
+				key, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				if !p.consume("]") {
+					return nil, errors.Errorf("$%s: expected \"]\" at offset %d", variable, p.pos)
+				}
+				a.path = append(a.path, php.ArrayKey(key))
+			}
+			// Only the plain assignments are read, not the comparisons
+			if !p.consume("=") || strings.HasPrefix(p.src[p.pos:], "=") || strings.HasPrefix(p.src[p.pos:], ">") {
+				continue
+			}
+			value, err := p.value()
+			if err != nil {
+				return nil, errors.Errorf("$%s: %v", variable, err)
+			}
+			a.value = value
+			res = append(res, a)
+			continue
+		default:
+			if p.skipComment() {
+				continue
+			}
+		}
+		p.pos++
+	}
+	return res, nil
+}
+
+// assign sets a value at a path of keys of an array, creating the intermediate arrays
+func assign(array php_serialize.PhpArray, path []php_serialize.PhpValue, value php_serialize.PhpValue) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := array[key].(php_serialize.PhpArray)
+		if !ok {
+			next = php_serialize.PhpArray{}
+			array[key] = next
+		}
+		array = next
+	}
+	array[path[len(path)-1]] = value
+}
+
+// variable returns the value of an array variable of a PHP file after running its assignments
+func variable(source string, name string) (php_serialize.PhpArray, error) {
+	list, err := assignments(source, name)
+	if err != nil {
+		return nil, err
+	}
+	res := php_serialize.PhpArray{}
+	for _, a := range list {
+		if len(a.path) == 0 {
+			if array, ok := a.value.(php_serialize.PhpArray); ok {
+				res = array
+			}
+			continue
+		}
+		assign(res, a.path, a.value)
+	}
+	return res, nil
+}
+
+// mergeArray overrides the values of an array with the ones of another, recursively as Drupal
+// applies the configuration overrides
+func mergeArray(array php_serialize.PhpArray, overrides php_serialize.PhpArray) php_serialize.PhpArray {
+	res := php_serialize.PhpArray{}
+	for k, v := range array {
+		res[k] = v
+	}
+	for k, v := range overrides {
+		current, ok := res[k].(php_serialize.PhpArray)
+		override, isArray := v.(php_serialize.PhpArray)
+		if ok && isArray {
+			res[k] = mergeArray(current, override)
+			continue
+		}
+		res[k] = v
+	}
+	return res
+}
@@ -0,0 +1,119 @@
+package drupal
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps/php"
+	"github.com/bitnami/healthcheck-tools/pkg/mysql"
+	"github.com/juju/errors"
+	"github.com/yvasiyarov/php_session_decoder/php_serialize"
+)
+
+// Defaults of Drupal and the MySQL client
+const (
+	defaultDBHost = "localhost"
+	defaultDBPort = 3306
+)
+
+// siteSettings contains the settings of settings.php
+type siteSettings struct {
+	Database mysql.Database
+	// Prefix is the prefix of the tables of the site
+	Prefix string
+	// overrides are the configuration overrides set with $config, by configuration name
+	overrides php_serialize.PhpArray
+}
+
+// table returns the name of a table of the site
+func (s *siteSettings) table(name string) string {
+	return s.Prefix + name
+}
+
+// databaseString returns a setting of the database connection, which must be a literal value
+func databaseString(connection php_serialize.PhpArray, key string) (string, error) {
+	if expression, ok := php.ArrayValue(connection, key).(phpExpression); ok {
+		return "", errors.Errorf("'%s' is not set with a literal value: %s", key, expression)
+	}
+	return php.ArrayString(connection, key), nil
+}
+
+// parseDatabase reads the default connection of the $databases array. The prefix is a string, or
+// an array with the default one in Drupal 7
+func parseDatabase(databases php_serialize.PhpArray) (mysql.Database, string, error) {
+	connection, ok := php.ArrayValue(databases, "default", "default").(php_serialize.PhpArray)
+	if !ok {
+		return mysql.Database{}, "", errors.New("$databases['default']['default'] is not defined")
+	}
+	values := map[string]string{}
+	for _, key := range []string{"driver", "host", "port", "unix_socket", "database", "username", "password"} {
+		value, err := databaseString(connection, key)
+		if err != nil {
+			return mysql.Database{}, "", err
+		}
+		values[key] = value
+	}
+	switch values["driver"] {
+	case "", "mysql":
+	default:
+		return mysql.Database{}, "", errors.Errorf("the %q database driver is not supported, only MySQL and MariaDB databases can be read", values["driver"])
+	}
+	if values["database"] == "" {
+		return mysql.Database{}, "", errors.New("'database' is not set")
+	}
+	database := mysql.Database{
+		Host:   values["host"],
+		Port:   defaultDBPort,
+		Socket: values["unix_socket"],
+		Name:   values["database"],
+		User:   values["username"],
+		Pass:   values["password"],
+	}
+	if database.Host == "" {
+		database.Host = defaultDBHost
+	}
+	if values["port"] != "" {
+		port, err := strconv.Atoi(values["port"])
+		if err != nil {
+			return mysql.Database{}, "", errors.Errorf("invalid port %q", values["port"])
+		}
+		database.Port = port
+	}
+	prefix := php.ArrayString(connection, "prefix")
+	if _, ok := php.ArrayValue(connection, "prefix").(php_serialize.PhpArray); ok {
+		prefix = php.ArrayString(connection, "prefix", "default")
+	}
+	return database, prefix, nil
+}
+
+// parseSettings reads the database connection and the configuration overrides of settings.php
+func parseSettings(settingsFile string) (*siteSettings, error) {
+	content, err := os.ReadFile(settingsFile)
+	if err != nil {
+		return nil, err
+	}
+	source := string(content)
+	databases, err := variable(source, "databases")
+	if err != nil {
+		return nil, err
+	}
+	database, prefix, err := parseDatabase(databases)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := variable(source, "config")
+	if err != nil {
+		return nil, err
+	}
+	return &siteSettings{Database: database, Prefix: prefix, overrides: overrides}, nil
+}
+
+// override returns the overrides of settings.php of a configuration object, if any
+func (s *siteSettings) override(name string) (php_serialize.PhpArray, bool) {
+	override, ok := s.overrides[name].(php_serialize.PhpArray)
+	if ok {
+		fmt.Printf("Using the %s configuration overridden in settings.php\n", name)
+	}
+	return override, ok
+}
@@ -0,0 +1,150 @@
+package drupal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bitnami/healthcheck-tools/pkg/mysql"
+	"github.com/yvasiyarov/php_session_decoder/php_serialize"
+)
+
+var testSettings = `<?php
+
+/**
+ * Database settings:
+ *
+ * @code
+ * $databases['default']['default'] = [
+ *   'database' => 'example',
+ *   'host' => 'example.com',
+ * ];
+ * @endcode
+ */
+$databases = [];
+
+$settings['hash_salt'] = 'salt';
+
+$databases['default']['default'] = array (
+  'database' => 'bitnami_drupal',
+  'username' => 'bn_drupal',
+  'password' => 'pa$$\'word',
+  'prefix' => '',
+  'host' => '127.0.0.1',
+  'port' => '3306',
+  'namespace' => 'Drupal\\mysql\\Driver\\Database\\mysql',
+  'driver' => 'mysql',
+  'autoload' => 'core/modules/mysql/src/Driver/Database/mysql/',
+);
+# $databases['default']['default']['host'] = 'commented.example.com';
+$config['smtp.settings']['smtp_password'] = "secret";
+$config['system.site']['name'] = 'Overridden';
+`
+
+func writeSettings(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "settings.php")
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestParseSettings(t *testing.T) {
+	s, err := parseSettings(writeSettings(t, testSettings))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := mysql.Database{Host: "127.0.0.1", Port: 3306, Name: "bitnami_drupal", User: "bn_drupal", Pass: `pa$$'word`}
+	if s.Database != expected {
+		t.Errorf("expected database %+v, got %+v", expected, s.Database)
+	}
+	if s.table("config") != "config" {
+		t.Errorf("expected config table, got %s", s.table("config"))
+	}
+	overrides := php_serialize.PhpArray{
+		"smtp.settings": php_serialize.PhpArray{"smtp_password": "secret"},
+		"system.site":   php_serialize.PhpArray{"name": "Overridden"},
+	}
+	if !reflect.DeepEqual(s.overrides, overrides) {
+		t.Errorf("expected overrides %v, got %v", overrides, s.overrides)
+	}
+}
+
+func TestParseDatabase(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected mysql.Database
+		prefix   string
+		err      string
+	}{
+		{
+			name: "short array syntax with socket and prefix",
+			content: `$databases['default']['default'] = [
+  'database' => "drupal", 'username' => 'drupal', 'password' => 'XXXXXXXX',
+  'host' => 'localhost', 'unix_socket' => '/run/mysqld/mysqld.sock', 'prefix' => 'd_',
+];`,
+			expected: mysql.Database{Host: "localhost", Port: 3306, Socket: "/run/mysqld/mysqld.sock", Name: "drupal", User: "drupal", Pass: "XXXXXXXX"},
+			prefix:   "d_",
+		},
+		{
+			name: "Drupal 7 nested arrays",
+			content: `$databases = array(
+  'default' => array(
+    'default' => array(
+      'database' => 'drupal7', 'username' => 'user', 'password' => 'pass',
+      'host' => 'db.example.com', 'port' => 3307, 'driver' => 'mysql',
+      'prefix' => array('default' => 'main_', 'users' => 'shared_'),
+    ),
+  ),
+);`,
+			expected: mysql.Database{Host: "db.example.com", Port: 3307, Name: "drupal7", User: "user", Pass: "pass"},
+			prefix:   "main_",
+		},
+		{
+			name: "settings set one by one",
+			content: `$databases['default']['default'] = ['database' => 'drupal', 'host' => 'db'];
+$databases['default']['default']['host'] = 'mariadb';
+$databases['default']['default']['port'] = 3308;`,
+			expected: mysql.Database{Host: "mariadb", Port: 3308, Name: "drupal"},
+		},
+		{
+			name:    "environment variables",
+			content: `$databases['default']['default'] = ['database' => 'drupal', 'host' => getenv('DB_HOST'), 'port' => 3306];`,
+			err:     "'host' is not set with a literal value: getenv('DB_HOST')",
+		},
+		{
+			name:    "PostgreSQL",
+			content: `$databases['default']['default'] = ['database' => 'drupal', 'driver' => 'pgsql'];`,
+			err:     `the "pgsql" database driver is not supported`,
+		},
+		{
+			name:    "no database",
+			content: `// $databases['default']['default'] = ['database' => 'drupal'];`,
+			err:     "$databases['default']['default'] is not defined",
+		},
+	}
+	for _, test := range tests {
+		t.Run("Check "+test.name, func(t *testing.T) {
+			s, err := parseSettings(writeSettings(t, "<?php\n"+test.content+"\n"))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if s.Database != test.expected {
+				t.Errorf("expected database %+v, got %+v", test.expected, s.Database)
+			}
+			if s.Prefix != test.prefix {
+				t.Errorf("expected prefix %q, got %q", test.prefix, s.Prefix)
+			}
+		})
+	}
+}
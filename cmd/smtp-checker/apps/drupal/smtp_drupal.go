@@ -0,0 +1,247 @@
+package drupal
+
+import (
+	"database/sql"
+	"fmt"
+	"net/mail"
+	"strconv"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps/php"
+	"github.com/bitnami/healthcheck-tools/pkg/mysql"
+	"github.com/juju/errors"
+	"github.com/yvasiyarov/php_session_decoder/php_serialize"
+)
+
+const (
+	configFilePath = "sites/default/settings.php"
+)
+
+func init() {
+	apps.Register(apps.Application{
+		Name:       "drupal",
+		Layouts:    apps.BitnamiLayouts("drupal"),
+		EnvPrefix:  "DRUPAL",
+		ConfigFile: configFilePath,
+		Load:       QueryConfig,
+	})
+}
+
+// Supported mail modules
+const (
+	moduleSMTP          = "smtp"
+	moduleSymfonyMailer = "symfony_mailer"
+)
+
+// Config is a structure that contains the mail
+// configuration data of Drupal
+type Config struct {
+	// Module is the mail module whose settings are used. Without it, Drupal uses PHP mail()
+	Module string
+	// SMTP contains the settings of the SMTP module
+	SMTP *smtpSettings
+	// Transport is the default transport of Symfony Mailer
+	Transport *mailerTransport
+	// SiteMail and SiteName are the sender of the site mails, unless the module sets another one
+	SiteMail string
+	SiteName string
+}
+
+// GetSMTPSettings returns a SMTPSettings from Config structure
+func (c *Config) GetSMTPSettings() *apps.SMTPSettings {
+	settings := &apps.SMTPSettings{}
+	fromMail, fromName := c.SiteMail, c.SiteName
+	switch {
+	case c.SMTP != nil:
+		settings.Host = c.SMTP.Host
+		settings.Port, _ = strconv.Atoi(c.SMTP.Port)
+		settings.User = c.SMTP.Username
+		settings.Pass = c.SMTP.Password
+		settings.Security = c.SMTP.connectionSecurity()
+		if c.SMTP.From != "" {
+			fromMail, fromName = c.SMTP.From, c.SMTP.FromName
+		}
+	case c.Transport != nil:
+		settings.Host = c.Transport.Host
+		settings.Port = c.Transport.port()
+		settings.User = c.Transport.User
+		settings.Pass = c.Transport.Pass
+		settings.Security = c.Transport.connectionSecurity()
+	}
+	if fromMail != "" {
+		settings.From = (&mail.Address{Name: fromName, Address: fromMail}).String()
+	}
+	// Both modules only authenticate when the user is set, negotiating the mechanism
+	if settings.User == "" {
+		settings.Auth = apps.AuthNone
+	}
+	return settings
+}
+
+// Mailer returns the way Drupal sends the mails. Without a mail module, or with the native
+// transport of Symfony Mailer, the PHP mail() function is used
+func (c *Config) Mailer() apps.Mailer {
+	switch {
+	case c.Module == "":
+		return apps.MailerPHPMail
+	case c.Transport != nil && c.Transport.Plugin == "native":
+		return apps.MailerPHPMail
+	case c.Transport != nil && c.Transport.Plugin == "sendmail":
+		return apps.MailerSendmail
+	}
+	return apps.MailerSMTP
+}
+
+// SendmailCommand returns the sendmail command run by the sendmail transport of Symfony Mailer
+func (c *Config) SendmailCommand() string {
+	if c.Transport == nil || c.Transport.Command == "" {
+		return defaultSendmailCommand
+	}
+	return c.Transport.Command
+}
+
+// ValidateSMTPSettings checks the settings of the mail module are correct
+func (c *Config) ValidateSMTPSettings() error {
+	switch {
+	case c.SMTP != nil:
+		return c.SMTP.validate()
+	case c.Transport != nil:
+		return c.Transport.validate()
+	}
+	return nil
+}
+
+// queryConfig returns the serialized data of a configuration object. Only the default collection
+// is read, the other ones contain the language overrides
+var queryConfig = func(s *siteSettings, name string) (string, error) {
+	query := mysql.Query{
+		Table:   s.table("config"),
+		Column:  "data",
+		Key:     "name",
+		Value:   name,
+		Filters: map[string]string{"collection": ""},
+	}
+	return s.Database.MySQLQuery(query)
+}
+
+// readConfig returns a configuration object with the overrides of settings.php applied. It returns
+// sql.ErrNoRows when the object is neither stored nor overridden
+func readConfig(s *siteSettings, name string) (php_serialize.PhpArray, error) {
+	override, overridden := s.override(name)
+	value, err := queryConfig(s, name)
+	if errors.Is(err, sql.ErrNoRows) && overridden {
+		return override, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := php_serialize.NewUnSerializer(value).Decode()
+	if err != nil {
+		return nil, errors.Errorf("error while decoding %s configuration: %v", name, err)
+	}
+	data, ok := decoded.(php_serialize.PhpArray)
+	if !ok {
+		return nil, errors.Errorf("unable to convert %s configuration to PhpArray", name)
+	}
+	if overridden {
+		data = mergeArray(data, override)
+	}
+	return data, nil
+}
+
+// obtainSymfonyMailer reads the default transport of Symfony Mailer
+func obtainSymfonyMailer(s *siteSettings, config *Config) error {
+	mailerSettings, err := readConfig(s, "symfony_mailer.settings")
+	if err != nil {
+		return errors.Errorf("error reading symfony_mailer.settings configuration: %v", err)
+	}
+	id := php.ArrayString(mailerSettings, "default_transport")
+	if id == "" {
+		return errors.New("symfony_mailer.settings: default_transport is not set")
+	}
+	data, err := readConfig(s, symfonyMailerTransports+id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.Errorf("the %q default transport of Symfony Mailer does not exist", id)
+	}
+	if err != nil {
+		return errors.Errorf("error reading the %q transport: %v", id, err)
+	}
+	if config.Transport, err = decodeTransport(id, data); err != nil {
+		return errors.Errorf("%s%s: %v", symfonyMailerTransports, id, err)
+	}
+	fmt.Printf("Reading the settings of the %q transport of Symfony Mailer (%s plugin)\n", id, config.Transport.Plugin)
+	if !config.Transport.VerifyPeer {
+		fmt.Println("Warning: verify_peer is disabled, Symfony Mailer does not verify the SMTP server certificate but the checks do")
+	}
+	return nil
+}
+
+// obtainConfig reads the settings of the enabled mail module. Symfony Mailer replaces the mail
+// system of Drupal, while the SMTP module is used when it is the mail system or is turned on
+func obtainConfig(s *siteSettings) (*Config, error) {
+	extension, err := readConfig(s, "core.extension")
+	if err != nil {
+		return nil, errors.Errorf("error checking the enabled modules: %v", err)
+	}
+	modules, _ := php.ArrayValue(extension, "module").(php_serialize.PhpArray)
+	enabled := func(module string) bool {
+		_, ok := modules[module]
+		return ok
+	}
+	config := &Config{}
+	// The sender is optional, the modules use the site e-mail address when it is set
+	if site, err := readConfig(s, "system.site"); err == nil {
+		config.SiteMail, config.SiteName = php.ArrayString(site, "mail"), php.ArrayString(site, "name")
+	} else {
+		fmt.Printf("Unable to obtain the site e-mail address: %v\n", err)
+	}
+	if enabled(moduleSymfonyMailer) {
+		if enabled(moduleSMTP) {
+			fmt.Println("Warning: the SMTP and Symfony Mailer modules are enabled, Symfony Mailer replaces the mail system and sends the mails. Checking the Symfony Mailer settings")
+		}
+		config.Module = moduleSymfonyMailer
+		if err := obtainSymfonyMailer(s, config); err != nil {
+			return nil, err
+		}
+		return config, nil
+	}
+	mailSystem := defaultMailSystem
+	if data, err := readConfig(s, "system.mail"); err == nil {
+		if value := php.ArrayString(data, "interface", "default"); value != "" {
+			mailSystem = value
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Errorf("error reading system.mail configuration: %v", err)
+	}
+	if enabled(moduleSMTP) {
+		data, err := readConfig(s, "smtp.settings")
+		if err != nil {
+			return nil, errors.Errorf("error reading smtp.settings configuration: %v", err)
+		}
+		smtp := decodeSMTPSettings(data)
+		if smtp.On || mailSystem == smtpMailSystem {
+			fmt.Println("Reading the settings of the SMTP module")
+			config.Module, config.SMTP = moduleSMTP, smtp
+			return config, nil
+		}
+		fmt.Println("The SMTP module is enabled but turned off")
+	}
+	if mailSystem != defaultMailSystem {
+		return nil, errors.Errorf("Drupal sends the mails with the %q mail system, which can not be checked", mailSystem)
+	}
+	fmt.Println("No mail module active, Drupal sends the mails using PHP mail()")
+	return config, nil
+}
+
+// QueryConfig obtains an ApplicationConfig by querying the MySQL database set in settings.php
+func QueryConfig(configFile string) (apps.ApplicationConfig, error) {
+	s, err := parseSettings(configFile)
+	if err != nil {
+		return nil, errors.Errorf("error parsing settings.php file: %v", err)
+	}
+	config, err := obtainConfig(s)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
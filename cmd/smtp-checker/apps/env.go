@@ -0,0 +1,213 @@
+package apps
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// envVariable is a SMTP setting of the Bitnami containers, set with <PREFIX>_SMTP_<SUFFIX>
+type envVariable struct {
+	suffix string
+	// set stores the value in the settings
+	set func(c *EnvConfig, value string) error
+	// get returns the value of the setting, to compare it with the environment
+	get    func(s *SMTPSettings) string
+	secret bool
+}
+
+// fromAddress returns the sender address of the settings, or an empty one if there is none
+func fromAddress(s *SMTPSettings) *mail.Address {
+	if s.From == "" {
+		return &mail.Address{}
+	}
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return &mail.Address{Address: s.From}
+	}
+	return from
+}
+
+var envVariables = []envVariable{
+	{
+		suffix: "HOST",
+		set:    func(c *EnvConfig, value string) error { c.settings.Host = value; return nil },
+		get:    func(s *SMTPSettings) string { return strings.ToLower(s.Host) },
+	},
+	{
+		suffix: "PORT_NUMBER",
+		set: func(c *EnvConfig, value string) (err error) {
+			c.settings.Port, err = strconv.Atoi(value)
+			return err
+		},
+		get: func(s *SMTPSettings) string { return strconv.Itoa(s.Port) },
+	},
+	{
+		suffix: "USER",
+		set:    func(c *EnvConfig, value string) error { c.settings.User = value; return nil },
+		get:    func(s *SMTPSettings) string { return s.User },
+	},
+	{
+		suffix: "PASSWORD",
+		set:    func(c *EnvConfig, value string) error { c.settings.Pass = value; return nil },
+		get:    func(s *SMTPSettings) string { return s.Pass },
+		secret: true,
+	},
+	{
+		// The containers use "ssl" for implicit TLS and "tls" for STARTTLS
+		suffix: "PROTOCOL",
+		set: func(c *EnvConfig, value string) error {
+			switch strings.ToLower(value) {
+			case "ssl":
+				c.settings.Security = SecurityImplicitTLS
+			case "tls":
+				c.settings.Security = SecuritySTARTTLS
+			case "":
+			default:
+				return errors.Errorf("invalid protocol %q (use ssl or tls)", value)
+			}
+			return nil
+		},
+		get: func(s *SMTPSettings) string {
+			switch s.Security {
+			case SecurityImplicitTLS:
+				return "ssl"
+			case SecuritySTARTTLS:
+				return "tls"
+			}
+			return ""
+		},
+	},
+	{
+		// Redmine uses the names of ActionMailer: plain, login or cram_md5
+		suffix: "AUTH",
+		set: func(c *EnvConfig, value string) error {
+			return c.settings.Auth.Set(strings.ReplaceAll(strings.TrimPrefix(value, ":"), "_", "-"))
+		},
+		get: func(s *SMTPSettings) string { return strings.ReplaceAll(strings.ToLower(string(s.Auth)), "-", "_") },
+	},
+	{
+		suffix: "FROM_EMAIL",
+		set:    func(c *EnvConfig, value string) error { c.fromEmail = value; return nil },
+		get:    func(s *SMTPSettings) string { return strings.ToLower(fromAddress(s).Address) },
+	},
+	{
+		suffix: "FROM_NAME",
+		set:    func(c *EnvConfig, value string) error { c.fromName = value; return nil },
+		get:    func(s *SMTPSettings) string { return fromAddress(s).Name },
+	},
+}
+
+// EnvConfig is the SMTP configuration set with the environment variables of a Bitnami container,
+// e.g. WORDPRESS_SMTP_HOST. Each variable can also be read from a file set with the _FILE variant,
+// e.g. WORDPRESS_SMTP_PASSWORD_FILE
+type EnvConfig struct {
+	prefix    string
+	settings  SMTPSettings
+	fromEmail string
+	fromName  string
+	// values are the values of the variables found, by suffix
+	values map[string]string
+}
+
+// envValue returns the value of a variable or, if it is not set, the content of the file set in
+// its _FILE variant
+func envValue(name string) (string, bool, error) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true, nil
+	}
+	file, ok := os.LookupEnv(name + "_FILE")
+	if !ok {
+		return "", false, nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", false, errors.Errorf("error reading %s_FILE: %v", name, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+// LoadEnvConfig reads the SMTP settings from the environment variables with the given prefix,
+// e.g. WORDPRESS. It returns nil when none is set
+func LoadEnvConfig(prefix string) (*EnvConfig, error) {
+	c := &EnvConfig{prefix: prefix, values: map[string]string{}}
+	var found []envVariable
+	for _, v := range envVariables {
+		name := c.variable(v)
+		value, ok, err := envValue(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if err := v.set(c, strings.TrimSpace(value)); err != nil {
+			return nil, errors.Errorf("invalid %s: %v", name, err)
+		}
+		found = append(found, v)
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	// The values are normalised as the persisted ones to compare them
+	settings := c.GetSMTPSettings()
+	for _, v := range found {
+		c.values[v.suffix] = v.get(settings)
+	}
+	return c, nil
+}
+
+func (c *EnvConfig) variable(v envVariable) string {
+	return fmt.Sprintf("%s_SMTP_%s", c.prefix, v.suffix)
+}
+
+// GetSMTPSettings returns the SMTPSettings set with the environment variables
+func (c *EnvConfig) GetSMTPSettings() *SMTPSettings {
+	settings := c.settings
+	if c.fromEmail != "" {
+		settings.From = (&mail.Address{Name: c.fromName, Address: c.fromEmail}).String()
+	}
+	return &settings
+}
+
+// ValidateSMTPSettings checks the required variables are set
+func (c *EnvConfig) ValidateSMTPSettings() error {
+	for _, suffix := range []string{"HOST", "PORT_NUMBER", "USER", "PASSWORD"} {
+		if _, ok := c.values[suffix]; !ok {
+			return errors.Errorf("%s_SMTP_%s: not set", c.prefix, suffix)
+		}
+	}
+	return nil
+}
+
+// Drift is a difference between an environment variable and the persisted configuration
+type Drift struct {
+	Variable  string
+	Env       string
+	Persisted string
+}
+
+// Drift compares the variables set with the persisted settings of the application. The
+// variables are only applied when the container is initialised, so they can differ
+func (c *EnvConfig) Drift(persisted *SMTPSettings) []Drift {
+	var res []Drift
+	for _, v := range envVariables {
+		env, ok := c.values[v.suffix]
+		if !ok {
+			continue
+		}
+		value := v.get(persisted)
+		if env == value {
+			continue
+		}
+		if v.secret {
+			env, value = "xxxxxx", "xxxxxx (differs)"
+		}
+		res = append(res, Drift{Variable: c.variable(v), Env: env, Persisted: value})
+	}
+	return res
+}
@@ -0,0 +1,104 @@
+package apps
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadEnvConfig(t *testing.T) {
+	t.Run("Check no configuration is returned without variables", func(t *testing.T) {
+		config, err := LoadEnvConfig("SMTPCHECKERTEST")
+		if config != nil || err != nil {
+			t.Errorf("expected no configuration, got %+v, %v", config, err)
+		}
+	})
+	t.Run("Check the settings are read from the variables and files", func(t *testing.T) {
+		passwordFile := filepath.Join(t.TempDir(), "password")
+		if err := os.WriteFile(passwordFile, []byte("XXXXXXXX\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("WORDPRESS_SMTP_HOST", "smtp.example.com")
+		t.Setenv("WORDPRESS_SMTP_PORT_NUMBER", "465")
+		t.Setenv("WORDPRESS_SMTP_USER", "user@example.com")
+		t.Setenv("WORDPRESS_SMTP_PASSWORD_FILE", passwordFile)
+		t.Setenv("WORDPRESS_SMTP_PROTOCOL", "ssl")
+		t.Setenv("WORDPRESS_SMTP_FROM_EMAIL", "blog@example.com")
+		t.Setenv("WORDPRESS_SMTP_FROM_NAME", "Blog")
+		config, err := LoadEnvConfig("WORDPRESS")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := config.ValidateSMTPSettings(); err != nil {
+			t.Errorf("unexpected validation error: %v", err)
+		}
+		expected := &SMTPSettings{
+			Host:     "smtp.example.com",
+			Port:     465,
+			User:     "user@example.com",
+			Pass:     "XXXXXXXX",
+			Security: SecurityImplicitTLS,
+			From:     `"Blog" <blog@example.com>`,
+		}
+		if settings := config.GetSMTPSettings(); !reflect.DeepEqual(settings, expected) {
+			t.Errorf("expected %+v, got %+v", expected, settings)
+		}
+	})
+	tests := map[string]string{
+		"REDMINE_SMTP_PORT_NUMBER": "smtp",
+		"REDMINE_SMTP_PROTOCOL":    "starttls",
+		"REDMINE_SMTP_AUTH":        "digest_md5",
+	}
+	for variable, value := range tests {
+		t.Run("Check invalid "+variable, func(t *testing.T) {
+			t.Setenv(variable, value)
+			if _, err := LoadEnvConfig("REDMINE"); err == nil || !strings.Contains(err.Error(), "invalid "+variable) {
+				t.Errorf("expected invalid %s error, got %v", variable, err)
+			}
+		})
+	}
+	t.Run("Check missing variables are reported", func(t *testing.T) {
+		t.Setenv("REDMINE_SMTP_HOST", "smtp.example.com")
+		t.Setenv("REDMINE_SMTP_AUTH", ":cram_md5")
+		config, err := LoadEnvConfig("REDMINE")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if config.GetSMTPSettings().Auth != AuthCRAMMD5 {
+			t.Errorf("expected %s authentication, got %q", AuthCRAMMD5, config.GetSMTPSettings().Auth)
+		}
+		if err := config.ValidateSMTPSettings(); err == nil || !strings.Contains(err.Error(), "REDMINE_SMTP_PORT_NUMBER: not set") {
+			t.Errorf("expected REDMINE_SMTP_PORT_NUMBER error, got %v", err)
+		}
+	})
+}
+
+func TestEnvConfigDrift(t *testing.T) {
+	t.Setenv("WORDPRESS_SMTP_HOST", "SMTP.example.com")
+	t.Setenv("WORDPRESS_SMTP_PORT_NUMBER", "587")
+	t.Setenv("WORDPRESS_SMTP_PASSWORD", "new-password")
+	t.Setenv("WORDPRESS_SMTP_PROTOCOL", "tls")
+	t.Setenv("WORDPRESS_SMTP_FROM_EMAIL", "Blog@example.com")
+	config, err := LoadEnvConfig("WORDPRESS")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	persisted := &SMTPSettings{
+		Host:     "smtp.example.com",
+		Port:     465,
+		User:     "user@example.com",
+		Pass:     "old-password",
+		Security: SecurityImplicitTLS,
+		From:     `"Blog" <blog@example.com>`,
+	}
+	expected := []Drift{
+		{Variable: "WORDPRESS_SMTP_PORT_NUMBER", Env: "587", Persisted: "465"},
+		{Variable: "WORDPRESS_SMTP_PASSWORD", Env: "xxxxxx", Persisted: "xxxxxx (differs)"},
+		{Variable: "WORDPRESS_SMTP_PROTOCOL", Env: "tls", Persisted: "ssl"},
+	}
+	if drift := config.Drift(persisted); !reflect.DeepEqual(drift, expected) {
+		t.Errorf("expected drift %+v, got %+v", expected, drift)
+	}
+}
@@ -0,0 +1,77 @@
+// Package php provides functions for reading the PHP values of the applications configuration
+package php
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/yvasiyarov/php_session_decoder/php_serialize"
+)
+
+// ArrayKey converts a key as PHP does: the decimal strings are integer keys
+func ArrayKey(key php_serialize.PhpValue) php_serialize.PhpValue {
+	if s, ok := key.(string); ok {
+		if n, err := strconv.Atoi(s); err == nil && strconv.Itoa(n) == s {
+			return n
+		}
+	}
+	return key
+}
+
+// ArrayValue returns the value of an array at a path of keys, or nil if there is none
+func ArrayValue(array php_serialize.PhpArray, keys ...string) php_serialize.PhpValue {
+	var value php_serialize.PhpValue = array
+	for _, key := range keys {
+		current, ok := value.(php_serialize.PhpArray)
+		if !ok {
+			return nil
+		}
+		value = current[ArrayKey(key)]
+	}
+	return value
+}
+
+// ArrayString returns a string value of an array, converting scalars as PHP does
+func ArrayString(array php_serialize.PhpArray, keys ...string) string {
+	switch v := ArrayValue(array, keys...).(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+	}
+	return ""
+}
+
+// ArrayInt returns an integer value of an array, which the forms usually store as strings
+func ArrayInt(array php_serialize.PhpArray, keys ...string) (int, error) {
+	value := ArrayString(array, keys...)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, errors.Errorf("%s: invalid number %q", strings.Join(keys, "."), value)
+	}
+	return n, nil
+}
+
+// ArrayBool returns a boolean value of an array, stored as a boolean, a number or a string
+func ArrayBool(array php_serialize.PhpArray, keys ...string) bool {
+	return Bool(ArrayString(array, keys...))
+}
+
+// Bool converts a string to a boolean as PHP does, also accepting "false", "off" and "no"
+func Bool(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "0", "false", "off", "no":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package php
+
+import (
+	"testing"
+
+	"github.com/yvasiyarov/php_session_decoder/php_serialize"
+)
+
+var testArray = php_serialize.PhpArray{
+	"smtp": php_serialize.PhpArray{"host": "smtp.example.com", "port": 587, "timeout": 1.5, "auth": true, "autotls": "no"},
+	"list": php_serialize.PhpArray{0: "first", 1: "second"},
+}
+
+func TestArrayString(t *testing.T) {
+	tests := []struct {
+		keys     []string
+		expected string
+	}{
+		{[]string{"smtp", "host"}, "smtp.example.com"},
+		{[]string{"smtp", "port"}, "587"},
+		{[]string{"smtp", "timeout"}, "1.5"},
+		{[]string{"smtp", "auth"}, "1"},
+		{[]string{"list", "1"}, "second"},
+		{[]string{"smtp", "host", "name"}, ""},
+		{[]string{"missing"}, ""},
+	}
+	for _, test := range tests {
+		if value := ArrayString(testArray, test.keys...); value != test.expected {
+			t.Errorf("expected %q for %v, got %q", test.expected, test.keys, value)
+		}
+	}
+}
+
+func TestArrayInt(t *testing.T) {
+	if port, err := ArrayInt(testArray, "smtp", "port"); err != nil || port != 587 {
+		t.Errorf("expected port 587, got %d (%v)", port, err)
+	}
+	if _, err := ArrayInt(testArray, "smtp", "host"); err == nil {
+		t.Error("expected an error reading a host name as a number")
+	}
+}
+
+func TestBool(t *testing.T) {
+	for value, expected := range map[string]bool{
+		"": false, "0": false, "false": false, "FALSE": false, "off": false, "no": false,
+		"1": true, "true": true, "yes": true, "on": true, "2": true,
+	} {
+		if Bool(value) != expected {
+			t.Errorf("expected %v for %q, got %v", expected, value, !expected)
+		}
+	}
+	if !ArrayBool(testArray, "smtp", "auth") || ArrayBool(testArray, "smtp", "autotls") || ArrayBool(testArray, "missing") {
+		t.Error("incorrect boolean values read from the array")
+	}
+}
@@ -0,0 +1,229 @@
+package apps
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/mkmik/multierror"
+)
+
+// SenderRule is the restriction a provider applies to the mail sender
+type SenderRule int
+
+// Sender restrictions. With SenderVerified, the sender must be verified in the provider console,
+// which can not be checked from here
+const (
+	SenderAny SenderRule = iota
+	SenderUser
+	SenderUserDomain
+	SenderVerified
+)
+
+var (
+	mailAddressRe = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	uuidRe        = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// Provider is the profile of a well-known SMTP provider with its known-good settings
+type Provider struct {
+	Name string
+	// Hosts matches the SMTP host names of the provider. Its "region" group, if any, is validated
+	// against Regions
+	Hosts   *regexp.Regexp
+	Regions []string
+	// Ports are the supported ports and the connection security required on each one
+	Ports map[int]ConnectionSecurity
+	Auth  []AuthMechanism
+	// User matches the valid user names, UserFormat describes them
+	User       *regexp.Regexp
+	UserFormat string
+	Sender     SenderRule
+	// Note is a tip about the provider shown when its profile is used
+	Note string
+}
+
+var starttlsAndImplicitTLS = map[int]ConnectionSecurity{
+	25: SecuritySTARTTLS, 587: SecuritySTARTTLS, 2525: SecuritySTARTTLS, 465: SecurityImplicitTLS,
+}
+
+// Providers are the profiles of the well-known SMTP providers
+var Providers = []Provider{
+	{
+		Name:       "Gmail",
+		Hosts:      regexp.MustCompile(`^smtp\.(gmail|googlemail)\.com$`),
+		Ports:      map[int]ConnectionSecurity{25: SecuritySTARTTLS, 587: SecuritySTARTTLS, 465: SecurityImplicitTLS},
+		Auth:       []AuthMechanism{AuthPlain, AuthLogin, AuthXOAUTH2},
+		User:       mailAddressRe,
+		UserFormat: "the full Google account address",
+		Sender:     SenderUser,
+		Note:       "Use an app password (it requires 2-Step Verification) or XOAUTH2, the account password is rejected",
+	},
+	{
+		Name:       "Office 365",
+		Hosts:      regexp.MustCompile(`^smtp(\.office365|-mail\.outlook)\.com$`),
+		Ports:      map[int]ConnectionSecurity{25: SecuritySTARTTLS, 587: SecuritySTARTTLS},
+		Auth:       []AuthMechanism{AuthLogin, AuthXOAUTH2},
+		User:       mailAddressRe,
+		UserFormat: "the full mailbox address",
+		Sender:     SenderUser,
+		Note:       "SMTP AUTH must be enabled for the mailbox, and sending as other addresses requires the Send As permission",
+	},
+	{
+		Name:  "Amazon SES",
+		Hosts: regexp.MustCompile(`^email-smtp(?:-fips)?\.(?P<region>[a-z0-9-]+)\.amazonaws\.com$`),
+		Regions: []string{
+			"af-south-1", "ap-northeast-1", "ap-northeast-2", "ap-northeast-3", "ap-south-1", "ap-southeast-1",
+			"ap-southeast-2", "ap-southeast-3", "ca-central-1", "eu-central-1", "eu-central-2", "eu-north-1",
+			"eu-south-1", "eu-west-1", "eu-west-2", "eu-west-3", "il-central-1", "me-central-1", "me-south-1",
+			"sa-east-1", "us-east-1", "us-east-2", "us-gov-east-1", "us-gov-west-1", "us-west-1", "us-west-2",
+		},
+		Ports: map[int]ConnectionSecurity{
+			25: SecuritySTARTTLS, 587: SecuritySTARTTLS, 2587: SecuritySTARTTLS, 465: SecurityImplicitTLS, 2465: SecurityImplicitTLS,
+		},
+		Auth:       []AuthMechanism{AuthPlain, AuthLogin},
+		User:       regexp.MustCompile(`^AKIA[0-9A-Z]{16}$`),
+		UserFormat: "the SMTP user name generated by SES (starting with AKIA), not the IAM user name",
+		Sender:     SenderVerified,
+		Note:       "The SMTP credentials are specific to the region, and new accounts can only send to verified addresses until they leave the sandbox",
+	},
+	{
+		Name:       "SendGrid",
+		Hosts:      regexp.MustCompile(`^smtp\.sendgrid\.net$`),
+		Ports:      starttlsAndImplicitTLS,
+		Auth:       []AuthMechanism{AuthPlain, AuthLogin},
+		User:       regexp.MustCompile(`^apikey$`),
+		UserFormat: `"apikey", with the API key as password`,
+		Sender:     SenderVerified,
+	},
+	{
+		Name:       "Mailgun",
+		Hosts:      regexp.MustCompile(`^smtp\.(eu\.)?mailgun\.org$`),
+		Ports:      starttlsAndImplicitTLS,
+		Auth:       []AuthMechanism{AuthPlain, AuthLogin},
+		User:       mailAddressRe,
+		UserFormat: "the SMTP login of the domain, e.g. postmaster@mg.example.com",
+		Sender:     SenderUserDomain,
+		Note:       "Domains in the EU region use smtp.eu.mailgun.org",
+	},
+	{
+		Name:  "Mailjet",
+		Hosts: regexp.MustCompile(`^in(-v3)?\.mailjet\.com$`),
+		Ports: map[int]ConnectionSecurity{
+			25: SecuritySTARTTLS, 80: SecuritySTARTTLS, 587: SecuritySTARTTLS, 588: SecuritySTARTTLS, 465: SecurityImplicitTLS,
+		},
+		Auth:       []AuthMechanism{AuthPlain, AuthLogin},
+		User:       regexp.MustCompile(`^[0-9a-f]{32}$`),
+		UserFormat: "the API key, with the secret key as password",
+		Sender:     SenderVerified,
+	},
+	{
+		Name:       "Postmark",
+		Hosts:      regexp.MustCompile(`^smtp(-broadcasts)?\.postmarkapp\.com$`),
+		Ports:      map[int]ConnectionSecurity{25: SecuritySTARTTLS, 587: SecuritySTARTTLS, 2525: SecuritySTARTTLS},
+		Auth:       []AuthMechanism{AuthPlain, AuthLogin, AuthCRAMMD5},
+		User:       uuidRe,
+		UserFormat: "the Server API token, also used as password",
+		Sender:     SenderVerified,
+	},
+}
+
+// ProviderForHost returns the profile of the provider of a SMTP host
+func ProviderForHost(host string) (*Provider, bool) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for i := range Providers {
+		if Providers[i].Hosts.MatchString(host) {
+			return &Providers[i], true
+		}
+	}
+	return nil, false
+}
+
+// region returns the region of a SMTP host of the provider, if any
+func (p *Provider) region(host string) string {
+	i := p.Hosts.SubexpIndex("region")
+	if i < 0 {
+		return ""
+	}
+	matches := p.Hosts.FindStringSubmatch(strings.TrimSuffix(strings.ToLower(host), "."))
+	if matches == nil {
+		return ""
+	}
+	return matches[i]
+}
+
+// supportedPorts describes the ports of the provider and their connection security
+func (p *Provider) supportedPorts() string {
+	ports := make([]int, 0, len(p.Ports))
+	for port := range p.Ports {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	descriptions := make([]string, len(ports))
+	for i, port := range ports {
+		descriptions[i] = fmt.Sprintf("%d (%s)", port, p.Ports[port])
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// Validate checks the settings against the profile of the provider: the region, the port and its
+// connection security, the authentication mechanism and the user name format
+func (p *Provider) Validate(settings *SMTPSettings) error {
+	var errs error
+	if region := p.region(settings.Host); region != "" && !slices.Contains(p.Regions, region) {
+		errs = multierror.Append(errs, errors.Errorf("%s is not available in region %q", p.Name, region))
+	}
+	security, ok := p.Ports[settings.Port]
+	switch {
+	case !ok:
+		errs = multierror.Append(errs, errors.Errorf("%s does not accept connections on port %d, use %s", p.Name, settings.Port, p.supportedPorts()))
+	// An empty connection security uses STARTTLS when the server offers it
+	case settings.Security != security && !(settings.Security == "" && security == SecuritySTARTTLS):
+		errs = multierror.Append(errs, errors.Errorf("%s requires %s connection security on port %d, got %q", p.Name, security, settings.Port, settings.Security))
+	}
+	if settings.Auth == AuthNone {
+		errs = multierror.Append(errs, errors.Errorf("%s requires authentication", p.Name))
+	} else if settings.Auth != "" && !slices.Contains(p.Auth, settings.Auth) {
+		errs = multierror.Append(errs, errors.Errorf("%s does not support %s authentication, use %s", p.Name, settings.Auth, joinAuth(p.Auth)))
+	}
+	if !p.User.MatchString(settings.User) {
+		errs = multierror.Append(errs, errors.Errorf("invalid %s user %q, it must be %s", p.Name, settings.User, p.UserFormat))
+	}
+	return errs
+}
+
+// SenderWarning explains why the provider may reject or rewrite mails from the sender. It returns
+// an empty string when the sender is fine
+func (p *Provider) SenderWarning(settings *SMTPSettings) string {
+	from, err := settings.FromAddress()
+	if err != nil {
+		return ""
+	}
+	sender := strings.ToLower(from.Address)
+	user := strings.ToLower(settings.User)
+	switch p.Sender {
+	case SenderUser:
+		if _, err := mail.ParseAddress(settings.User); err == nil && sender != user {
+			return fmt.Sprintf("%s rewrites or rejects mails whose sender %q is not the SMTP user or one of its configured aliases", p.Name, from.Address)
+		}
+	case SenderUserDomain:
+		if i, j := strings.LastIndex(sender, "@"), strings.LastIndex(user, "@"); i >= 0 && j >= 0 && sender[i:] != user[j:] {
+			return fmt.Sprintf("%s only accepts senders of the domain of the SMTP user, %q is not", p.Name, from.Address)
+		}
+	case SenderVerified:
+		return fmt.Sprintf("%s only accepts verified senders, make sure %q is verified in the %s console", p.Name, from.Address, p.Name)
+	}
+	return ""
+}
+
+func joinAuth(list []AuthMechanism) string {
+	names := make([]string, len(list))
+	for i, m := range list {
+		names[i] = string(m)
+	}
+	return strings.Join(names, ", ")
+}
@@ -1,81 +1,294 @@
 package redmine
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami/healthcheck-tools/pkg/mysql"
 	"github.com/juju/errors"
 )
 
 const (
-	configFilePath = "apps/redmine/htdocs/config/configuration.yml"
+	configFilePath   = "config/configuration.yml"
+	databaseFileName = "database.yml"
 )
 
-// Config is a structure that matches the schema of
-// Redmine config/configuration.yml file
+func init() {
+	apps.Register(apps.Application{
+		Name:       "redmine",
+		Layouts:    apps.BitnamiLayouts("redmine"),
+		EnvPrefix:  "REDMINE",
+		ConfigFile: configFilePath,
+		Load:       ParseConfig,
+	})
+}
+
+// Default settings of ActionMailer
+const (
+	defaultEnvironment      = "production"
+	defaultPort             = 25
+	defaultSendmailLocation = "/usr/sbin/sendmail"
+	defaultSendmailArgs     = "-i"
+)
+
+// Config is a structure that contains the email
+// configuration data of Redmine for an environment
 type Config struct {
-	Default mode `json:"default"`
+	// Environment is the Rails environment whose configuration is used
+	Environment   string
+	EmailDelivery emailDelivery
+	// MailFrom is the emission email address, stored in the database
+	MailFrom string
+}
+
+// configSections is a structure that matches the schema of
+// Redmine config/configuration.yml file, with a section by environment
+type configSections map[string]*mode
+
+// databaseConfig is a structure that matches the schema of
+// Redmine config/database.yml file, with a section by environment
+type databaseConfig map[string]*databaseSettings
+
+type databaseSettings struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Database string `json:"database"`
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
 type mode struct {
-	EmailDelivery emailDelivery `json:"email_delivery"`
+	EmailDelivery *emailDelivery `json:"email_delivery"`
 }
 
 type emailDelivery struct {
-	DeliveryMethod string       `json:"delivery_method"`
-	SMTPSettings   SMTPSettings `json:"smtp_settings"`
+	DeliveryMethod    string           `json:"delivery_method"`
+	SMTPSettings      SMTPSettings     `json:"smtp_settings"`
+	AsyncSMTPSettings *SMTPSettings    `json:"async_smtp_settings"`
+	SendmailSettings  sendmailSettings `json:"sendmail_settings"`
+}
+
+// method returns the delivery method without the symbol prefix, :smtp by default
+func (e emailDelivery) method() string {
+	method := strings.TrimPrefix(strings.TrimSpace(e.DeliveryMethod), ":")
+	if method == "" {
+		return "smtp"
+	}
+	return method
+}
+
+// smtpSettings returns the SMTP settings of the delivery method. The asynchronous methods of old
+// Redmine versions read them from async_smtp_settings
+func (e emailDelivery) smtpSettings() SMTPSettings {
+	if e.method() == "async_smtp" && e.AsyncSMTPSettings != nil {
+		return *e.AsyncSMTPSettings
+	}
+	return e.SMTPSettings
 }
 
 // SMTPSettings is a structure that contains the SMTP
 // configuration data of Redmine
 type SMTPSettings struct {
-	Address        string `json:"address"`
-	Port           int    `json:"port"`
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	// Domain is the HELO domain, not the SMTP server
+	Domain         string `json:"domain"`
 	Username       string `json:"user_name"`
 	Password       string `json:"password"`
-	Domain         string `json:"domain"`
 	Authentication string `json:"authentication"`
-	AutoStartTLS   bool   `json:"enable_starttls_auto"`
+	// AutoStartTLS is enabled by default, so STARTTLS is used if the server offers it
+	AutoStartTLS      *bool  `json:"enable_starttls_auto"`
+	StartTLS          bool   `json:"enable_starttls"`
+	TLS               bool   `json:"tls"`
+	SSL               bool   `json:"ssl"`
+	OpenSSLVerifyMode string `json:"openssl_verify_mode"`
+}
+
+type sendmailSettings struct {
+	Location  string `json:"location"`
+	Arguments string `json:"arguments"`
+}
+
+// connectionSecurity maps the TLS settings of ActionMailer to a connection security mode
+func (s SMTPSettings) connectionSecurity() apps.ConnectionSecurity {
+	switch {
+	case s.SSL || s.TLS:
+		return apps.SecurityImplicitTLS
+	case s.StartTLS:
+		return apps.SecuritySTARTTLS
+	case s.AutoStartTLS != nil && !*s.AutoStartTLS:
+		return apps.SecurityNone
+	}
+	return ""
 }
 
 // GetSMTPSettings returns a SMTPSettings from Config structure
 func (c Config) GetSMTPSettings() *apps.SMTPSettings {
-	return &apps.SMTPSettings{
-		Host: c.Default.EmailDelivery.SMTPSettings.Domain,
-		Port: c.Default.EmailDelivery.SMTPSettings.Port,
-		User: c.Default.EmailDelivery.SMTPSettings.Username,
-		Pass: c.Default.EmailDelivery.SMTPSettings.Password,
+	smtp := c.EmailDelivery.smtpSettings()
+	settings := &apps.SMTPSettings{
+		Host:     smtp.Address,
+		Port:     smtp.Port,
+		User:     smtp.Username,
+		Pass:     smtp.Password,
+		Security: smtp.connectionSecurity(),
+		Auth:     smtp.authMechanism(),
+		From:     c.MailFrom,
+	}
+	if settings.Port == 0 {
+		settings.Port = defaultPort
+	}
+	// ActionMailer only authenticates when the user is set
+	if smtp.Username == "" {
+		settings.Auth = apps.AuthNone
+	}
+	return settings
+}
+
+// Mailer returns the way Redmine sends the mails, based on the delivery method
+func (c Config) Mailer() apps.Mailer {
+	switch c.EmailDelivery.method() {
+	case "sendmail", "async_sendmail":
+		return apps.MailerSendmail
 	}
+	return apps.MailerSMTP
 }
 
-// ValidateSMTPSettings checks the SMTPSettings are correct
+// SendmailCommand returns the sendmail command run by the sendmail delivery method
+func (c Config) SendmailCommand() string {
+	location, arguments := c.EmailDelivery.SendmailSettings.Location, c.EmailDelivery.SendmailSettings.Arguments
+	if location == "" {
+		location = defaultSendmailLocation
+	}
+	if arguments == "" {
+		arguments = defaultSendmailArgs
+	}
+	return location + " " + arguments
+}
+
+// authMechanism converts the authentication setting (:plain, :login, :cram_md5...) to a SASL mechanism.
+// When it is not set, the mechanism is negotiated with the server
+func (s SMTPSettings) authMechanism() apps.AuthMechanism {
+	authentication := strings.TrimPrefix(strings.TrimSpace(s.Authentication), ":")
+	if authentication == "" {
+		return ""
+	}
+	return apps.AuthMechanism(strings.ToUpper(strings.Replace(authentication, "_", "-", -1)))
+}
+
+// ValidateSMTPSettings checks the settings of the delivery method are correct
 func (c *Config) ValidateSMTPSettings() error {
-	if c.Default.EmailDelivery.SMTPSettings.Address == "" {
+	switch method := c.EmailDelivery.method(); method {
+	case "sendmail", "async_sendmail":
+		return nil
+	case "smtp", "async_smtp":
+	default:
+		return errors.Errorf("delivery_method: %q does not send mails, use :smtp or :sendmail", method)
+	}
+	smtp := c.EmailDelivery.smtpSettings()
+	if smtp.Address == "" {
 		return errors.New("address: empty string")
 	}
-	if c.Default.EmailDelivery.SMTPSettings.Domain == "" {
-		return errors.New("domain: empty string")
+	if smtp.Authentication != "" {
+		var mechanism apps.AuthMechanism
+		if err := mechanism.Set(string(smtp.authMechanism())); err != nil {
+			return errors.Errorf("authentication: %v", err)
+		}
+		if smtp.Username == "" {
+			return errors.New("user_name: empty string")
+		}
+		if smtp.Password == "" {
+			return errors.New("password: empty string")
+		}
+	}
+	if (smtp.SSL || smtp.TLS) && smtp.StartTLS {
+		return errors.New("enable_starttls can not be used with ssl or tls, which use implicit TLS")
+	}
+	switch strings.ToLower(strings.TrimPrefix(smtp.OpenSSLVerifyMode, ":")) {
+	case "", "none", "peer", "client_once", "fail_if_no_peer_cert":
+	default:
+		return errors.Errorf("openssl_verify_mode: invalid mode %q (use none or peer)", smtp.OpenSSLVerifyMode)
+	}
+	return nil
+}
+
+// parseConfig reads the email delivery configuration of an environment, which replaces the
+// default one as Redmine merges the environment section over the default section
+func parseConfig(configFile string, environment string) (*Config, error) {
+	sections := configSections{}
+	if err := apps.UnmarshalYAMLFile(configFile, &sections); err != nil {
+		return nil, err
+	}
+	config := &Config{Environment: environment}
+	for _, name := range []string{"default", environment} {
+		if section := sections[name]; section != nil && section.EmailDelivery != nil {
+			config.EmailDelivery = *section.EmailDelivery
+		}
 	}
-	if c.Default.EmailDelivery.SMTPSettings.Port == 0 {
-		return errors.New("port: invalid port")
+	return config, nil
+}
+
+// parseDatabaseConfig reads the database settings of an environment
+func parseDatabaseConfig(configFile string, environment string) (mysql.Database, error) {
+	config := databaseConfig{}
+	if err := apps.UnmarshalYAMLFile(configFile, &config); err != nil {
+		return mysql.Database{}, err
 	}
-	if c.Default.EmailDelivery.SMTPSettings.Username == "" {
-		return errors.New("user_name: empty string")
+	settings := config[environment]
+	if settings == nil {
+		return mysql.Database{}, errors.Errorf("the %q environment is not defined in %s", environment, configFile)
 	}
-	if c.Default.EmailDelivery.SMTPSettings.Password == "" {
-		return errors.New("password: empty string")
+	database := mysql.Database{
+		Host: settings.Host,
+		Port: settings.Port,
+		Name: settings.Database,
+		User: settings.Username,
+		Pass: settings.Password,
 	}
-	if c.Default.EmailDelivery.SMTPSettings.Domain != c.Default.EmailDelivery.SMTPSettings.Address {
-		return errors.Errorf("address %s does not match domain %s on smtp_settings", c.Default.EmailDelivery.SMTPSettings.Address, c.Default.EmailDelivery.SMTPSettings.Domain)
+	if database.Host == "" {
+		database.Host = "localhost"
 	}
-	if c.Default.EmailDelivery.SMTPSettings.Domain == "smtp.gmail.com" && !c.Default.EmailDelivery.SMTPSettings.AutoStartTLS {
-		return errors.New("use enable_starttls_auto when using smtp.gmail.com as domain")
+	if database.Port == 0 {
+		database.Port = 3306
 	}
-	return nil
+	return database, nil
 }
 
-// ParseConfig obtains an ApplicationConfig from by parsing a config file
-func ParseConfig(installDir string) (apps.ApplicationConfig, error) {
-	config := Config{}
-	return &config, apps.UnmarshalYAMLFile(filepath.Join(installDir, configFilePath), &config)
+// obtainMailFromDatabase obtains the emission email address set in the Redmine administration
+func obtainMailFromDatabase(database mysql.Database) (string, error) {
+	query := mysql.Query{
+		Table:  "settings",
+		Column: "value",
+		Key:    "name",
+		Value:  "mail_from",
+	}
+	return database.MySQLQuery(query)
+}
+
+// ParseConfig obtains an ApplicationConfig from by parsing a config file. The environment is
+// read from RAILS_ENV, and the database configuration from the database.yml file next to it
+func ParseConfig(configFile string) (apps.ApplicationConfig, error) {
+	environment := os.Getenv("RAILS_ENV")
+	if environment == "" {
+		environment = defaultEnvironment
+	}
+	config, err := parseConfig(configFile, environment)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Using the email_delivery settings of the %q environment, delivery method: %s\n", environment, config.EmailDelivery.method())
+	if strings.EqualFold(strings.TrimPrefix(config.EmailDelivery.smtpSettings().OpenSSLVerifyMode, ":"), "none") {
+		fmt.Println("Warning: openssl_verify_mode is none, Redmine does not verify the SMTP server certificate but the checks do")
+	}
+	// The emission email address is optional, Redmine uses a default one when it is not set
+	database, err := parseDatabaseConfig(filepath.Join(filepath.Dir(configFile), databaseFileName), environment)
+	if err == nil {
+		config.MailFrom, err = obtainMailFromDatabase(database)
+	}
+	if err != nil {
+		fmt.Printf("Unable to obtain the emission email address: %v\n", err)
+	}
+	return config, nil
 }
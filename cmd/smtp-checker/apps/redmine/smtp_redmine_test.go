@@ -3,6 +3,8 @@ package redmine
 import (
 	"log"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
@@ -30,10 +32,9 @@ development:
 
 func TestParseConfig(t *testing.T) {
 	t.Run("Check parsed database configuration data", func(t *testing.T) {
-		config := Config{}
 		tmpConfigFile := createTemporaryFile(testRedmineConfig, "configuration.yaml")
 		defer os.Remove(tmpConfigFile.Name())
-		err := apps.UnmarshalYAMLFile(tmpConfigFile.Name(), &config)
+		config, err := parseConfig(tmpConfigFile.Name(), "production")
 		if err != nil {
 			t.Errorf("Error unmarshaling YAML file: %v", err)
 		}
@@ -42,6 +43,124 @@ func TestParseConfig(t *testing.T) {
 			t.Errorf("Error validating SMTP data: %v", err)
 		}
 	})
+	t.Run("Check the environment section replaces the default one", func(t *testing.T) {
+		tmpConfigFile := createTemporaryFile(testRedmineConfig+`
+staging:
+  email_delivery:
+    delivery_method: :async_smtp
+    async_smtp_settings:
+      address: "mail.example.com"
+      port: 465
+      domain: "redmine.example.com"
+      ssl: true
+`, "configuration.yaml")
+		defer os.Remove(tmpConfigFile.Name())
+		config, err := parseConfig(tmpConfigFile.Name(), "staging")
+		if err != nil {
+			t.Fatalf("Error unmarshaling YAML file: %v", err)
+		}
+		expected := &apps.SMTPSettings{Host: "mail.example.com", Port: 465, Security: apps.SecurityImplicitTLS, Auth: apps.AuthNone}
+		if settings := config.GetSMTPSettings(); !reflect.DeepEqual(settings, expected) {
+			t.Errorf("expected %+v, got %+v", expected, settings)
+		}
+	})
+	t.Run("Check the environment is read from RAILS_ENV", func(t *testing.T) {
+		tmpConfigFile := createTemporaryFile(testRedmineConfig+`
+test:
+  email_delivery:
+    delivery_method: :test
+`, "configuration.yaml")
+		defer os.Remove(tmpConfigFile.Name())
+		t.Setenv("RAILS_ENV", "test")
+		config, err := ParseConfig(tmpConfigFile.Name())
+		if err != nil {
+			t.Fatalf("Error parsing config: %v", err)
+		}
+		if err := config.ValidateSMTPSettings(); err == nil || !strings.Contains(err.Error(), "does not send mails") {
+			t.Errorf("expected delivery_method error, got %v", err)
+		}
+	})
+}
+
+func TestGetSMTPSettings(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name     string
+		settings SMTPSettings
+		expected apps.SMTPSettings
+	}{
+		{
+			"address and HELO domain",
+			SMTPSettings{Address: "smtp.gmail.com", Port: 587, Domain: "example.com", Username: "user@gmail.com", Password: "XXXXXXXX", Authentication: ":login", AutoStartTLS: &enabled},
+			apps.SMTPSettings{Host: "smtp.gmail.com", Port: 587, User: "user@gmail.com", Pass: "XXXXXXXX", Auth: apps.AuthLogin},
+		},
+		{
+			"default port without STARTTLS",
+			SMTPSettings{Address: "localhost", AutoStartTLS: &disabled},
+			apps.SMTPSettings{Host: "localhost", Port: 25, Security: apps.SecurityNone, Auth: apps.AuthNone},
+		},
+		{
+			"required STARTTLS",
+			SMTPSettings{Address: "smtp.example.com", Port: 587, StartTLS: true, Username: "user"},
+			apps.SMTPSettings{Host: "smtp.example.com", Port: 587, User: "user", Security: apps.SecuritySTARTTLS},
+		},
+		{
+			"implicit TLS",
+			SMTPSettings{Address: "smtp.example.com", Port: 465, TLS: true, Username: "user"},
+			apps.SMTPSettings{Host: "smtp.example.com", Port: 465, User: "user", Security: apps.SecurityImplicitTLS},
+		},
+	}
+	for _, test := range tests {
+		t.Run("Check "+test.name, func(t *testing.T) {
+			config := Config{EmailDelivery: emailDelivery{SMTPSettings: test.settings}}
+			if settings := config.GetSMTPSettings(); !reflect.DeepEqual(*settings, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, *settings)
+			}
+		})
+	}
+}
+
+func TestValidateSMTPSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		delivery emailDelivery
+		err      string
+	}{
+		{"SMTP without authentication", emailDelivery{SMTPSettings: SMTPSettings{Address: "localhost"}}, ""},
+		{"SMTP without address", emailDelivery{DeliveryMethod: ":smtp"}, "address: empty string"},
+		{"authentication without user", emailDelivery{SMTPSettings: SMTPSettings{Address: "localhost", Authentication: ":plain"}}, "user_name: empty string"},
+		{"invalid authentication", emailDelivery{SMTPSettings: SMTPSettings{Address: "localhost", Authentication: ":ntlm"}}, "authentication:"},
+		{"SSL and STARTTLS", emailDelivery{SMTPSettings: SMTPSettings{Address: "localhost", SSL: true, StartTLS: true}}, "enable_starttls can not be used"},
+		{"invalid verify mode", emailDelivery{SMTPSettings: SMTPSettings{Address: "localhost", OpenSSLVerifyMode: "always"}}, "openssl_verify_mode"},
+		{"sendmail", emailDelivery{DeliveryMethod: ":sendmail"}, ""},
+		{"file", emailDelivery{DeliveryMethod: ":file"}, "does not send mails"},
+	}
+	for _, test := range tests {
+		t.Run("Check "+test.name, func(t *testing.T) {
+			config := Config{EmailDelivery: test.delivery}
+			err := config.ValidateSMTPSettings()
+			if test.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestSendmail(t *testing.T) {
+	config := Config{EmailDelivery: emailDelivery{DeliveryMethod: ":sendmail"}}
+	if config.Mailer() != apps.MailerSendmail {
+		t.Errorf("expected sendmail mailer, got %q", config.Mailer())
+	}
+	if command := config.SendmailCommand(); command != "/usr/sbin/sendmail -i" {
+		t.Errorf("unexpected sendmail command %q", command)
+	}
+	config.EmailDelivery.SendmailSettings = sendmailSettings{Location: "/usr/bin/msmtp", Arguments: "-t"}
+	if command := config.SendmailCommand(); command != "/usr/bin/msmtp -t" {
+		t.Errorf("unexpected sendmail command %q", command)
+	}
 }
 
 func createTemporaryFile(content, prefix string) *os.File {
@@ -54,3 +173,65 @@ func createTemporaryFile(content, prefix string) *os.File {
 	}
 	return tmpFile
 }
+
+func TestAuthMechanism(t *testing.T) {
+	tests := map[string]apps.AuthMechanism{
+		":plain":    apps.AuthPlain,
+		"login":     apps.AuthLogin,
+		":cram_md5": apps.AuthCRAMMD5,
+		"":          "",
+	}
+	for authentication, expected := range tests {
+		t.Run("Check authentication "+authentication, func(t *testing.T) {
+			settings := SMTPSettings{Authentication: authentication}
+			if mechanism := settings.authMechanism(); mechanism != expected {
+				t.Errorf("expected %q, got %q", expected, mechanism)
+			}
+		})
+	}
+}
+
+var testDatabaseConfig = `
+production:
+  adapter: mysql2
+  database: bitnami_redmine
+  username: bitnami
+  password: "XXXXXXXX"
+  encoding: utf8
+development:
+  adapter: mysql2
+  host: db.example.com
+  port: 3307
+  database: redmine_development
+  username: developer
+  password: "YYYYYYYY"
+`
+
+func TestParseDatabaseConfig(t *testing.T) {
+	tmpConfigFile := createTemporaryFile(testDatabaseConfig, "database.yml")
+	defer os.Remove(tmpConfigFile.Name())
+	t.Run("Check parsed database configuration data", func(t *testing.T) {
+		database, err := parseDatabaseConfig(tmpConfigFile.Name(), "production")
+		if err != nil {
+			t.Fatalf("Error parsing database.yml file: %v", err)
+		}
+		if database.Host != "localhost" || database.Port != 3306 || database.Name != "bitnami_redmine" || database.User != "bitnami" || database.Pass != "XXXXXXXX" {
+			t.Errorf("Incorrect database configuration: %+v", database)
+		}
+	})
+	t.Run("Check the database configuration of the environment is used", func(t *testing.T) {
+		database, err := parseDatabaseConfig(tmpConfigFile.Name(), "development")
+		if err != nil {
+			t.Fatalf("Error parsing database.yml file: %v", err)
+		}
+		if database.Host != "db.example.com" || database.Port != 3307 || database.Name != "redmine_development" || database.User != "developer" || database.Pass != "YYYYYYYY" {
+			t.Errorf("Incorrect database configuration: %+v", database)
+		}
+	})
+	t.Run("Check missing environment", func(t *testing.T) {
+		_, err := parseDatabaseConfig(tmpConfigFile.Name(), "test")
+		if err == nil || !strings.Contains(err.Error(), `the "test" environment is not defined`) {
+			t.Errorf("expected missing environment error, got %v", err)
+		}
+	})
+}
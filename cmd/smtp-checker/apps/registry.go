@@ -0,0 +1,118 @@
+package apps
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Layout is a known location of an application installation
+type Layout struct {
+	// Name describes the layout, e.g. "Bitnami container"
+	Name string
+	// Dir is the directory of the application. When it is relative, it is relative to the
+	// installation directory
+	Dir string
+}
+
+// BitnamiLayouts returns the layouts of a Bitnami application: the legacy stacks (apps/<name>/htdocs),
+// the current ones (<name> in the installation directory) and the persisted data of the containers
+func BitnamiLayouts(name string) []Layout {
+	return []Layout{
+		{Name: "Bitnami stack", Dir: name},
+		{Name: "legacy Bitnami stack", Dir: filepath.Join("apps", name, "htdocs")},
+		{Name: "Bitnami container", Dir: filepath.Join("/bitnami", name)},
+	}
+}
+
+// Application is a structure that contains the info
+// about each supported application and its configuration file.
+type Application struct {
+	Name    string
+	Aliases []string
+	// Layouts are the known locations of the application, in order of preference
+	Layouts []Layout
+	// ConfigFile is the path of the configuration file relative to the application directory,
+	// used to detect the layout
+	ConfigFile string
+	// EnvPrefix is the prefix of the environment variables of the Bitnami container, e.g. WORDPRESS
+	EnvPrefix string
+	// Load obtains the configuration of the application from its configuration file
+	Load func(configFile string) (ApplicationConfig, error)
+}
+
+// Find searches the configuration file of the application in its known layouts, returning its
+// path and the layout found
+func (a *Application) Find(installDir string) (string, Layout, bool) {
+	for _, layout := range a.Layouts {
+		dir := layout.Dir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(installDir, dir)
+		}
+		configFile := filepath.Join(dir, a.ConfigFile)
+		if info, err := os.Stat(configFile); err == nil && info.Mode().IsRegular() {
+			return configFile, layout, true
+		}
+	}
+	return "", Layout{}, false
+}
+
+// Installed reports whether the application is installed in a directory
+func (a *Application) Installed(installDir string) bool {
+	_, _, ok := a.Find(installDir)
+	return ok
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]*Application{}
+)
+
+// Register makes an application available by its name and aliases. It is meant to be called from
+// the init function of the application package, and panics if a name is already registered
+func Register(app Application) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, name := range append([]string{app.Name}, app.Aliases...) {
+		name = strings.ToLower(name)
+		if _, ok := registry[name]; ok {
+			panic("apps: application " + name + " registered twice")
+		}
+		registry[name] = &app
+	}
+}
+
+// Lookup returns the application registered with a name or alias
+func Lookup(name string) (*Application, bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	app, ok := registry[strings.ToLower(name)]
+	return app, ok
+}
+
+// Applications returns the registered applications sorted by name
+func Applications() []*Application {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	var res []*Application
+	for name, app := range registry {
+		if name == strings.ToLower(app.Name) {
+			res = append(res, app)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// Detect returns the registered applications installed in a directory
+func Detect(installDir string) []*Application {
+	var res []*Application
+	for _, app := range Applications() {
+		if app.Installed(installDir) {
+			res = append(res, app)
+		}
+	}
+	return res
+}
@@ -0,0 +1,123 @@
+package apps
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withRegistry replaces the registered applications until the test finishes
+func withRegistry(t *testing.T, applications ...Application) {
+	previous := registry
+	registry = map[string]*Application{}
+	t.Cleanup(func() { registry = previous })
+	for _, app := range applications {
+		Register(app)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	withRegistry(t, Application{Name: "wordpress", Aliases: []string{"wp"}}, Application{Name: "redmine"})
+	tests := map[string]string{
+		"wordpress": "wordpress",
+		"WP":        "wordpress",
+		"redmine":   "redmine",
+		"drupal":    "",
+	}
+	for name, expected := range tests {
+		t.Run("Check lookup of "+name, func(t *testing.T) {
+			app, ok := Lookup(name)
+			if expected == "" {
+				if ok {
+					t.Errorf("unexpected application %q", app.Name)
+				}
+				return
+			}
+			if !ok || app.Name != expected {
+				t.Errorf("expected application %q, got %+v", expected, app)
+			}
+		})
+	}
+	t.Run("Check applications are listed once sorted by name", func(t *testing.T) {
+		applications := Applications()
+		if len(applications) != 2 || applications[0].Name != "redmine" || applications[1].Name != "wordpress" {
+			t.Errorf("unexpected applications: %+v", applications)
+		}
+	})
+	t.Run("Check registering a name twice panics", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected panic registering an alias twice")
+			}
+		}()
+		Register(Application{Name: "wordpress-multisite", Aliases: []string{"wp"}})
+	})
+}
+
+// createFile creates an empty file and its parent directories
+func createFile(t *testing.T, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	withRegistry(t,
+		Application{Name: "wordpress", Layouts: BitnamiLayouts("wordpress"), ConfigFile: "wp-config.php"},
+		Application{Name: "redmine", Layouts: BitnamiLayouts("redmine"), ConfigFile: "config/configuration.yml"},
+	)
+	installDir := t.TempDir()
+	if detected := Detect(installDir); len(detected) != 0 {
+		t.Errorf("expected no application, got %+v", detected)
+	}
+	createFile(t, filepath.Join(installDir, "apps/wordpress/htdocs/wp-config.php"))
+	if detected := Detect(installDir); len(detected) != 1 || detected[0].Name != "wordpress" {
+		t.Errorf("expected wordpress, got %+v", detected)
+	}
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		files  []string
+		layout string
+	}{
+		{[]string{"opt/bitnami/apps/redmine/htdocs/config/configuration.yml"}, "legacy Bitnami stack"},
+		{[]string{"opt/bitnami/redmine/config/configuration.yml", "opt/bitnami/apps/redmine/htdocs/config/configuration.yml"}, "Bitnami stack"},
+		{[]string{"bitnami/redmine/config/configuration.yml"}, "Bitnami container"},
+		{[]string{"opt/bitnami/redmine/configuration.yml"}, ""},
+	}
+	for _, test := range tests {
+		t.Run("Find layout of "+strings.Join(test.files, ", "), func(t *testing.T) {
+			root := t.TempDir()
+			app := Application{
+				Name: "redmine",
+				Layouts: []Layout{
+					{Name: "Bitnami stack", Dir: "redmine"},
+					{Name: "legacy Bitnami stack", Dir: "apps/redmine/htdocs"},
+					{Name: "Bitnami container", Dir: filepath.Join(root, "bitnami/redmine")},
+				},
+				ConfigFile: "config/configuration.yml",
+			}
+			for _, file := range test.files {
+				createFile(t, filepath.Join(root, file))
+			}
+			configFile, layout, ok := app.Find(filepath.Join(root, "opt/bitnami"))
+			if test.layout == "" {
+				if ok {
+					t.Errorf("unexpected layout %q found", layout.Name)
+				}
+				return
+			}
+			if !ok || layout.Name != test.layout {
+				t.Fatalf("expected layout %q, got %q", test.layout, layout.Name)
+			}
+			if expected := filepath.Join(root, test.files[0]); configFile != expected {
+				t.Errorf("expected configuration file %q, got %q", expected, configFile)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package wordpress
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps/php"
+	"github.com/bitnami/healthcheck-tools/pkg/mysql"
+	"github.com/juju/errors"
+)
+
+// baseSiteID is the ID of the site whose tables have no site prefix, which is the main site of the
+// network unless BLOG_ID_CURRENT_SITE sets another one
+const baseSiteID = 1
+
+// site is a site of a multisite network
+type site struct {
+	ID  int
+	URL string
+}
+
+// multisite reports whether wp-config.php enables a multisite network
+func (c *wpConfig) multisite() bool {
+	value, _ := c.constant("MULTISITE")
+	return php.Bool(value)
+}
+
+// mainSiteID returns the ID of the main site of the network, set with BLOG_ID_CURRENT_SITE
+func (c *wpConfig) mainSiteID() int {
+	value, _ := c.constant("BLOG_ID_CURRENT_SITE")
+	if id, err := strconv.Atoi(value); err == nil && id > 0 {
+		return id
+	}
+	return baseSiteID
+}
+
+// site returns the configuration of a site of the network, whose tables use the prefix of the
+// network followed by the site ID, e.g. wp_2_options. As in WordPress, only the tables of the site 1
+// have no site prefix, even if another site is the main one
+func (c *wpConfig) site(id int) *wpConfig {
+	res := *c
+	if id != baseSiteID {
+		res.TablePrefix = fmt.Sprintf("%s%d_", c.TablePrefix, id)
+	}
+	return &res
+}
+
+// querySiteMeta returns the value of a network-wide option
+var querySiteMeta = func(wp *wpConfig, name string) (string, error) {
+	query := mysql.Query{
+		Table:  wp.table("sitemeta"),
+		Column: "meta_value",
+		Key:    "meta_key",
+		Value:  name,
+	}
+	return wp.Database.MySQLQuery(query)
+}
+
+// querySites returns the sites of the network, skipping the deleted, archived and spam ones
+var querySites = func(wp *wpConfig) ([]site, error) {
+	rows, err := wp.Database.MySQLQueryRows(mysql.RowsQuery{
+		Table:   wp.table("blogs"),
+		Columns: []string{"blog_id", "domain", "path", "deleted", "archived", "spam"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res []site
+	for _, row := range rows {
+		if slices.Contains(row[3:], "1") {
+			continue
+		}
+		id, err := strconv.Atoi(row[0])
+		if err != nil {
+			return nil, errors.Errorf("invalid site ID %q", row[0])
+		}
+		res = append(res, site{ID: id, URL: row[1] + row[2]})
+	}
+	return res, nil
+}
+
+// networkConfig contains the network-wide mail settings of a multisite network
+type networkConfig struct {
+	// main is the configuration of the network, whose sitemeta table has the network-wide options
+	main *wpConfig
+	// plugins are the network-activated mail plugins, active on every site
+	plugins []*mailPlugin
+	// wpMailSMTPGlobal reports whether WP Mail SMTP uses the settings of the main site on every site
+	wpMailSMTPGlobal bool
+}
+
+// activePlugins returns the mail plugins active on a site, the network-activated ones first as
+// WordPress loads them first. Without network, the site plugins are returned
+func (n *networkConfig) activePlugins(sitePlugins []*mailPlugin) []*mailPlugin {
+	if n == nil {
+		return sitePlugins
+	}
+	res := slices.Clone(n.plugins)
+	for _, plugin := range sitePlugins {
+		if !slices.Contains(res, plugin) {
+			res = append(res, plugin)
+		}
+	}
+	return res
+}
+
+// option returns the value of the option of a plugin on a site, which is the network-wide one
+// when the plugin is network-activated and has network-wide settings
+func (n *networkConfig) option(wp *wpConfig, plugin *mailPlugin) (string, error) {
+	if n != nil && plugin.Option == "wp_mail_smtp" && n.wpMailSMTPGlobal {
+		return queryOption(n.main.site(n.main.mainSiteID()), plugin.Option)
+	}
+	if n != nil && slices.Contains(n.plugins, plugin) {
+		value, err := querySiteMeta(n.main, plugin.Option)
+		if err == nil {
+			return value, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+	}
+	return queryOption(wp, plugin.Option)
+}
+
+// queryNetwork reads the network-activated mail plugins and the network-wide settings
+func queryNetwork(wp *wpConfig) (*networkConfig, error) {
+	network := &networkConfig{main: wp}
+	value, err := querySiteMeta(wp, "active_sitewide_plugins")
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Errorf("error checking the network-activated plugins: %v", err)
+	}
+	if err == nil {
+		// The network-activated plugins are the keys, with the activation time as value
+		plugins, err := decodeOption(value)
+		if err != nil {
+			return nil, err
+		}
+		files := []string{}
+		for k := range plugins {
+			if file, ok := k.(string); ok {
+				files = append(files, file)
+			}
+		}
+		slices.Sort(files)
+		for _, file := range files {
+			if plugin := mailPluginForFile(file); plugin != nil {
+				network.plugins = append(network.plugins, plugin)
+			}
+		}
+	}
+	if value, err := querySiteMeta(wp, "wp_mail_smtp_multisite"); err == nil {
+		if options, err := decodeOption(value); err == nil {
+			network.wpMailSMTPGlobal = php.ArrayBool(options, "global_options")
+		}
+	}
+	return network, nil
+}
+
+// invalidConfig is the configuration of a site that could not be obtained, whose error is
+// reported when validating it
+type invalidConfig struct {
+	err error
+}
+
+func (c invalidConfig) GetSMTPSettings() *apps.SMTPSettings {
+	return &apps.SMTPSettings{}
+}
+
+func (c invalidConfig) ValidateSMTPSettings() error {
+	return c.err
+}
+
+// NetworkConfig is the configuration of the sites of a multisite network. As an ApplicationConfig,
+// it is the configuration of the main site
+type NetworkConfig struct {
+	sites []apps.SiteConfig
+}
+
+// GetSMTPSettings returns the SMTPSettings of the main site
+func (c *NetworkConfig) GetSMTPSettings() *apps.SMTPSettings {
+	return c.sites[0].Config.GetSMTPSettings()
+}
+
+// ValidateSMTPSettings checks the SMTPSettings of the main site are correct
+func (c *NetworkConfig) ValidateSMTPSettings() error {
+	return c.sites[0].Config.ValidateSMTPSettings()
+}
+
+// SiteConfigs returns the distinct configurations of the sites
+func (c *NetworkConfig) SiteConfigs() []apps.SiteConfig {
+	return c.sites
+}
+
+// siteError returns the error of the configuration of a site. The SMTP settings are not used
+// when the mails are sent with a local mailer or an API
+func siteError(config apps.ApplicationConfig) error {
+	if c, ok := config.(*Config); ok && (c.Mailer().Local() || c.API != nil) {
+		return nil
+	}
+	return config.ValidateSMTPSettings()
+}
+
+// configKey identifies the configurations that are checked the same way
+type configKey struct {
+	settings apps.SMTPSettings
+	mailer   apps.Mailer
+	api      string
+	err      string
+}
+
+func newConfigKey(config apps.ApplicationConfig) configKey {
+	key := configKey{settings: *config.GetSMTPSettings()}
+	if err := siteError(config); err != nil {
+		key.err = err.Error()
+	}
+	if c, ok := config.(*Config); ok {
+		key.mailer = c.Mailer()
+		if c.API != nil {
+			key.api = c.API.Method + " " + c.API.URL + " " + c.API.Body
+		}
+	}
+	return key
+}
+
+// groupSites groups the sites with the same configuration, keeping the order of the sites
+func groupSites(sites []site, configs []apps.ApplicationConfig) []apps.SiteConfig {
+	var res []apps.SiteConfig
+	index := map[configKey]int{}
+	for i, config := range configs {
+		key := newConfigKey(config)
+		j, ok := index[key]
+		if !ok {
+			j = len(res)
+			index[key] = j
+			res = append(res, apps.SiteConfig{Config: config})
+		}
+		res[j].Sites = append(res[j].Sites, sites[i].URL)
+	}
+	return res
+}
+
+// printSites prints the effective mail settings of each site
+func printSites(sites []site, configs []apps.ApplicationConfig) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SITE\tPLUGIN\tMAILER\tHOST\tUSER\tSENDER\tERRORS")
+	for i, config := range configs {
+		settings := config.GetSMTPSettings()
+		plugin, mailer, validation := "-", "-", "-"
+		if c, ok := config.(*Config); ok {
+			plugin, mailer = c.Plugin, string(c.Mailer())
+			if c.Plugin == "" {
+				plugin = "none"
+			}
+			if c.API != nil {
+				mailer = c.API.Provider + " API"
+			}
+		}
+		if err := siteError(config); err != nil {
+			validation = err.Error()
+		}
+		host := "-"
+		if settings.Host != "" {
+			host = fmt.Sprintf("%s:%d", settings.Host, settings.Port)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%q\t%q\t%s\n", sites[i].URL, plugin, mailer, host, settings.User, settings.From, validation)
+	}
+	w.Flush()
+}
+
+// queryNetworkConfig obtains the configuration of every site of a multisite network
+func queryNetworkConfig(wp *wpConfig) (*NetworkConfig, error) {
+	network, err := queryNetwork(wp)
+	if err != nil {
+		return nil, err
+	}
+	sites, err := querySites(wp)
+	if err != nil {
+		return nil, errors.Errorf("error obtaining the sites of the network: %v", err)
+	}
+	if len(sites) == 0 {
+		return nil, errors.New("no active site found in the network")
+	}
+	// The rows are not ordered, the main site goes first as its configuration is the one of the network
+	mainID := wp.mainSiteID()
+	slices.SortFunc(sites, func(a, b site) int {
+		if (a.ID == mainID) != (b.ID == mainID) {
+			if a.ID == mainID {
+				return -1
+			}
+			return 1
+		}
+		return a.ID - b.ID
+	})
+	fmt.Printf("Multisite network with %d active sites\n", len(sites))
+	configs := make([]apps.ApplicationConfig, len(sites))
+	for i, s := range sites {
+		fmt.Printf("Site %s:\n", s.URL)
+		// The errors of a site are reported with its checks, without stopping the other ones
+		config, err := obtainConfig(wp.site(s.ID), network)
+		if err != nil {
+			configs[i] = invalidConfig{err: err}
+			continue
+		}
+		configs[i] = config
+	}
+	printSites(sites, configs)
+	grouped := groupSites(sites, configs)
+	fmt.Printf("%d distinct mail configurations found\n", len(grouped))
+	return &NetworkConfig{sites: grouped}, nil
+}
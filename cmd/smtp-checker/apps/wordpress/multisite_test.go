@@ -0,0 +1,227 @@
+package wordpress
+
+import (
+	"database/sql"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/yvasiyarov/php_session_decoder/php_serialize"
+)
+
+// testNetwork is the content of the database of a multisite network: the options by table and
+// the network-wide options
+type testNetwork struct {
+	options  map[string]map[string]string
+	siteMeta map[string]string
+	sites    []site
+}
+
+func withNetwork(t *testing.T, network testNetwork) {
+	t.Helper()
+	originalOption, originalSiteMeta, originalSites := queryOption, querySiteMeta, querySites
+	queryOption = func(wp *wpConfig, name string) (string, error) {
+		value, ok := network.options[wp.table("options")][name]
+		if !ok {
+			return "", errors.Trace(sql.ErrNoRows)
+		}
+		return value, nil
+	}
+	querySiteMeta = func(wp *wpConfig, name string) (string, error) {
+		value, ok := network.siteMeta[name]
+		if !ok {
+			return "", errors.Trace(sql.ErrNoRows)
+		}
+		return value, nil
+	}
+	querySites = func(wp *wpConfig) ([]site, error) {
+		return network.sites, nil
+	}
+	t.Cleanup(func() {
+		queryOption, querySiteMeta, querySites = originalOption, originalSiteMeta, originalSites
+	})
+}
+
+func smtpOption(t *testing.T, host string) string {
+	return serialize(t, php_serialize.PhpArray{
+		"mail": php_serialize.PhpArray{"from_email": "blog@example.com", "from_name": "Blog", "mailer": "smtp"},
+		"smtp": php_serialize.PhpArray{"host": host, "port": 587, "encryption": "tls", "auth": true, "user": "user", "pass": "XXXXXXXX"},
+	})
+}
+
+func TestMultisite(t *testing.T) {
+	tmpConfigFile := createTemporaryFile(testWPConfig+`
+define( 'MULTISITE', true );
+$table_prefix = 'wp_';
+`, "wp-config.php")
+	defer os.Remove(tmpConfigFile.Name())
+	wp, err := parseWPConfig(tmpConfigFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wp.multisite() {
+		t.Error("expected a multisite network")
+	}
+	if id := wp.mainSiteID(); id != baseSiteID {
+		t.Errorf("expected the main site %d, got %d", baseSiteID, id)
+	}
+	if table := wp.site(baseSiteID).table("options"); table != "wp_options" {
+		t.Errorf("expected wp_options table for the main site, got %s", table)
+	}
+	if table := wp.site(2).table("options"); table != "wp_2_options" {
+		t.Errorf("expected wp_2_options table for the site 2, got %s", table)
+	}
+	if table := wp.site(2).table("sitemeta"); table != "wp_2_sitemeta" {
+		t.Errorf("expected the site table prefix, got %s", table)
+	}
+}
+
+func TestQueryNetworkConfig(t *testing.T) {
+	wp := &wpConfig{TablePrefix: "wp_"}
+	sites := []site{{1, "example.com/"}, {2, "example.com/shop/"}, {3, "example.com/blog/"}}
+	tests := []struct {
+		name     string
+		network  testNetwork
+		expected map[string][]string
+		errors   map[string]string
+	}{
+		{
+			name: "per site settings",
+			network: testNetwork{
+				options: map[string]map[string]string{
+					"wp_options":   {"active_plugins": pluginsData, "wp_mail_smtp": smtpOption(t, "smtp.example.com")},
+					"wp_2_options": {"active_plugins": pluginsData, "wp_mail_smtp": smtpOption(t, "smtp.example.com")},
+					"wp_3_options": {"active_plugins": `a:0:{}`},
+				},
+			},
+			expected: map[string][]string{
+				"smtp.example.com": {"example.com/", "example.com/shop/"},
+				"":                 {"example.com/blog/"},
+			},
+		},
+		{
+			name: "network-activated plugin with site settings",
+			network: testNetwork{
+				options: map[string]map[string]string{
+					"wp_options":   {"active_plugins": `a:0:{}`, "wp_mail_smtp": smtpOption(t, "smtp.example.com")},
+					"wp_2_options": {"active_plugins": `a:0:{}`, "wp_mail_smtp": smtpOption(t, "smtp.shop.example.com")},
+					"wp_3_options": {"active_plugins": `a:0:{}`, "wp_mail_smtp": smtpOption(t, "smtp.example.com")},
+				},
+				siteMeta: map[string]string{"active_sitewide_plugins": `a:1:{s:29:"wp-mail-smtp/wp_mail_smtp.php";i:1700000000;}`},
+			},
+			expected: map[string][]string{
+				"smtp.example.com":      {"example.com/", "example.com/blog/"},
+				"smtp.shop.example.com": {"example.com/shop/"},
+			},
+		},
+		{
+			name: "network-wide WP Mail SMTP settings",
+			network: testNetwork{
+				options: map[string]map[string]string{
+					"wp_options":   {"active_plugins": `a:0:{}`, "wp_mail_smtp": smtpOption(t, "smtp.example.com")},
+					"wp_2_options": {"active_plugins": `a:0:{}`, "wp_mail_smtp": smtpOption(t, "smtp.shop.example.com")},
+					"wp_3_options": {"active_plugins": `a:0:{}`},
+				},
+				siteMeta: map[string]string{
+					"active_sitewide_plugins": `a:1:{s:29:"wp-mail-smtp/wp_mail_smtp.php";i:1700000000;}`,
+					"wp_mail_smtp_multisite":  `a:1:{s:14:"global_options";b:1;}`,
+				},
+			},
+			expected: map[string][]string{
+				"smtp.example.com": {"example.com/", "example.com/shop/", "example.com/blog/"},
+			},
+		},
+		{
+			name: "site without settings",
+			network: testNetwork{
+				options: map[string]map[string]string{
+					"wp_options":   {"active_plugins": pluginsData, "wp_mail_smtp": smtpOption(t, "smtp.example.com")},
+					"wp_2_options": {"active_plugins": pluginsData},
+					"wp_3_options": {"active_plugins": pluginsData, "wp_mail_smtp": smtpOption(t, "smtp.example.com")},
+				},
+			},
+			expected: map[string][]string{
+				"smtp.example.com": {"example.com/", "example.com/blog/"},
+				"":                 {"example.com/shop/"},
+			},
+			errors: map[string]string{"example.com/shop/": "error reading wp_mail_smtp option"},
+		},
+	}
+	for _, test := range tests {
+		t.Run("Check "+test.name, func(t *testing.T) {
+			test.network.sites = sites
+			withNetwork(t, test.network)
+			config, err := queryNetworkConfig(wp)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			hosts := map[string][]string{}
+			for _, siteConfig := range config.SiteConfigs() {
+				hosts[siteConfig.Config.GetSMTPSettings().Host] = siteConfig.Sites
+				err := siteError(siteConfig.Config)
+				expected, ok := test.errors[siteConfig.Sites[0]]
+				switch {
+				case ok && (err == nil || !strings.Contains(err.Error(), expected)):
+					t.Errorf("expected error %q for %v, got %v", expected, siteConfig.Sites, err)
+				case !ok && err != nil:
+					t.Errorf("unexpected error for %v: %v", siteConfig.Sites, err)
+				}
+			}
+			if !reflect.DeepEqual(hosts, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, hosts)
+			}
+		})
+	}
+}
+
+func TestQueryNetworkConfigMainSite(t *testing.T) {
+	options := map[string]map[string]string{
+		"wp_options":   {"active_plugins": pluginsData, "wp_mail_smtp": smtpOption(t, "smtp.example.com")},
+		"wp_2_options": {"active_plugins": pluginsData, "wp_mail_smtp": smtpOption(t, "smtp.shop.example.com")},
+		"wp_3_options": {"active_plugins": pluginsData, "wp_mail_smtp": smtpOption(t, "smtp.example.com")},
+	}
+	sites := []site{{3, "example.com/blog/"}, {2, "shop.example.com/"}, {1, "example.com/"}}
+	tests := []struct {
+		name      string
+		source    string
+		siteMeta  map[string]string
+		host      string
+		mainSites []string
+	}{
+		{"unordered sites", "", nil, "smtp.example.com", []string{"example.com/", "example.com/blog/"}},
+		{"main site set with BLOG_ID_CURRENT_SITE", "define( 'BLOG_ID_CURRENT_SITE', 2 );\n", nil, "smtp.shop.example.com", []string{"shop.example.com/"}},
+		{
+			"network-wide WP Mail SMTP settings of the main site", "define( 'BLOG_ID_CURRENT_SITE', 2 );\n",
+			map[string]string{
+				"active_sitewide_plugins": `a:1:{s:29:"wp-mail-smtp/wp_mail_smtp.php";i:1700000000;}`,
+				"wp_mail_smtp_multisite":  `a:1:{s:14:"global_options";b:1;}`,
+			},
+			"smtp.shop.example.com", []string{"shop.example.com/", "example.com/", "example.com/blog/"},
+		},
+	}
+	for _, test := range tests {
+		t.Run("Check "+test.name, func(t *testing.T) {
+			withNetwork(t, testNetwork{options: options, siteMeta: test.siteMeta, sites: slices.Clone(sites)})
+			config, err := queryNetworkConfig(&wpConfig{TablePrefix: "wp_", source: test.source})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if host := config.GetSMTPSettings().Host; host != test.host {
+				t.Errorf("expected the settings of the main site with host %q, got %q", test.host, host)
+			}
+			if mainSites := config.SiteConfigs()[0].Sites; !reflect.DeepEqual(mainSites, test.mainSites) {
+				t.Errorf("expected the sites %v first, got %v", test.mainSites, mainSites)
+			}
+		})
+	}
+}
+
+func TestQueryNetworkConfigWithoutSites(t *testing.T) {
+	withNetwork(t, testNetwork{})
+	if _, err := queryNetworkConfig(&wpConfig{TablePrefix: "wp_"}); err == nil {
+		t.Error("expected an error without active sites")
+	}
+}
@@ -0,0 +1,321 @@
+package wordpress
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps/php"
+	"github.com/juju/errors"
+	"github.com/yvasiyarov/php_session_decoder/php_serialize"
+)
+
+// mailPlugin is a WordPress plugin that replaces the PHP mail() function to send the mails
+type mailPlugin struct {
+	Name string
+	// Files are the plugin files listed in the active_plugins option
+	Files []string
+	// Option is the name of the option with the plugin settings
+	Option string
+	// decode reads the plugin settings from the serialized option value
+	decode func(value string, wp *wpConfig, config *Config) error
+}
+
+var mailPlugins = []mailPlugin{
+	{
+		Name:   "WP Mail SMTP",
+		Files:  []string{"wp-mail-smtp/wp_mail_smtp.php", "wp-mail-smtp-pro/wp_mail_smtp.php"},
+		Option: "wp_mail_smtp",
+		decode: decodeWPMailSMTP,
+	},
+	{
+		Name:   "Post SMTP",
+		Files:  []string{"post-smtp/postman-smtp.php"},
+		Option: "postman_options",
+		decode: decodePostSMTP,
+	},
+	{
+		Name:   "Easy WP SMTP",
+		Files:  []string{"easy-wp-smtp/easy-wp-smtp.php"},
+		Option: "swpsmtp_options",
+		decode: decodeEasyWPSMTP,
+	},
+	{
+		Name:   "FluentSMTP",
+		Files:  []string{"fluent-smtp/fluent-smtp.php"},
+		Option: "fluentmail-settings",
+		decode: decodeFluentSMTP,
+	},
+	{
+		Name:   "WP Offload SES",
+		Files:  []string{"wp-ses/wp-ses.php", "wp-offload-ses/wp-offload-ses.php"},
+		Option: "wposes_settings",
+		decode: decodeOffloadSES,
+	},
+}
+
+// activeMailPlugins returns the mail plugins in the serialized active_plugins option, in load order
+func activeMailPlugins(pluginsInfo string) ([]*mailPlugin, error) {
+	val, err := php_serialize.NewUnSerializer(pluginsInfo).Decode()
+	if err != nil {
+		return nil, errors.Errorf("error while decoding object value: %v", err)
+	}
+	plugins, ok := val.(php_serialize.PhpArray)
+	if !ok {
+		return nil, errors.Errorf("unable to convert %v to PhpArray", val)
+	}
+	// The array may have gaps after deactivating plugins
+	keys := make([]int, 0, len(plugins))
+	for k := range plugins {
+		if key, ok := k.(int); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Ints(keys)
+	var res []*mailPlugin
+	for _, key := range keys {
+		plugin, ok := plugins[key].(string)
+		if !ok {
+			return nil, errors.Errorf("unable to convert %v to string", plugins[key])
+		}
+		if mailPlugin := mailPluginForFile(plugin); mailPlugin != nil {
+			res = append(res, mailPlugin)
+		}
+	}
+	return res, nil
+}
+
+// mailPluginForFile returns the mail plugin of a plugin file, or nil if it is not a mail plugin
+func mailPluginForFile(file string) *mailPlugin {
+	for i := range mailPlugins {
+		if slices.Contains(mailPlugins[i].Files, file) {
+			return &mailPlugins[i]
+		}
+	}
+	return nil
+}
+
+// decodeOption decodes a serialized option into a PHP array
+func decodeOption(value string) (php_serialize.PhpArray, error) {
+	val, err := php_serialize.NewUnSerializer(value).Decode()
+	if err != nil {
+		return nil, errors.Errorf("error while decoding object value: %v", err)
+	}
+	array, ok := val.(php_serialize.PhpArray)
+	if !ok {
+		return nil, errors.Errorf("unable to convert %v to PhpArray", val)
+	}
+	return array, nil
+}
+
+// decodePostSMTP reads the postman_options of Post SMTP. The password is stored base64 encoded
+func decodePostSMTP(value string, wp *wpConfig, config *Config) error {
+	options, err := decodeOption(value)
+	if err != nil {
+		return err
+	}
+	switch transport := php.ArrayString(options, "transport_type"); transport {
+	case "", "smtp":
+	case "default":
+		config.Mail.Mailer = string(apps.MailerPHPMail)
+	default:
+		return errors.Errorf("Post SMTP sends the mails with the %q transport, which does not use SMTP", transport)
+	}
+	config.Mail.FromMail = php.ArrayString(options, "sender_email")
+	config.Mail.FromName = php.ArrayString(options, "sender_name")
+	config.SMTPSettings.Host = php.ArrayString(options, "hostname")
+	if config.SMTPSettings.Port, err = php.ArrayInt(options, "port"); err != nil {
+		return err
+	}
+	config.SMTPSettings.Encrypt = php.ArrayString(options, "enc_type")
+	switch auth := php.ArrayString(options, "auth_type"); auth {
+	case "", "none":
+	case "oauth2":
+		return errors.New("Post SMTP uses OAuth 2.0 authentication, whose tokens can not be checked")
+	default:
+		config.SMTPSettings.Auth = true
+		config.SMTPSettings.AuthMechanism = apps.AuthMechanism(strings.ToUpper(strings.Replace(auth, "crammd5", "cram-md5", 1)))
+	}
+	config.SMTPSettings.User = php.ArrayString(options, "basic_auth_username")
+	password, err := base64.StdEncoding.DecodeString(php.ArrayString(options, "basic_auth_password"))
+	if err != nil {
+		return errors.Errorf("basic_auth_password: invalid base64 value: %v", err)
+	}
+	config.SMTPSettings.Pass = string(password)
+	return nil
+}
+
+// decodeEasyWPSMTP reads the swpsmtp_options of Easy WP SMTP. The password is stored base64
+// encoded, unless the password encryption is enabled
+func decodeEasyWPSMTP(value string, wp *wpConfig, config *Config) error {
+	options, err := decodeOption(value)
+	if err != nil {
+		return err
+	}
+	config.Mail.FromMail = php.ArrayString(options, "from_email_field")
+	config.Mail.FromName = php.ArrayString(options, "from_name_field")
+	config.SMTPSettings.Host = php.ArrayString(options, "smtp_settings", "host")
+	if config.SMTPSettings.Port, err = php.ArrayInt(options, "smtp_settings", "port"); err != nil {
+		return err
+	}
+	config.SMTPSettings.Encrypt = php.ArrayString(options, "smtp_settings", "type_encryption")
+	// The plugin option is misspelled
+	config.SMTPSettings.Auth = php.ArrayBool(options, "smtp_settings", "autentication")
+	config.SMTPSettings.User = php.ArrayString(options, "smtp_settings", "username")
+	if php.ArrayBool(options, "smtp_settings", "encrypt_pass") {
+		return errors.New("Easy WP SMTP stores the password encrypted, which can not be read")
+	}
+	password, err := base64.StdEncoding.DecodeString(php.ArrayString(options, "smtp_settings", "password"))
+	if err != nil {
+		return errors.Errorf("password: invalid base64 value: %v", err)
+	}
+	config.SMTPSettings.Pass = string(password)
+	return nil
+}
+
+// FluentSMTP encrypts the passwords with these values when LOGGED_IN_KEY and LOGGED_IN_SALT are not defined
+const (
+	fluentSMTPFallbackKey  = "this-is-a-fallback-key-but-not-secure"
+	fluentSMTPFallbackSalt = "this-is-a-fallback-salt-but-not-secure"
+)
+
+// decryptFluentSMTP decrypts a password encrypted by FluentSMTP: the base64 encoded IV followed
+// by the base64 encoded AES-256-CTR encryption of the password and the salt. The old versions
+// store the passwords unencrypted, so the value is returned as is when it can not be decrypted
+func decryptFluentSMTP(value string, wp *wpConfig) string {
+	key, ok := wp.constant("LOGGED_IN_KEY")
+	if !ok || key == "" {
+		key = fluentSMTPFallbackKey
+	}
+	salt, ok := wp.constant("LOGGED_IN_SALT")
+	if !ok || salt == "" {
+		salt = fluentSMTPFallbackSalt
+	}
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(raw) <= aes.BlockSize {
+		return value
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(string(raw[aes.BlockSize:]))
+	if err != nil {
+		return value
+	}
+	// OpenSSL pads or truncates the key to its size
+	block, err := aes.NewCipher(append([]byte(key), make([]byte, 32)...)[:32])
+	if err != nil {
+		return value
+	}
+	decrypted := make([]byte, len(encrypted))
+	cipher.NewCTR(block, raw[:aes.BlockSize]).XORKeyStream(decrypted, encrypted)
+	password, ok := strings.CutSuffix(string(decrypted), salt)
+	if !ok {
+		return value
+	}
+	return password
+}
+
+// decodeFluentSMTP reads the default connection of the fluentmail-settings of FluentSMTP. The
+// credentials can also be defined in wp-config.php
+func decodeFluentSMTP(value string, wp *wpConfig, config *Config) error {
+	options, err := decodeOption(value)
+	if err != nil {
+		return err
+	}
+	connections, _ := php.ArrayValue(options, "connections").(php_serialize.PhpArray)
+	id := php.ArrayString(options, "misc", "default_connection")
+	if _, ok := connections[id]; !ok {
+		// Without a default connection, the first one is used
+		id = ""
+		for k := range connections {
+			if key, ok := k.(string); ok && (id == "" || key < id) {
+				id = key
+			}
+		}
+	}
+	if id == "" {
+		return errors.New("FluentSMTP has no connection configured")
+	}
+	settings, _ := php.ArrayValue(connections, id, "provider_settings").(php_serialize.PhpArray)
+	switch provider := php.ArrayString(settings, "provider"); provider {
+	case "", "smtp":
+	case "default":
+		config.Mail.Mailer = string(apps.MailerPHPMail)
+	default:
+		return errors.Errorf("FluentSMTP sends the mails with the %q provider, which does not use SMTP", provider)
+	}
+	config.Mail.FromMail = php.ArrayString(settings, "sender_email")
+	config.Mail.FromName = php.ArrayString(settings, "sender_name")
+	config.SMTPSettings.Host = php.ArrayString(settings, "host")
+	if config.SMTPSettings.Port, err = php.ArrayInt(settings, "port"); err != nil {
+		return err
+	}
+	config.SMTPSettings.Encrypt = php.ArrayString(settings, "encryption")
+	config.SMTPSettings.Auth = php.ArrayBool(settings, "auth")
+	config.SMTPSettings.AutoTLS = php.ArrayBool(settings, "auto_tls")
+	if php.ArrayString(settings, "key_store") == "wp_config" {
+		config.SMTPSettings.User, _ = wp.constant("FLUENTMAIL_SMTP_USERNAME")
+		config.SMTPSettings.Pass, _ = wp.constant("FLUENTMAIL_SMTP_PASSWORD")
+		return nil
+	}
+	config.SMTPSettings.User = php.ArrayString(settings, "username")
+	config.SMTPSettings.Pass = decryptFluentSMTP(php.ArrayString(settings, "password"), wp)
+	return nil
+}
+
+// sesSMTPPassword derives the SES SMTP password of a region from an AWS secret access key
+func sesSMTPPassword(secretKey, region string) string {
+	signature := []byte("AWS4" + secretKey)
+	for _, message := range []string{"11111111", region, "ses", "aws4_request", "SendRawEmail"} {
+		mac := hmac.New(sha256.New, signature)
+		mac.Write([]byte(message))
+		signature = mac.Sum(nil)
+	}
+	return base64.StdEncoding.EncodeToString(append([]byte{0x04}, signature...))
+}
+
+// decodeOffloadSES reads the wposes_settings of WP Offload SES. The plugin sends the mails with
+// the SES API, so they are checked with the SES SMTP interface of the region, using the SMTP
+// credentials derived from the AWS access keys
+func decodeOffloadSES(value string, wp *wpConfig, config *Config) error {
+	options, err := decodeOption(value)
+	if err != nil {
+		return err
+	}
+	if !php.ArrayBool(options, "send-via-ses") {
+		config.Mail.Mailer = string(apps.MailerPHPMail)
+		return nil
+	}
+	region := php.ArrayString(options, "region")
+	if region == "" {
+		region = "us-east-1"
+	}
+	accessKey, ok := wp.constant("WPOSES_AWS_ACCESS_KEY_ID")
+	if !ok {
+		accessKey = php.ArrayString(options, "access-key-id")
+	}
+	secretKey, ok := wp.constant("WPOSES_AWS_SECRET_ACCESS_KEY")
+	if !ok {
+		secretKey = php.ArrayString(options, "secret-access-key")
+	}
+	if accessKey == "" || secretKey == "" {
+		return errors.New("WP Offload SES uses the AWS credentials of the instance role, which can not be checked")
+	}
+	fmt.Printf("WP Offload SES uses the SES API, checking the SES SMTP interface of %s with the same access key\n", region)
+	config.Mail.FromMail = php.ArrayString(options, "default-email")
+	config.Mail.FromName = php.ArrayString(options, "default-email-name")
+	config.SMTPSettings = SMTPSettings{
+		Host:    fmt.Sprintf("email-smtp.%s.amazonaws.com", region),
+		Port:    587,
+		User:    accessKey,
+		Pass:    sesSMTPPassword(secretKey, region),
+		Encrypt: "tls",
+		Auth:    true,
+	}
+	return nil
+}
@@ -2,10 +2,7 @@ package wordpress
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
-	"regexp"
-	"strconv"
+	"net/mail"
 	"strings"
 
 	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
@@ -14,19 +11,32 @@ import (
 	"github.com/yvasiyarov/php_session_decoder/php_serialize"
 )
 
-var (
-	propValue *regexp.Regexp
-)
-
 const (
-	configFilePath = "apps/wordpress/htdocs/wp-config.php"
+	configFilePath = "wp-config.php"
 )
 
+func init() {
+	apps.Register(apps.Application{
+		Name:       "wordpress",
+		Aliases:    []string{"wp"},
+		Layouts:    apps.BitnamiLayouts("wordpress"),
+		EnvPrefix:  "WORDPRESS",
+		ConfigFile: configFilePath,
+		Load:       QueryConfig,
+	})
+}
+
 // Config is a structure that contains the Mail/SMTP
 // configuration data of WP
 type Config struct {
+	// Plugin is the name of the mail plugin whose settings are used
+	Plugin       string
 	Mail         Mail
 	SMTPSettings SMTPSettings
+	// API is the request that checks the credentials of the mailers that use the API of a provider
+	API *apps.APIRequest
+	// mailerOptions are the settings of the API mailers of WP Mail SMTP, by mailer
+	mailerOptions php_serialize.PhpArray
 }
 
 // Mail is a structure that contains the Mail
@@ -46,17 +56,59 @@ type SMTPSettings struct {
 	Pass    string
 	Encrypt string
 	Auth    bool
-	AutoTLS bool
+	// AuthMechanism is only set by the plugins that allow choosing it
+	AuthMechanism apps.AuthMechanism
+	AutoTLS       bool
+}
+
+// connectionSecurity maps the WP Mail SMTP encryption setting to a connection security mode.
+// With no encryption and "autotls" enabled, STARTTLS is used only if the server offers it
+func (s SMTPSettings) connectionSecurity() apps.ConnectionSecurity {
+	switch s.Encrypt {
+	case "ssl":
+		return apps.SecurityImplicitTLS
+	case "tls":
+		return apps.SecuritySTARTTLS
+	case "none":
+		if !s.AutoTLS {
+			return apps.SecurityNone
+		}
+	}
+	return ""
 }
 
 // GetSMTPSettings returns a SMTPSettings from Config structure
 func (c Config) GetSMTPSettings() *apps.SMTPSettings {
-	return &apps.SMTPSettings{
-		Host: c.SMTPSettings.Host,
-		Port: c.SMTPSettings.Port,
-		User: c.SMTPSettings.User,
-		Pass: c.SMTPSettings.Pass,
+	settings := &apps.SMTPSettings{
+		Host:     c.SMTPSettings.Host,
+		Port:     c.SMTPSettings.Port,
+		User:     c.SMTPSettings.User,
+		Pass:     c.SMTPSettings.Pass,
+		Security: c.SMTPSettings.connectionSecurity(),
+	}
+	if c.Mail.FromMail != "" {
+		settings.From = (&mail.Address{Name: c.Mail.FromName, Address: c.Mail.FromMail}).String()
+	}
+	// Most plugins do not allow choosing the mechanism, PHPMailer negotiates it
+	settings.Auth = c.SMTPSettings.AuthMechanism
+	if !c.SMTPSettings.Auth {
+		settings.Auth = apps.AuthNone
+	}
+	return settings
+}
+
+// Mailer returns the way WordPress sends the mails. The "mail" mailer uses the PHP mail() function,
+// and the API mailers are checked with SMTP or their API
+func (c Config) Mailer() apps.Mailer {
+	if mailer := apps.Mailer(c.Mail.Mailer); mailer.Local() {
+		return mailer
 	}
+	return apps.MailerSMTP
+}
+
+// APIRequest returns the request that checks the credentials of the API mailer, if any
+func (c Config) APIRequest() *apps.APIRequest {
+	return c.API
 }
 
 // ValidateSMTPSettings checks the SMTPSettings are correct
@@ -67,71 +119,36 @@ func (c *Config) ValidateSMTPSettings() error {
 	if c.SMTPSettings.Port == 0 {
 		return errors.New("port: invalid port")
 	}
+	if !c.SMTPSettings.Auth {
+		return nil
+	}
 	if c.SMTPSettings.User == "" {
 		return errors.New("user: empty string")
 	}
 	if c.SMTPSettings.Pass == "" {
 		return errors.New("password: empty string")
 	}
-	if c.SMTPSettings.Host == "smtp.gmail.com" && !c.SMTPSettings.AutoTLS {
-		return errors.New("set autotls to true when using smtp.gmail.com as domain")
-	}
 	return nil
 }
 
-func getProperty(buffer []byte, property string) string {
-	propValue = regexp.MustCompilePOSIX(fmt.Sprintf(`^[[:space:]]*define\('%s',[[:space:]]+'(.*)'\);`, property))
-	return propValue.FindStringSubmatch(string(buffer[:]))[1]
-}
-
-func parseWPDatabaseConfig(configFile string) (mysql.Database, error) {
-	source, err := os.ReadFile(configFile)
-	if err != nil {
-		return mysql.Database{}, errors.Errorf("error reading config file: %v", err)
-	}
-	port, _ := strconv.Atoi(strings.Split(getProperty(source, "DB_HOST"), ":")[1])
-	return mysql.Database{
-		Host: strings.Split(getProperty(source, "DB_HOST"), ":")[0],
-		Port: port,
-		User: getProperty(source, "DB_USER"),
-		Name: getProperty(source, "DB_NAME"),
-		Pass: getProperty(source, "DB_PASSWORD"),
-	}, nil
-}
-
-func checkPlugin(pluginsInfo string) error {
-	val, err := php_serialize.NewUnSerializer(pluginsInfo).Decode()
-	if err != nil {
-		return errors.Errorf("error while decoding object value: %v", err)
-	}
-	plugins, ok := val.(php_serialize.PhpArray)
-	if !ok {
-		return errors.Errorf("unable to convert %v to PhpArray", val)
-	}
-	for _, v := range plugins {
-		plugin, ok := v.(string)
-		if !ok {
-			return errors.Errorf("unable to convert %v to string", v)
-		}
-		if plugin == "wp-mail-smtp/wp_mail_smtp.php" {
-			return nil
-		}
-	}
-	return errors.New("wp-mail-smtp plugin not installed")
-}
-
-func checkPluginOnDatabase(database mysql.Database) error {
+// queryOption returns the value of an option of the site
+var queryOption = func(wp *wpConfig, name string) (string, error) {
 	query := mysql.Query{
-		Table:  "wp_options",
+		Table:  wp.table("options"),
 		Column: "option_value",
 		Key:    "option_name",
-		Value:  "active_plugins",
+		Value:  name,
 	}
-	queryResult, err := database.MySQLQuery(query)
+	return wp.Database.MySQLQuery(query)
+}
+
+// activeMailPluginsOnDatabase returns the active mail plugins of the site
+func activeMailPluginsOnDatabase(wp *wpConfig) ([]*mailPlugin, error) {
+	queryResult, err := queryOption(wp, "active_plugins")
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return checkPlugin(queryResult)
+	return activeMailPlugins(queryResult)
 }
 
 func obtainSMTP(smtpInfo string, config *Config) error {
@@ -162,7 +179,7 @@ func obtainSMTP(smtpInfo string, config *Config) error {
 					if !ok {
 						return errors.Errorf("unable to convert %v to int", v)
 					}
-				case "encyrption":
+				case "encryption":
 					config.SMTPSettings.Encrypt, ok = v.(string)
 					if !ok {
 						return errors.Errorf("unable to convert %v to string", v)
@@ -213,35 +230,70 @@ func obtainSMTP(smtpInfo string, config *Config) error {
 					}
 				}
 			}
+		default:
+			// The settings of the API mailers, e.g. sendgrid
+			if settings, ok := array.(php_serialize.PhpArray); ok {
+				if config.mailerOptions == nil {
+					config.mailerOptions = php_serialize.PhpArray{}
+				}
+				config.mailerOptions[key] = settings
+			}
 		}
 	}
 	return nil
 }
 
-func obtainSMTPFromDatabase(database mysql.Database, config *Config) error {
-	query := mysql.Query{
-		Table:  "wp_options",
-		Column: "option_value",
-		Key:    "option_name",
-		Value:  "wp_mail_smtp",
+// obtainSMTPFromDatabase reads the settings of a mail plugin from its option. On multisite
+// networks, the settings of the network-activated plugins can be network-wide
+func obtainSMTPFromDatabase(wp *wpConfig, plugin *mailPlugin, network *networkConfig, config *Config) error {
+	queryResult, err := network.option(wp, plugin)
+	if err != nil {
+		return errors.Errorf("error reading %s option: %v", plugin.Option, err)
 	}
-	queryResult, err := database.MySQLQuery(query)
+	config.Plugin = plugin.Name
+	return plugin.decode(queryResult, wp, config)
+}
+
+// obtainConfig reads the configuration of the active mail plugin of a site. Without it, WordPress
+// uses PHP mail()
+func obtainConfig(wp *wpConfig, network *networkConfig) (*Config, error) {
+	config := &Config{}
+	plugins, err := activeMailPluginsOnDatabase(wp)
 	if err != nil {
-		return err
+		return nil, errors.Errorf("error checking the active mail plugins: %v", err)
+	}
+	plugins = network.activePlugins(plugins)
+	if len(plugins) == 0 {
+		fmt.Println("No mail plugin active, WordPress sends the mails using PHP mail()")
+		config.Mail.Mailer = string(apps.MailerPHPMail)
+		return config, nil
 	}
-	return obtainSMTP(queryResult, config)
+	if len(plugins) > 1 {
+		names := make([]string, len(plugins))
+		for i, plugin := range plugins {
+			names[i] = plugin.Name
+		}
+		fmt.Printf("Warning: several mail plugins are active (%s), they conflict and only one of them sends the mails. Checking the %s settings\n", strings.Join(names, ", "), plugins[0].Name)
+	}
+	fmt.Printf("Reading the settings of the %s plugin\n", plugins[0].Name)
+	return config, obtainSMTPFromDatabase(wp, plugins[0], network, config)
 }
 
-// QueryConfig obtains an ApplicationConfig from by querying the MySQL database
-func QueryConfig(installDir string) (apps.ApplicationConfig, error) {
-	config := Config{}
-	database, err := parseWPDatabaseConfig(filepath.Join(installDir, configFilePath))
+// QueryConfig obtains an ApplicationConfig from by querying the MySQL database set in wp-config.php.
+// On multisite networks, the configuration of each site is obtained
+func QueryConfig(configFile string) (apps.ApplicationConfig, error) {
+	wp, err := parseWPConfig(configFile)
 	if err != nil {
 		return nil, errors.Errorf("error parsing wp-config.php file: %v", err)
 	}
-	err = checkPluginOnDatabase(database)
+	var config apps.ApplicationConfig
+	if wp.multisite() {
+		config, err = queryNetworkConfig(wp)
+	} else {
+		config, err = obtainConfig(wp, nil)
+	}
 	if err != nil {
-		return nil, errors.Errorf("error checking wp-mail-smtp plugin: %v", err)
+		return nil, err
 	}
-	return &config, obtainSMTPFromDatabase(database, &config)
+	return config, nil
 }
@@ -39,10 +39,11 @@ func TestParseWPDatabaseConfig(t *testing.T) {
 	t.Run("Check parsed database configuration data", func(t *testing.T) {
 		tmpConfigFile := createTemporaryFile(testWPConfig, "wp-config.php")
 		defer os.Remove(tmpConfigFile.Name())
-		database, err := parseWPDatabaseConfig(tmpConfigFile.Name())
+		wp, err := parseWPConfig(tmpConfigFile.Name())
 		if err != nil {
-			t.Errorf("Error parsing wp-config.php file: %v", err)
+			t.Fatalf("Error parsing wp-config.php file: %v", err)
 		}
+		database := wp.Database
 		if database.Host != "localhost" {
 			t.Errorf("Incorrect database host detected, expected: localhost, got: %s", database.Host)
 		}
@@ -61,15 +62,6 @@ func TestParseWPDatabaseConfig(t *testing.T) {
 	})
 }
 
-func TestCheckPlugin(t *testing.T) {
-	t.Run("Check installed plugins", func(t *testing.T) {
-		err := checkPlugin(pluginsData)
-		if err != nil {
-			t.Errorf("Error checking installed plugins: %v", err)
-		}
-	})
-}
-
 func TestObtainSMTP(t *testing.T) {
 	t.Run("Check obtained SMTP data", func(t *testing.T) {
 		config := Config{}
@@ -0,0 +1,133 @@
+package wordpress
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bitnami/healthcheck-tools/pkg/mysql"
+	"github.com/juju/errors"
+)
+
+// Defaults of WordPress and the MySQL client
+const (
+	defaultTablePrefix = "wp_"
+	defaultDBPort      = 3306
+)
+
+var (
+	tablePrefixRe      = regexp.MustCompile(`(?m)^\s*\$table_prefix\s*=\s*(?:'((?:[^'\\]|\\.)*)'|"((?:[^"\\]|\\.)*)")\s*;`)
+	validTablePrefixRe = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	phpUnescaper       = strings.NewReplacer(`\\`, `\`, `\'`, `'`, `\"`, `"`)
+)
+
+// wpConfig contains the settings of wp-config.php
+type wpConfig struct {
+	source      string
+	Database    mysql.Database
+	TablePrefix string
+}
+
+// constantRe matches the define() of a constant, with a single or double quoted value, or a
+// literal one such as true or 1
+func constantRe(name string) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`(?m)^\s*define\s*\(\s*['"]%s['"]\s*,\s*(?:'((?:[^'\\]|\\.)*)'|"((?:[^"\\]|\\.)*)"|([^\s'")]+))\s*\)\s*;`, regexp.QuoteMeta(name)))
+}
+
+// phpString returns the value of the quoted or literal groups of a match
+func phpString(matches []string) string {
+	for _, value := range matches[1:] {
+		if value != "" {
+			return phpUnescaper.Replace(value)
+		}
+	}
+	return ""
+}
+
+// constant returns the value of a constant defined in wp-config.php
+func (c *wpConfig) constant(name string) (string, bool) {
+	matches := constantRe(name).FindStringSubmatch(c.source)
+	if matches == nil {
+		return "", false
+	}
+	return phpString(matches), true
+}
+
+// requiredConstant returns the value of a constant that must be defined in wp-config.php
+func (c *wpConfig) requiredConstant(name string) (string, error) {
+	value, ok := c.constant(name)
+	if !ok {
+		return "", errors.Errorf("%s is not defined with a literal value", name)
+	}
+	return value, nil
+}
+
+// parseDBHost parses the DB_HOST forms supported by WordPress: host, host:port, host:/socket,
+// host:port:/socket, [IPv6]:port and IPv6 addresses without port
+func parseDBHost(dbHost string) (mysql.Database, error) {
+	database := mysql.Database{Host: "localhost", Port: defaultDBPort}
+	if i := strings.Index(dbHost, ":/"); i >= 0 {
+		database.Socket = dbHost[i+1:]
+		dbHost = dbHost[:i]
+	}
+	host, port := dbHost, ""
+	switch {
+	case strings.HasPrefix(host, "["):
+		end := strings.Index(host, "]")
+		if end < 0 {
+			return mysql.Database{}, errors.Errorf("invalid DB_HOST %q: missing ]", dbHost)
+		}
+		host, port = host[1:end], strings.TrimPrefix(host[end+1:], ":")
+	case strings.Count(host, ":") == 1:
+		host, port, _ = strings.Cut(host, ":")
+	}
+	if host != "" {
+		database.Host = host
+	}
+	if port != "" {
+		var err error
+		if database.Port, err = strconv.Atoi(port); err != nil || database.Port <= 0 || database.Port > 65535 {
+			return mysql.Database{}, errors.Errorf("invalid DB_HOST %q: invalid port %q", dbHost, port)
+		}
+	}
+	return database, nil
+}
+
+// parseWPConfig reads the database settings and the table prefix from wp-config.php
+func parseWPConfig(configFile string) (*wpConfig, error) {
+	source, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, errors.Errorf("error reading config file: %v", err)
+	}
+	config := &wpConfig{source: string(source), TablePrefix: defaultTablePrefix}
+	dbHost, ok := config.constant("DB_HOST")
+	if !ok {
+		dbHost = "localhost"
+	}
+	if config.Database, err = parseDBHost(dbHost); err != nil {
+		return nil, err
+	}
+	if config.Database.Name, err = config.requiredConstant("DB_NAME"); err != nil {
+		return nil, err
+	}
+	if config.Database.User, err = config.requiredConstant("DB_USER"); err != nil {
+		return nil, err
+	}
+	if config.Database.Pass, err = config.requiredConstant("DB_PASSWORD"); err != nil {
+		return nil, err
+	}
+	if matches := tablePrefixRe.FindStringSubmatch(config.source); matches != nil {
+		config.TablePrefix = phpString(matches)
+	}
+	if !validTablePrefixRe.MatchString(config.TablePrefix) {
+		return nil, errors.Errorf("invalid $table_prefix %q, it can only contain numbers, letters and underscores", config.TablePrefix)
+	}
+	return config, nil
+}
+
+// table returns the name of a WordPress table with the prefix
+func (c *wpConfig) table(name string) string {
+	return c.TablePrefix + name
+}
@@ -0,0 +1,87 @@
+package wordpress
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bitnami/healthcheck-tools/pkg/mysql"
+)
+
+func TestParseDBHost(t *testing.T) {
+	tests := map[string]mysql.Database{
+		"":                                   {Host: "localhost", Port: 3306},
+		"localhost":                          {Host: "localhost", Port: 3306},
+		"db.example.com:3307":                {Host: "db.example.com", Port: 3307},
+		"localhost:/tmp/mysql.sock":          {Host: "localhost", Port: 3306, Socket: "/tmp/mysql.sock"},
+		":/opt/bitnami/mysql/tmp/mysql.sock": {Host: "localhost", Port: 3306, Socket: "/opt/bitnami/mysql/tmp/mysql.sock"},
+		"127.0.0.1:3307:/tmp/mysql.sock":     {Host: "127.0.0.1", Port: 3307, Socket: "/tmp/mysql.sock"},
+		"::1":                                {Host: "::1", Port: 3306},
+		"[2001:db8::1]:3307":                 {Host: "2001:db8::1", Port: 3307},
+		"[2001:db8::1]":                      {Host: "2001:db8::1", Port: 3306},
+	}
+	for dbHost, expected := range tests {
+		t.Run("Check DB_HOST "+dbHost, func(t *testing.T) {
+			database, err := parseDBHost(dbHost)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(database, expected) {
+				t.Errorf("expected %+v, got %+v", expected, database)
+			}
+		})
+	}
+	for _, dbHost := range []string{"localhost:mysql", "[::1:3306", "localhost:70000"} {
+		t.Run("Check invalid DB_HOST "+dbHost, func(t *testing.T) {
+			if _, err := parseDBHost(dbHost); err == nil || !strings.Contains(err.Error(), "invalid DB_HOST") {
+				t.Errorf("expected invalid DB_HOST error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseWPConfig(t *testing.T) {
+	t.Run("Check define() variants and the table prefix", func(t *testing.T) {
+		tmpConfigFile := createTemporaryFile(`<?php
+define( "DB_NAME", "bitnami_wordpress" );
+  define ('DB_USER','bn_wordpress');
+define( 'DB_PASSWORD', 'it\'s "secret"' );
+define( 'DB_HOST', '[::1]:3307' );
+define( 'WP_DEBUG', false );
+$table_prefix = "blog_";
+`, "wp-config.php")
+		defer os.Remove(tmpConfigFile.Name())
+		wp, err := parseWPConfig(tmpConfigFile.Name())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := mysql.Database{Host: "::1", Port: 3307, Name: "bitnami_wordpress", User: "bn_wordpress", Pass: `it's "secret"`}
+		if !reflect.DeepEqual(wp.Database, expected) {
+			t.Errorf("expected %+v, got %+v", expected, wp.Database)
+		}
+		if table := wp.table("options"); table != "blog_options" {
+			t.Errorf("expected blog_options table, got %s", table)
+		}
+		if debug, ok := wp.constant("WP_DEBUG"); !ok || debug != "false" {
+			t.Errorf("expected WP_DEBUG false, got %q", debug)
+		}
+	})
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"missing DB_NAME", "<?php\ndefine('DB_USER', 'user');\ndefine('DB_PASSWORD', 'pass');\n", "DB_NAME is not defined"},
+		{"invalid table prefix", "<?php\ndefine('DB_NAME', 'db');\ndefine('DB_USER', 'user');\ndefine('DB_PASSWORD', 'pass');\n$table_prefix = 'wp-';\n", "invalid $table_prefix"},
+	}
+	for _, test := range tests {
+		t.Run("Check "+test.name, func(t *testing.T) {
+			tmpConfigFile := createTemporaryFile(test.content, "wp-config.php")
+			defer os.Remove(tmpConfigFile.Name())
+			if _, err := parseWPConfig(tmpConfigFile.Name()); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package wordpress
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps/php"
+	"github.com/juju/errors"
+	"github.com/yvasiyarov/php_session_decoder/php_serialize"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// wpMailSMTPKeyOption is the option with the key WP Mail SMTP encrypts the SMTP password with,
+// unless it is defined with the WPMS_CRYPTO_KEY constant
+const wpMailSMTPKeyOption = "wp_mail_smtp_mail_key"
+
+// Sizes of the libsodium crypto_secretbox (XSalsa20-Poly1305) used by WP Mail SMTP to encrypt the passwords
+const (
+	secretboxKeySize   = 32
+	secretboxNonceSize = 24
+)
+
+// wpMailSMTPConstant is a WP Mail SMTP constant of wp-config.php, which overrides an option when
+// WPMS_ON is true
+type wpMailSMTPConstant struct {
+	Name    string
+	Mailer  string
+	Setting string
+}
+
+var wpMailSMTPConstants = []wpMailSMTPConstant{
+	{"WPMS_MAIL_FROM", "mail", "from_email"},
+	{"WPMS_MAIL_FROM_NAME", "mail", "from_name"},
+	{"WPMS_MAILER", "mail", "mailer"},
+	{"WPMS_SMTP_HOST", "smtp", "host"},
+	{"WPMS_SMTP_PORT", "smtp", "port"},
+	{"WPMS_SSL", "smtp", "encryption"},
+	{"WPMS_SMTP_AUTH", "smtp", "auth"},
+	{"WPMS_SMTP_AUTOTLS", "smtp", "autotls"},
+	{"WPMS_SMTP_USER", "smtp", "user"},
+	{"WPMS_SMTP_PASS", "smtp", "pass"},
+	{"WPMS_SENDGRID_API_KEY", "sendgrid", "api_key"},
+	{"WPMS_MAILGUN_API_KEY", "mailgun", "api_key"},
+	{"WPMS_MAILGUN_DOMAIN", "mailgun", "domain"},
+	{"WPMS_MAILGUN_REGION", "mailgun", "region"},
+	{"WPMS_AMAZONSES_CLIENT_ID", "amazonses", "client_id"},
+	{"WPMS_AMAZONSES_CLIENT_SECRET", "amazonses", "client_secret"},
+	{"WPMS_AMAZONSES_REGION", "amazonses", "region"},
+	{"WPMS_GMAIL_CLIENT_ID", "gmail", "client_id"},
+	{"WPMS_GMAIL_CLIENT_SECRET", "gmail", "client_secret"},
+	{"WPMS_POSTMARK_SERVER_API_TOKEN", "postmark", "server_api_token"},
+	{"WPMS_SPARKPOST_API_KEY", "sparkpost", "api_key"},
+	{"WPMS_SPARKPOST_REGION", "sparkpost", "region"},
+}
+
+// wpMailSMTPMailer is a WP Mail SMTP mailer that sends the mails with the API of a provider. It is
+// checked with the SMTP relay of the provider when it accepts the same credentials, or with a
+// request to the API otherwise
+type wpMailSMTPMailer struct {
+	Name  string
+	relay func(options php_serialize.PhpArray) SMTPSettings
+	api   func(options php_serialize.PhpArray) *apps.APIRequest
+}
+
+var wpMailSMTPMailers = map[string]wpMailSMTPMailer{
+	"sendgrid": {
+		Name: "SendGrid",
+		relay: func(options php_serialize.PhpArray) SMTPSettings {
+			return SMTPSettings{Host: "smtp.sendgrid.net", Port: 587, Encrypt: "tls", Auth: true, User: "apikey", Pass: php.ArrayString(options, "api_key")}
+		},
+	},
+	"amazonses": {
+		Name: "Amazon SES",
+		relay: func(options php_serialize.PhpArray) SMTPSettings {
+			region := php.ArrayString(options, "region")
+			if region == "" {
+				region = "us-east-1"
+			}
+			return SMTPSettings{
+				Host: fmt.Sprintf("email-smtp.%s.amazonaws.com", region), Port: 587, Encrypt: "tls", Auth: true,
+				User: php.ArrayString(options, "client_id"), Pass: sesSMTPPassword(php.ArrayString(options, "client_secret"), region),
+			}
+		},
+	},
+	"postmark": {
+		Name: "Postmark",
+		relay: func(options php_serialize.PhpArray) SMTPSettings {
+			token := php.ArrayString(options, "server_api_token")
+			return SMTPSettings{Host: "smtp.postmarkapp.com", Port: 587, Encrypt: "tls", Auth: true, User: token, Pass: token}
+		},
+	},
+	"sparkpost": {
+		Name: "SparkPost",
+		relay: func(options php_serialize.PhpArray) SMTPSettings {
+			host := "smtp.sparkpostmail.com"
+			if strings.EqualFold(php.ArrayString(options, "region"), "EU") {
+				host = "smtp.eu.sparkpostmail.com"
+			}
+			return SMTPSettings{Host: host, Port: 587, Encrypt: "tls", Auth: true, User: "SMTP_Injection", Pass: php.ArrayString(options, "api_key")}
+		},
+	},
+	"mailgun": {
+		Name: "Mailgun",
+		// The API keys are not valid SMTP credentials, the domain is read with the API instead
+		api: func(options php_serialize.PhpArray) *apps.APIRequest {
+			host := "api.mailgun.net"
+			if strings.EqualFold(php.ArrayString(options, "region"), "EU") {
+				host = "api.eu.mailgun.net"
+			}
+			header := http.Header{}
+			header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("api:"+php.ArrayString(options, "api_key"))))
+			return &apps.APIRequest{
+				Provider: "Mailgun",
+				Method:   http.MethodGet,
+				URL:      fmt.Sprintf("https://%s/v3/domains/%s", host, url.PathEscape(php.ArrayString(options, "domain"))),
+				Header:   header,
+			}
+		},
+	},
+	"gmail": {
+		Name: "Gmail",
+		// The mails are sent with an OAuth access token, which is valid while the refresh token is
+		api: func(options php_serialize.PhpArray) *apps.APIRequest {
+			header := http.Header{}
+			header.Set("Content-Type", "application/x-www-form-urlencoded")
+			return &apps.APIRequest{
+				Provider: "Google OAuth",
+				Method:   http.MethodPost,
+				URL:      "https://oauth2.googleapis.com/token",
+				Header:   header,
+				Body: url.Values{
+					"client_id":     {php.ArrayString(options, "client_id")},
+					"client_secret": {php.ArrayString(options, "client_secret")},
+					"refresh_token": {php.ArrayString(options, "refresh_token")},
+					"grant_type":    {"refresh_token"},
+				}.Encode(),
+			}
+		},
+	},
+}
+
+// applyWPMailSMTPConstants overrides the options with the WP Mail SMTP constants of wp-config.php.
+// It returns whether the SMTP password is defined with a constant
+func applyWPMailSMTPConstants(wp *wpConfig, config *Config) (bool, error) {
+	if on, _ := wp.constant("WPMS_ON"); !php.Bool(on) {
+		return false, nil
+	}
+	passConstant := false
+	for _, c := range wpMailSMTPConstants {
+		value, ok := wp.constant(c.Name)
+		if !ok {
+			continue
+		}
+		fmt.Printf("Using %s defined in wp-config.php\n", c.Name)
+		var err error
+		switch c.Mailer + "." + c.Setting {
+		case "mail.from_email":
+			config.Mail.FromMail = value
+		case "mail.from_name":
+			config.Mail.FromName = value
+		case "mail.mailer":
+			config.Mail.Mailer = value
+		case "smtp.host":
+			config.SMTPSettings.Host = value
+		case "smtp.port":
+			if config.SMTPSettings.Port, err = strconv.Atoi(value); err != nil {
+				return false, errors.Errorf("%s: invalid port %q", c.Name, value)
+			}
+		case "smtp.encryption":
+			config.SMTPSettings.Encrypt = value
+			if value == "" {
+				config.SMTPSettings.Encrypt = "none"
+			}
+		case "smtp.auth":
+			config.SMTPSettings.Auth = php.Bool(value)
+		case "smtp.autotls":
+			config.SMTPSettings.AutoTLS = php.Bool(value)
+		case "smtp.user":
+			config.SMTPSettings.User = value
+		case "smtp.pass":
+			config.SMTPSettings.Pass, passConstant = value, true
+		default:
+			if config.mailerOptions == nil {
+				config.mailerOptions = php_serialize.PhpArray{}
+			}
+			options, ok := config.mailerOptions[c.Mailer].(php_serialize.PhpArray)
+			if !ok {
+				options = php_serialize.PhpArray{}
+				config.mailerOptions[c.Mailer] = options
+			}
+			options[c.Setting] = value
+		}
+	}
+	return passConstant, nil
+}
+
+// wpMailSMTPKey returns the key WP Mail SMTP encrypts the SMTP password with, if any
+func wpMailSMTPKey(wp *wpConfig) (*[32]byte, error) {
+	encoded, ok := wp.constant("WPMS_CRYPTO_KEY")
+	if !ok {
+		var err error
+		if encoded, err = queryOption(wp, wpMailSMTPKeyOption); err != nil {
+			return nil, errors.Errorf("error reading %s option: %v", wpMailSMTPKeyOption, err)
+		}
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil && len(encoded) == secretboxKeySize {
+		key, err = []byte(encoded), nil
+	}
+	if err != nil || len(key) != secretboxKeySize {
+		return nil, errors.New("invalid encryption key")
+	}
+	return (*[32]byte)(key), nil
+}
+
+// decryptWPMailSMTP decrypts a password encrypted by WP Mail SMTP: the base64 encoded nonce
+// followed by the secretbox of the password
+func decryptWPMailSMTP(value string, key *[32]byte) (string, bool) {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(raw) < secretboxNonceSize+secretbox.Overhead {
+		return "", false
+	}
+	var nonce [secretboxNonceSize]byte
+	copy(nonce[:], raw)
+	password, ok := secretbox.Open(nil, raw[secretboxNonceSize:], &nonce, key)
+	return string(password), ok
+}
+
+// decodeWPMailSMTP reads the wp_mail_smtp option of WP Mail SMTP, overridden by its constants. The
+// API mailers are checked with the SMTP relay or the API of the provider
+func decodeWPMailSMTP(value string, wp *wpConfig, config *Config) error {
+	if err := obtainSMTP(value, config); err != nil {
+		return err
+	}
+	passConstant, err := applyWPMailSMTPConstants(wp, config)
+	if err != nil {
+		return err
+	}
+	// The passwords are stored encrypted since WP Mail SMTP 2.5, when PHP supports it
+	if !passConstant && config.SMTPSettings.Pass != "" {
+		if raw, err := base64.StdEncoding.DecodeString(config.SMTPSettings.Pass); err == nil && len(raw) >= secretboxNonceSize+secretbox.Overhead {
+			key, err := wpMailSMTPKey(wp)
+			if err != nil {
+				fmt.Printf("Warning: unable to obtain the WP Mail SMTP encryption key, using the password as is: %v\n", err)
+			} else if password, ok := decryptWPMailSMTP(config.SMTPSettings.Pass, key); ok {
+				config.SMTPSettings.Pass = password
+			}
+		}
+	}
+	switch config.Mail.Mailer {
+	case "", "smtp", "mail":
+		return nil
+	}
+	mailer, ok := wpMailSMTPMailers[config.Mail.Mailer]
+	if !ok {
+		return errors.Errorf("WP Mail SMTP sends the mails with the %q mailer, which can not be checked", config.Mail.Mailer)
+	}
+	options, _ := config.mailerOptions[config.Mail.Mailer].(php_serialize.PhpArray)
+	if mailer.relay != nil {
+		fmt.Printf("WP Mail SMTP uses the %s API, checking its SMTP relay with the same credentials\n", mailer.Name)
+		config.SMTPSettings = mailer.relay(options)
+		return nil
+	}
+	fmt.Printf("WP Mail SMTP uses the %s API, checking its credentials with the API\n", mailer.Name)
+	config.API = mailer.api(options)
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/juju/errors"
+)
+
+// negotiationOrder is the order in which the mechanisms are tried when none is configured.
+// XOAUTH2 is never negotiated, as it requires an access token instead of a password
+var negotiationOrder = []apps.AuthMechanism{apps.AuthPlain, apps.AuthLogin, apps.AuthCRAMMD5}
+
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// loginAuth implements the LOGIN mechanism, which is not supported by net/smtp
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Like PlainAuth, do not send the credentials in clear text
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return string(apps.AuthLogin), nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, errors.Errorf("unexpected LOGIN challenge %q", fromServer)
+}
+
+// xoauth2Auth implements the XOAUTH2 mechanism used by Gmail and Office 365
+type xoauth2Auth struct {
+	username, token string
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return string(apps.AuthXOAUTH2), []byte(fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", a.username, a.token)), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// The server sends the error details as a challenge, an empty response gets the final error
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+// newAuth returns the net/smtp implementation of an authentication mechanism
+func newAuth(mechanism apps.AuthMechanism, settings *apps.SMTPSettings) smtp.Auth {
+	switch mechanism {
+	case apps.AuthLogin:
+		return &loginAuth{settings.User, settings.Pass, settings.Host}
+	case apps.AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(settings.User, settings.Pass)
+	case apps.AuthXOAUTH2:
+		return &xoauth2Auth{settings.User, settings.Pass}
+	default:
+		return smtp.PlainAuth("", settings.User, settings.Pass, settings.Host)
+	}
+}
+
+// offeredMechanisms returns the authentication mechanisms advertised by the server in the EHLO response
+func offeredMechanisms(c *smtpClient) []apps.AuthMechanism {
+	res := []apps.AuthMechanism{}
+	ok, params := c.Extension("AUTH")
+	if !ok {
+		return res
+	}
+	for _, m := range strings.Fields(params) {
+		res = append(res, apps.AuthMechanism(strings.ToUpper(m)))
+	}
+	return res
+}
+
+// negotiateAuth selects the mechanism to use: the configured one if the server offers it, or
+// the first one supported from the offered list when none is configured
+func negotiateAuth(offered []apps.AuthMechanism, configured apps.AuthMechanism) (apps.AuthMechanism, error) {
+	isOffered := func(m apps.AuthMechanism) bool {
+		for _, o := range offered {
+			if o == m {
+				return true
+			}
+		}
+		return false
+	}
+	if configured != "" {
+		if !isOffered(configured) {
+			return "", errors.Errorf("authentication mechanism %s is not offered by the SMTP server (offered: %s)", configured, formatMechanisms(offered))
+		}
+		return configured, nil
+	}
+	for _, m := range negotiationOrder {
+		if isOffered(m) {
+			return m, nil
+		}
+	}
+	return "", errors.Errorf("none of the supported authentication mechanisms is offered by the SMTP server (offered: %s)", formatMechanisms(offered))
+}
+
+func formatMechanisms(mechanisms []apps.AuthMechanism) string {
+	if len(mechanisms) == 0 {
+		return "none"
+	}
+	names := []string{}
+	for _, m := range mechanisms {
+		names = append(names, string(m))
+	}
+	return strings.Join(names, " ")
+}
+
+// authenticate authenticates with the SMTP server using the configured or negotiated mechanism.
+// It returns the mechanism used, or an empty string when the server does not offer authentication
+func authenticate(c *smtpClient, settings *apps.SMTPSettings) (apps.AuthMechanism, error) {
+	if settings.Auth == apps.AuthNone {
+		return "", nil
+	}
+	offered := offeredMechanisms(c)
+	if len(offered) == 0 {
+		if settings.Auth != "" {
+			return "", errors.Errorf("SMTP server does not offer authentication but %s is configured", settings.Auth)
+		}
+		return "", nil
+	}
+	mechanism, err := negotiateAuth(offered, settings.Auth)
+	if err != nil {
+		return "", err
+	}
+	if err := c.phases.Measure("auth", func() error { return c.Auth(newAuth(mechanism, settings)) }); err != nil {
+		return mechanism, errors.Errorf("%s authentication failed: %v", mechanism, err)
+	}
+	return mechanism, nil
+}
+
+// RunAuthChecks reports the authentication mechanisms offered by the SMTP server and the configured
+// one, and checks the credentials are accepted
+func RunAuthChecks(ctx context.Context, settings *apps.SMTPSettings) error {
+	phases := &Phases{}
+	defer phases.Print()
+	c, err := dialSMTP(ctx, settings, phases)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Hello("localhost"); err != nil {
+		return err
+	}
+	if _, err := startTLS(c, settings); err != nil {
+		return err
+	}
+	configured := string(settings.Auth)
+	if configured == "" {
+		configured = "negotiated with the server"
+	}
+	fmt.Printf("Mechanisms offered by the server: %s\n", formatMechanisms(offeredMechanisms(c)))
+	fmt.Printf("Configured mechanism: %s\n", configured)
+	mechanism, err := authenticate(c, settings)
+	if err != nil {
+		return err
+	}
+	switch mechanism {
+	case "":
+		fmt.Println("No authentication performed")
+	default:
+		fmt.Printf("Succesful %s authentication!\n", mechanism)
+	}
+	return c.Quit()
+}
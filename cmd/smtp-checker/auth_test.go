@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+)
+
+func TestNegotiateAuth(t *testing.T) {
+	tests := []struct {
+		offered    []apps.AuthMechanism
+		configured apps.AuthMechanism
+		expected   apps.AuthMechanism
+		err        string
+	}{
+		{[]apps.AuthMechanism{"LOGIN", "PLAIN", "XOAUTH2"}, "", apps.AuthPlain, ""},
+		{[]apps.AuthMechanism{"CRAM-MD5", "LOGIN"}, "", apps.AuthLogin, ""},
+		{[]apps.AuthMechanism{"LOGIN", "PLAIN"}, apps.AuthLogin, apps.AuthLogin, ""},
+		{[]apps.AuthMechanism{"XOAUTH2", "OAUTHBEARER"}, "", "", "none of the supported authentication mechanisms"},
+		{[]apps.AuthMechanism{"PLAIN"}, apps.AuthCRAMMD5, "", "CRAM-MD5 is not offered by the SMTP server (offered: PLAIN)"},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Check negotiation of %q with offered %v", test.configured, test.offered), func(t *testing.T) {
+			mechanism, err := negotiateAuth(test.offered, test.configured)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error negotiating the authentication mechanism: %v", err)
+			}
+			if mechanism != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, mechanism)
+			}
+		})
+	}
+}
+
+func TestRunAuthChecks(t *testing.T) {
+	for _, mechanism := range []apps.AuthMechanism{apps.AuthPlain, apps.AuthLogin, apps.AuthCRAMMD5, apps.AuthXOAUTH2} {
+		t.Run(fmt.Sprintf("Check %s authentication", mechanism), func(t *testing.T) {
+			server := startTestSMTPServer(t, func(s *testSMTPServer) {
+				s.extensions = []string{"STARTTLS", "AUTH PLAIN LOGIN CRAM-MD5 XOAUTH2"}
+			})
+			settings := server.settings()
+			settings.Auth = mechanism
+			if err := RunAuthChecks(context.Background(), settings); err != nil {
+				t.Fatalf("error checking SMTP authentication: %v", err)
+			}
+			if used := server.usedMechanisms(); len(used) != 1 || used[0] != string(mechanism) {
+				t.Errorf("expected %s authentication, the server got %v", mechanism, used)
+			}
+		})
+	}
+	t.Run("Check the mechanism is negotiated when not configured", func(t *testing.T) {
+		server := startTestSMTPServer(t, func(s *testSMTPServer) {
+			s.extensions = []string{"STARTTLS", "AUTH CRAM-MD5 LOGIN"}
+		})
+		if err := RunAuthChecks(context.Background(), server.settings()); err != nil {
+			t.Fatalf("error checking SMTP authentication: %v", err)
+		}
+		if used := server.usedMechanisms(); len(used) != 1 || used[0] != "LOGIN" {
+			t.Errorf("expected LOGIN authentication, the server got %v", used)
+		}
+	})
+	t.Run("Check invalid credentials are reported", func(t *testing.T) {
+		server := startTestSMTPServer(t, func(s *testSMTPServer) {
+			s.extensions = []string{"STARTTLS", "AUTH LOGIN XOAUTH2"}
+		})
+		settings := server.settings()
+		settings.Pass = "wrong"
+		for _, mechanism := range []apps.AuthMechanism{apps.AuthLogin, apps.AuthXOAUTH2} {
+			settings.Auth = mechanism
+			err := RunAuthChecks(context.Background(), settings)
+			if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%s authentication failed", mechanism)) {
+				t.Errorf("expected %s authentication error, got %v", mechanism, err)
+			}
+		}
+	})
+	t.Run("Check a configured mechanism not offered is reported", func(t *testing.T) {
+		server := startTestSMTPServer(t, nil)
+		settings := server.settings()
+		settings.Auth = apps.AuthLogin
+		err := RunAuthChecks(context.Background(), settings)
+		if err == nil || !strings.Contains(err.Error(), "LOGIN is not offered") {
+			t.Errorf("expected unsupported mechanism error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/juju/errors"
+	"github.com/mkmik/multierror"
+)
+
+// defaultDKIMSelectors are the selectors commonly used by mail providers and DKIM signers
+var defaultDKIMSelectors = stringList{"default", "google", "selector1", "selector2", "k1", "s1", "mail", "dkim"}
+
+// DNSOptions configures the DNS checks of the sender domain
+type DNSOptions struct {
+	Server        string
+	DKIMSelectors stringList
+}
+
+// NewDNSOptionsFromFlags creates a DNSOptions from the provided command line flags
+func NewDNSOptionsFromFlags(fs *flag.FlagSet) *DNSOptions {
+	options := DNSOptions{DKIMSelectors: append(stringList{}, defaultDKIMSelectors...)}
+	fs.StringVar(&options.Server, "dns_server", "", "DNS server (host:port) used by the DNS checks (by default, the system resolver)")
+	fs.Var(&options.DKIMSelectors, "dkim_selector", "Comma separated list of DKIM selectors to look for")
+	return &options
+}
+
+// resolver returns a resolver that queries the configured DNS server, or the system one
+func (o *DNSOptions) resolver() *net.Resolver {
+	if o.Server == "" {
+		return net.DefaultResolver
+	}
+	server := o.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server)
+		},
+	}
+}
+
+// isNotFound reports whether a lookup failed because the name or the records do not exist
+func isNotFound(err error) bool {
+	dnsErr, ok := err.(*net.DNSError)
+	return ok && dnsErr.IsNotFound
+}
+
+// lookupTXT returns the TXT records of a name starting with a prefix, e.g. "v=spf1"
+func lookupTXT(ctx context.Context, resolver *net.Resolver, name, prefix string) ([]string, error) {
+	records, err := resolver.LookupTXT(ctx, name)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	res := []string{}
+	for _, r := range records {
+		fields := strings.Fields(r)
+		if len(fields) > 0 && strings.EqualFold(strings.TrimSuffix(fields[0], ";"), prefix) {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+// SPFResult is the result of a SPF evaluation (RFC 7208 section 2.6)
+type SPFResult string
+
+// SPF results
+const (
+	SPFPass      SPFResult = "pass"
+	SPFFail      SPFResult = "fail"
+	SPFSoftFail  SPFResult = "softfail"
+	SPFNeutral   SPFResult = "neutral"
+	SPFNone      SPFResult = "none"
+	SPFPermError SPFResult = "permerror"
+	SPFTempError SPFResult = "temperror"
+)
+
+// spfMaxLookups is the maximum number of DNS lookups of a SPF evaluation (RFC 7208 section 4.6.4)
+const spfMaxLookups = 10
+
+var spfQualifiers = map[byte]SPFResult{'+': SPFPass, '-': SPFFail, '~': SPFSoftFail, '?': SPFNeutral}
+
+// spfEvaluator evaluates the SPF policy of a domain for an IP address. Macros are not supported,
+// the mechanisms using them do not match
+type spfEvaluator struct {
+	ctx      context.Context
+	resolver *net.Resolver
+	ip       net.IP
+	lookups  int
+}
+
+// spfError is an error that determines the result of the evaluation
+type spfError struct {
+	result SPFResult
+	msg    string
+}
+
+func (e *spfError) Error() string {
+	return e.msg
+}
+
+// spfErrorResult returns the result determined by an evaluation error
+func spfErrorResult(err error) SPFResult {
+	if e, ok := err.(*spfError); ok {
+		return e.result
+	}
+	return SPFPermError
+}
+
+func (e *spfEvaluator) countLookup() error {
+	e.lookups++
+	if e.lookups > spfMaxLookups {
+		return &spfError{SPFPermError, fmt.Sprintf("more than %d DNS lookups", spfMaxLookups)}
+	}
+	return nil
+}
+
+// dnsError converts a DNS lookup error, not found errors are void lookups
+func dnsError(err error) error {
+	if err == nil || isNotFound(err) {
+		return nil
+	}
+	return &spfError{SPFTempError, err.Error()}
+}
+
+// record returns the SPF record of a domain, or an empty string if it has none
+func (e *spfEvaluator) record(domain string) (string, error) {
+	records, err := lookupTXT(e.ctx, e.resolver, domain, "v=spf1")
+	if err != nil {
+		return "", &spfError{SPFTempError, err.Error()}
+	}
+	if len(records) > 1 {
+		return "", &spfError{SPFPermError, fmt.Sprintf("%s has %d SPF records", domain, len(records))}
+	}
+	if len(records) == 0 {
+		return "", nil
+	}
+	return records[0], nil
+}
+
+// splitCIDR splits the domain and the IPv4 and IPv6 prefix lengths of a/mx mechanisms, e.g. "example.com/24//64"
+func splitCIDR(arg string) (string, int, int, error) {
+	v4, v6 := 32, 128
+	domain, v6Length, hasV6 := strings.Cut(arg, "//")
+	domain, v4Length, hasV4 := strings.Cut(domain, "/")
+	var err error
+	if hasV4 {
+		if v4, err = strconv.Atoi(v4Length); err != nil || v4 > 32 {
+			return "", 0, 0, errors.Errorf("invalid IPv4 prefix length in %q", arg)
+		}
+	}
+	if hasV6 {
+		if v6, err = strconv.Atoi(v6Length); err != nil || v6 > 128 {
+			return "", 0, 0, errors.Errorf("invalid IPv6 prefix length in %q", arg)
+		}
+	}
+	return domain, v4, v6, nil
+}
+
+// matchesAddresses reports whether any of the addresses of a host is in the same network as the IP
+func (e *spfEvaluator) matchesAddresses(host string, v4, v6 int) (bool, error) {
+	addrs, err := e.resolver.LookupIPAddr(e.ctx, host)
+	if err != nil {
+		return false, dnsError(err)
+	}
+	for _, addr := range addrs {
+		bits, length := 128, v6
+		if addr.IP.To4() != nil {
+			bits, length = 32, v4
+		}
+		network := &net.IPNet{IP: addr.IP.Mask(net.CIDRMask(length, bits)), Mask: net.CIDRMask(length, bits)}
+		if network.Contains(e.ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (e *spfEvaluator) matches(domain, mechanism, arg string) (bool, error) {
+	if strings.Contains(arg, "%") {
+		return false, nil
+	}
+	switch mechanism {
+	case "all":
+		return true, nil
+	case "ip4", "ip6":
+		if !strings.Contains(arg, "/") {
+			ip := net.ParseIP(arg)
+			return ip != nil && ip.Equal(e.ip), nil
+		}
+		_, network, err := net.ParseCIDR(arg)
+		if err != nil {
+			return false, &spfError{SPFPermError, fmt.Sprintf("invalid %s mechanism %q", mechanism, arg)}
+		}
+		return network.Contains(e.ip), nil
+	case "a", "mx":
+		if err := e.countLookup(); err != nil {
+			return false, err
+		}
+		target, v4, v6, err := splitCIDR(arg)
+		if err != nil {
+			return false, &spfError{SPFPermError, err.Error()}
+		}
+		if target == "" {
+			target = domain
+		}
+		if mechanism == "a" {
+			return e.matchesAddresses(target, v4, v6)
+		}
+		mxs, err := e.resolver.LookupMX(e.ctx, target)
+		if err != nil {
+			return false, dnsError(err)
+		}
+		for _, mx := range mxs {
+			if match, err := e.matchesAddresses(mx.Host, v4, v6); match || err != nil {
+				return match, err
+			}
+		}
+		return false, nil
+	case "include":
+		if err := e.countLookup(); err != nil {
+			return false, err
+		}
+		result, err := e.check(arg)
+		switch result {
+		case SPFPass:
+			return true, nil
+		case SPFNone:
+			return false, &spfError{SPFPermError, fmt.Sprintf("included domain %s has no SPF record", arg)}
+		case SPFPermError, SPFTempError:
+			return false, err
+		}
+		return false, nil
+	case "exists":
+		if err := e.countLookup(); err != nil {
+			return false, err
+		}
+		addrs, err := e.resolver.LookupIPAddr(e.ctx, arg)
+		return len(addrs) > 0, dnsError(err)
+	case "ptr":
+		// ptr is deprecated and it would need the reverse DNS of the IP
+		return false, e.countLookup()
+	}
+	return false, &spfError{SPFPermError, fmt.Sprintf("unknown mechanism %q", mechanism)}
+}
+
+// check evaluates the SPF record of a domain
+func (e *spfEvaluator) check(domain string) (SPFResult, error) {
+	record, err := e.record(domain)
+	if err != nil {
+		return spfErrorResult(err), err
+	}
+	if record == "" {
+		return SPFNone, nil
+	}
+	redirect := ""
+	for _, term := range strings.Fields(record)[1:] {
+		name, value, isModifier := strings.Cut(term, "=")
+		if isModifier && !strings.ContainsAny(name, ":/") {
+			if strings.EqualFold(name, "redirect") {
+				redirect = value
+			}
+			continue
+		}
+		result := SPFPass
+		if r, ok := spfQualifiers[term[0]]; ok {
+			result, term = r, term[1:]
+		}
+		mechanism, arg, _ := strings.Cut(term, ":")
+		if i := strings.Index(mechanism, "/"); i >= 0 {
+			mechanism, arg = mechanism[:i], mechanism[i:]
+		}
+		match, err := e.matches(domain, strings.ToLower(mechanism), arg)
+		if err != nil {
+			return spfErrorResult(err), err
+		}
+		if match {
+			return result, nil
+		}
+	}
+	if redirect != "" {
+		if err := e.countLookup(); err != nil {
+			return SPFPermError, err
+		}
+		result, err := e.check(redirect)
+		if result == SPFNone {
+			return SPFPermError, &spfError{SPFPermError, fmt.Sprintf("redirect domain %s has no SPF record", redirect)}
+		}
+		return result, err
+	}
+	return SPFNeutral, nil
+}
+
+// EvaluateSPF evaluates whether the SPF policy of a domain authorises an IP address to send its mails
+func EvaluateSPF(ctx context.Context, resolver *net.Resolver, domain string, ip net.IP) (SPFResult, error) {
+	e := &spfEvaluator{ctx: ctx, resolver: resolver, ip: ip}
+	return e.check(domain)
+}
+
+// dmarcTags parses the tags of a DMARC record, e.g. "v=DMARC1; p=reject; rua=mailto:..."
+func dmarcTags(record string) map[string]string {
+	tags := map[string]string{}
+	for _, tag := range strings.Split(record, ";") {
+		if name, value, ok := strings.Cut(tag, "="); ok {
+			tags[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+		}
+	}
+	return tags
+}
+
+// organizationalDomain returns the registered domain of a subdomain. Public suffixes with more than
+// one label, like co.uk, are not taken into account
+func organizationalDomain(domain string) string {
+	labels := strings.Split(domain, ".")
+	if len(labels) <= 2 {
+		return domain
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
+
+// dnsChecks collects the results of the DNS checks
+type dnsChecks struct {
+	ctx      context.Context
+	resolver *net.Resolver
+	domain   string
+	errors   error
+}
+
+func (c *dnsChecks) warn(format string, args ...interface{}) {
+	fmt.Printf("Warning: "+format+"\n", args...)
+}
+
+func (c *dnsChecks) fail(format string, args ...interface{}) {
+	err := errors.Errorf(format, args...)
+	fmt.Printf("Error: %v\n", err)
+	c.errors = multierror.Append(c.errors, err)
+}
+
+func (c *dnsChecks) checkMX() {
+	mxs, err := c.resolver.LookupMX(c.ctx, c.domain)
+	if err != nil && !isNotFound(err) {
+		c.fail("unable to obtain the MX records of %s: %v", c.domain, err)
+		return
+	}
+	if len(mxs) == 0 {
+		c.warn("%s has no MX records, replies and bounces to the sender will not be delivered", c.domain)
+		return
+	}
+	hosts := []string{}
+	for _, mx := range mxs {
+		hosts = append(hosts, fmt.Sprintf("%s (%d)", strings.TrimSuffix(mx.Host, "."), mx.Pref))
+	}
+	fmt.Printf("MX: %s\n", strings.Join(hosts, ", "))
+}
+
+func (c *dnsChecks) checkSPF(smtpHost string) {
+	records, err := lookupTXT(c.ctx, c.resolver, c.domain, "v=spf1")
+	if err != nil {
+		c.fail("unable to obtain the SPF record of %s: %v", c.domain, err)
+		return
+	}
+	if len(records) == 0 {
+		c.warn("%s has no SPF record, the mails may be marked as spam", c.domain)
+		return
+	}
+	for _, r := range records {
+		fmt.Printf("SPF: %s\n", r)
+	}
+	// The mails are only rejected when the policy ends in -all. The well-known providers deliver the
+	// mails from other servers, usually with their own bounce domain as envelope sender
+	hardFail := strings.HasSuffix(strings.TrimSpace(records[len(records)-1]), "-all")
+	provider, isProvider := apps.ProviderForHost(smtpHost)
+	relayDelivers := !isProvider
+	addrs, err := c.resolver.LookupIPAddr(c.ctx, smtpHost)
+	if err != nil {
+		c.fail("unable to resolve the SMTP host %s: %v", smtpHost, err)
+		return
+	}
+	for _, addr := range addrs {
+		if addr.IP.IsLoopback() || addr.IP.IsPrivate() {
+			c.warn("SMTP host %s has the private address %s, the SPF policy applies to the public address of the relay", smtpHost, addr.IP)
+			continue
+		}
+		result, err := EvaluateSPF(c.ctx, c.resolver, c.domain, addr.IP)
+		fmt.Printf("SPF result for %s (%s): %s\n", addr.IP, smtpHost, result)
+		switch {
+		case result == SPFFail && hardFail && relayDelivers:
+			c.fail("the SPF policy of %s does not authorise the SMTP host %s (%s), the mails will likely be rejected", c.domain, smtpHost, addr.IP)
+		case result == SPFFail && !relayDelivers:
+			c.warn("the SPF policy of %s does not authorise the SMTP host %s (%s). %s delivers the mails from its own servers, make sure the SPF policy includes them if the provider uses %s as envelope sender",
+				c.domain, smtpHost, addr.IP, provider.Name, c.domain)
+		case result == SPFFail:
+			c.warn("the SPF policy of %s does not authorise the SMTP host %s (%s), the mails may be marked as spam", c.domain, smtpHost, addr.IP)
+		case result == SPFPermError || result == SPFTempError:
+			c.fail("unable to evaluate the SPF policy of %s: %v", c.domain, err)
+		case result == SPFSoftFail || result == SPFNeutral:
+			c.warn("the SPF policy of %s does not authorise the SMTP host %s (%s), the mails may be marked as spam", c.domain, smtpHost, addr.IP)
+		}
+	}
+}
+
+func (c *dnsChecks) checkDKIM(selectors []string) {
+	found := false
+	for _, selector := range selectors {
+		name := fmt.Sprintf("%s._domainkey.%s", selector, c.domain)
+		records, err := c.resolver.LookupTXT(c.ctx, name)
+		if err != nil {
+			if !isNotFound(err) {
+				c.fail("unable to obtain the DKIM record %s: %v", name, err)
+			}
+			continue
+		}
+		for _, r := range records {
+			tags := dmarcTags(r)
+			key, ok := tags["p"]
+			if !ok {
+				continue
+			}
+			found = true
+			if key == "" {
+				c.warn("DKIM selector %s of %s has been revoked", selector, c.domain)
+				continue
+			}
+			fmt.Printf("DKIM: selector %s found\n", selector)
+		}
+	}
+	if !found {
+		c.warn("no DKIM record found for %s with selectors %s, set the one of your provider using '-dkim_selector' flag",
+			c.domain, strings.Join(selectors, ", "))
+	}
+}
+
+func (c *dnsChecks) checkDMARC() {
+	var records []string
+	var err error
+	domain := c.domain
+	for _, d := range []string{c.domain, organizationalDomain(c.domain)} {
+		domain = d
+		records, err = lookupTXT(c.ctx, c.resolver, "_dmarc."+d, "v=DMARC1")
+		if err != nil || len(records) > 0 {
+			break
+		}
+	}
+	switch {
+	case err != nil:
+		c.fail("unable to obtain the DMARC record of %s: %v", c.domain, err)
+		return
+	case len(records) == 0:
+		c.warn("%s has no DMARC record, the mails may be marked as spam", c.domain)
+		return
+	case len(records) > 1:
+		c.fail("%s has %d DMARC records, receivers will ignore them", domain, len(records))
+		return
+	}
+	tags := dmarcTags(records[0])
+	policy := tags["p"]
+	if domain != c.domain && tags["sp"] != "" {
+		policy = tags["sp"]
+	}
+	fmt.Printf("DMARC: %s\n", records[0])
+	switch policy {
+	case "none":
+		c.warn("the DMARC policy of %s only monitors the mails, they are delivered even if SPF and DKIM fail", domain)
+	case "quarantine", "reject":
+		fmt.Printf("DMARC policy: %s, mails failing SPF and DKIM alignment will be %s\n", policy,
+			map[string]string{"quarantine": "marked as spam", "reject": "rejected"}[policy])
+	default:
+		c.fail("invalid DMARC policy %q in the record of %s", policy, domain)
+	}
+}
+
+// RunDNSChecks checks the DNS records of the sender domain that affect the mail deliverability:
+// MX, SPF (authorising the SMTP host), DKIM and DMARC
+func RunDNSChecks(ctx context.Context, settings *apps.SMTPSettings, options *DNSOptions) error {
+	from, err := settings.FromAddress()
+	if err != nil {
+		return errors.Errorf("invalid sender: %v", err)
+	}
+	c := &dnsChecks{ctx: ctx, resolver: options.resolver(), domain: domain(from.Address)}
+	if c.domain == "" {
+		return errors.Errorf("unable to obtain the domain of the sender %q, set the sender using '-mail_from' flag", from.Address)
+	}
+	fmt.Printf("Sender domain: %s\n", c.domain)
+	c.checkMX()
+	c.checkSPF(settings.Host)
+	c.checkDKIM(options.DKIMSelectors)
+	c.checkDMARC()
+	if c.errors == nil {
+		fmt.Println("DNS records of the sender domain are valid!")
+	}
+	return c.errors
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testZone contains the records of the test DNS server, by name and type
+type testZone map[string]map[dnsmessage.Type][]string
+
+// startTestDNSServer starts a DNS server on a random local port that answers with the records of the zone
+func startTestDNSServer(t *testing.T, zone testZone) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if response, err := answer(zone, buf[:n]); err == nil {
+				conn.WriteTo(response, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func answer(zone testZone, request []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(request)
+	if err != nil {
+		return nil, err
+	}
+	question, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+	name := strings.ToLower(strings.TrimSuffix(question.Name.String(), "."))
+	records, found := zone[name]
+	header.Response, header.Authoritative, header.RecursionAvailable = true, true, true
+	if !found {
+		header.RCode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, header)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(question); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	rh := dnsmessage.ResourceHeader{Name: question.Name, Type: question.Type, Class: dnsmessage.ClassINET, TTL: 60}
+	for _, value := range records[question.Type] {
+		switch question.Type {
+		case dnsmessage.TypeA:
+			ip := net.ParseIP(value).To4()
+			err = b.AResource(rh, dnsmessage.AResource{A: [4]byte{ip[0], ip[1], ip[2], ip[3]}})
+		case dnsmessage.TypeAAAA:
+			var aaaa dnsmessage.AAAAResource
+			copy(aaaa.AAAA[:], net.ParseIP(value).To16())
+			err = b.AAAAResource(rh, aaaa)
+		case dnsmessage.TypeTXT:
+			err = b.TXTResource(rh, dnsmessage.TXTResource{TXT: []string{value}})
+		case dnsmessage.TypeMX:
+			err = b.MXResource(rh, dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName(value + ".")})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+var testDNSZone = testZone{
+	"example.com": {
+		dnsmessage.TypeMX:  {"mx.example.com"},
+		dnsmessage.TypeTXT: {"v=spf1 mx include:_spf.provider.test -all"},
+	},
+	"mx.example.com":                     {dnsmessage.TypeA: {"192.0.2.10"}},
+	"_spf.provider.test":                 {dnsmessage.TypeTXT: {"v=spf1 ip4:198.51.100.0/24 ~all"}},
+	"smtp.provider.test":                 {dnsmessage.TypeA: {"198.51.100.25"}},
+	"smtp.other.test":                    {dnsmessage.TypeA: {"203.0.113.25"}},
+	"email-smtp.us-east-1.amazonaws.com": {dnsmessage.TypeA: {"203.0.113.30"}},
+	"softpolicy.test":                    {dnsmessage.TypeTXT: {"v=spf1 -ip4:203.0.113.0/24 ?all"}},
+	"mail._domainkey.example.com":        {dnsmessage.TypeTXT: {"v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC"}},
+	"_dmarc.example.com":                 {dnsmessage.TypeTXT: {"v=DMARC1; p=quarantine; rua=mailto:dmarc@example.com"}},
+	"monitor.test":                       {dnsmessage.TypeTXT: {"v=spf1 a:smtp.provider.test -all"}},
+	"_dmarc.monitor.test":                {dnsmessage.TypeTXT: {"v=DMARC1; p=none"}},
+	"redirect.test":                      {dnsmessage.TypeTXT: {"v=spf1 redirect=example.com"}},
+	"twice.test":                         {dnsmessage.TypeTXT: {"v=spf1 -all", "v=spf1 +all"}},
+	"loop.test":                          {dnsmessage.TypeTXT: {"v=spf1 include:loop.test -all"}},
+}
+
+func TestEvaluateSPF(t *testing.T) {
+	resolver := (&DNSOptions{Server: startTestDNSServer(t, testDNSZone)}).resolver()
+	tests := []struct {
+		domain   string
+		ip       string
+		expected SPFResult
+	}{
+		{"example.com", "192.0.2.10", SPFPass},
+		{"example.com", "198.51.100.25", SPFPass},
+		{"example.com", "203.0.113.25", SPFFail},
+		{"redirect.test", "198.51.100.25", SPFPass},
+		{"redirect.test", "203.0.113.25", SPFFail},
+		{"twice.test", "203.0.113.25", SPFPermError},
+		{"loop.test", "203.0.113.25", SPFPermError},
+		{"nospf.test", "203.0.113.25", SPFNone},
+	}
+	for _, test := range tests {
+		t.Run("Check SPF of "+test.domain+" for "+test.ip, func(t *testing.T) {
+			result, _ := EvaluateSPF(context.Background(), resolver, test.domain, net.ParseIP(test.ip))
+			if result != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestRunDNSChecks(t *testing.T) {
+	options := &DNSOptions{Server: startTestDNSServer(t, testDNSZone), DKIMSelectors: stringList{"default", "mail"}}
+	tests := []struct {
+		name string
+		host string
+		from string
+		err  string
+	}{
+		{"authorised SMTP host", "smtp.provider.test", "blog@example.com", ""},
+		{"unauthorised SMTP host", "smtp.other.test", "blog@example.com", "does not authorise the SMTP host smtp.other.test"},
+		{"domain with warnings only", "smtp.provider.test", "blog@monitor.test", ""},
+		{"unauthorised provider delivering the mails", "email-smtp.us-east-1.amazonaws.com", "blog@example.com", ""},
+		{"unauthorised SMTP host without -all", "smtp.other.test", "blog@softpolicy.test", ""},
+		{"multiple SPF records", "smtp.provider.test", "blog@twice.test", "twice.test has 2 SPF records"},
+		{"sender without domain", "smtp.provider.test", "", "unable to obtain the domain of the sender"},
+	}
+	for _, test := range tests {
+		t.Run("Check DNS records with "+test.name, func(t *testing.T) {
+			settings := &apps.SMTPSettings{Host: test.host, User: "apikey", From: test.from}
+			err := RunDNSChecks(context.Background(), settings, options)
+			if test.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
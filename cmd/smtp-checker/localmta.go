@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// defaultSendmailPath is the sendmail command used by PHP when sendmail_path is not set
+const defaultSendmailPath = "/usr/sbin/sendmail -t -i"
+
+// LocalMTAOptions configures the checks of the local MTA used by PHP mail() and sendmail
+type LocalMTAOptions struct {
+	PHPIni  string
+	Enabled bool
+	// Sendmail is the sendmail command run by the application, if it does not use the PHP one
+	Sendmail string
+}
+
+// NewLocalMTAOptionsFromFlags creates a LocalMTAOptions from the provided command line flags
+func NewLocalMTAOptionsFromFlags(fs *flag.FlagSet) *LocalMTAOptions {
+	options := LocalMTAOptions{}
+	fs.StringVar(&options.PHPIni, "php_ini", "", "php.ini file with the sendmail_path used by PHP mail() (by default, the one of the stack)")
+	fs.BoolVar(&options.Enabled, "local_mta", false, "Check the local MTA used by PHP mail() even when the application uses SMTP")
+	return &options
+}
+
+// phpIniCandidates returns the usual locations of php.ini, starting with the one of the stack
+func phpIniCandidates(installDir string) []string {
+	candidates := []string{
+		filepath.Join(installDir, "php/etc/php.ini"),
+		"/etc/php.ini",
+		"/usr/local/etc/php/php.ini",
+	}
+	for _, sapi := range []string{"fpm", "apache2", "cli"} {
+		matches, _ := filepath.Glob(filepath.Join("/etc/php/*", sapi, "php.ini"))
+		candidates = append(candidates, matches...)
+	}
+	return candidates
+}
+
+// findPHPIni returns the first php.ini found
+func findPHPIni(installDir string) (string, bool) {
+	for _, file := range phpIniCandidates(installDir) {
+		if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+var sendmailPathRe = regexp.MustCompile(`^\s*sendmail_path\s*=\s*(.*?)\s*$`)
+
+// readSendmailPath reads the sendmail_path setting from a php.ini file. It returns an empty
+// string when it is not set
+func readSendmailPath(phpIni string) (string, error) {
+	f, err := os.Open(phpIni)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	value := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		matches := sendmailPathRe.FindStringSubmatch(scanner.Text())
+		if matches == nil {
+			continue
+		}
+		value = matches[1]
+		if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'") {
+			if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+				value = value[1 : end+1]
+			}
+		} else if i := strings.IndexByte(value, ';'); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+	}
+	return value, scanner.Err()
+}
+
+// checkSendmailBinary checks the binary of a sendmail command exists and is executable, and
+// returns its path with the symbolic links resolved
+func checkSendmailBinary(command string) (string, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return "", errors.New("empty sendmail command")
+	}
+	binary := fields[0]
+	if !filepath.IsAbs(binary) {
+		path, err := exec.LookPath(binary)
+		if err != nil {
+			return "", errors.Errorf("sendmail binary %q not found in the PATH", binary)
+		}
+		binary = path
+	}
+	info, err := os.Stat(binary)
+	if os.IsNotExist(err) {
+		return "", errors.Errorf("sendmail binary %q not found, install a MTA (e.g. postfix) or fix sendmail_path", binary)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() || info.Mode()&0111 == 0 {
+		return "", errors.Errorf("sendmail binary %q is not executable", binary)
+	}
+	resolved, err := filepath.EvalSymlinks(binary)
+	if err != nil {
+		return binary, nil
+	}
+	return resolved, nil
+}
+
+// MailQueue is the status of the local mail queue
+type MailQueue struct {
+	Messages int
+	// Deferred counts the messages by the reason their delivery was deferred
+	Deferred map[string]int
+}
+
+var (
+	// Postfix: "-- 3 Kbytes in 2 Requests."
+	postfixQueueRe = regexp.MustCompile(`in (\d+) Requests?\.`)
+	// Sendmail: "Total requests: 2"
+	sendmailQueueRe = regexp.MustCompile(`Total requests: (\d+)`)
+	// Exim: " 4h  1.2K 1kX9Yz-000123-AB <sender@example.com>"
+	eximQueueRe = regexp.MustCompile(`^\s*\d+[smhdw]\s+\S+\s+\w+-\w+-\w+\s`)
+)
+
+// parseMailQueue parses the output of mailq, as printed by Postfix, Sendmail and Exim. The
+// deferral reasons are the lines between parentheses
+func parseMailQueue(out string) MailQueue {
+	queue := MailQueue{Deferred: map[string]int{}}
+	exim := 0
+	for _, line := range strings.Split(out, "\n") {
+		if matches := postfixQueueRe.FindStringSubmatch(line); matches != nil {
+			queue.Messages, _ = strconv.Atoi(matches[1])
+		}
+		if matches := sendmailQueueRe.FindStringSubmatch(line); matches != nil {
+			queue.Messages, _ = strconv.Atoi(matches[1])
+		}
+		if eximQueueRe.MatchString(line) {
+			exim++
+		}
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "(") && strings.HasSuffix(line, ")") {
+			queue.Deferred[strings.TrimSpace(line[1:len(line)-1])]++
+		}
+	}
+	if queue.Messages == 0 {
+		queue.Messages = exim
+	}
+	return queue
+}
+
+// obtainSendmailPath returns the sendmail command of PHP mail(), read from the sendmail_path of php.ini
+func obtainSendmailPath(installDir string, options *LocalMTAOptions) (string, error) {
+	phpIni, found := options.PHPIni, options.PHPIni != ""
+	if !found {
+		phpIni, found = findPHPIni(installDir)
+	}
+	sendmailPath := ""
+	if found {
+		var err error
+		if sendmailPath, err = readSendmailPath(phpIni); err != nil {
+			return "", errors.Errorf("error reading %s: %v", phpIni, err)
+		}
+		fmt.Printf("Reading PHP configuration file: %q\n", phpIni)
+	} else {
+		fmt.Println("Warning: php.ini not found, set it using '-php_ini' flag")
+	}
+	if sendmailPath == "" {
+		sendmailPath = defaultSendmailPath
+		fmt.Printf("sendmail_path not set, PHP uses the default one: %q\n", sendmailPath)
+	} else {
+		fmt.Printf("sendmail_path: %q\n", sendmailPath)
+	}
+	return sendmailPath, nil
+}
+
+// RunLocalMTAChecks checks the local MTA used by PHP mail() or the application: the sendmail
+// command, its binary and the messages stuck in the local mail queue
+func RunLocalMTAChecks(ctx context.Context, installDir string, options *LocalMTAOptions) error {
+	sendmailPath := options.Sendmail
+	if sendmailPath == "" {
+		var err error
+		if sendmailPath, err = obtainSendmailPath(installDir, options); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Sendmail command of the application: %q\n", sendmailPath)
+	}
+	binary, err := checkSendmailBinary(sendmailPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Sendmail binary: %q\n", binary)
+
+	out, err := runCommand(ctx, "mailq")
+	if err != nil {
+		fmt.Printf("Warning: unable to inspect the local mail queue: %v\n", err)
+		return nil
+	}
+	queue := parseMailQueue(string(out))
+	if queue.Messages == 0 {
+		fmt.Println("Local mail queue is empty!")
+		return nil
+	}
+	fmt.Printf("%d messages in the local mail queue\n", queue.Messages)
+	if len(queue.Deferred) == 0 {
+		fmt.Println("Warning: no deferral reasons found, the messages may still be in transit")
+		return nil
+	}
+	reasons := make([]string, 0, len(queue.Deferred))
+	for reason := range queue.Deferred {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	fmt.Println("Deferral reasons:")
+	for _, reason := range reasons {
+		fmt.Printf("  - %s (%d messages)\n", reason, queue.Deferred[reason])
+	}
+	return errors.Errorf("%d messages stuck in the local mail queue, run 'mailq' for details", queue.Messages)
+}
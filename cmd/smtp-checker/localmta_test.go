@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const postfixQueue = `-Queue ID-  --Size-- ----Arrival Time---- -Sender/Recipient-------
+3F1A2B3C4D      1234 Mon Oct 19 10:00:00  wordpress@example.com
+(connect to mx.example.com[192.0.2.1]:25: Connection timed out)
+                                         user@example.com
+
+4A2B3C4D5E      1301 Mon Oct 19 10:05:00  wordpress@example.com
+(connect to mx.example.com[192.0.2.1]:25: Connection timed out)
+                                         admin@example.com
+
+-- 3 Kbytes in 2 Requests.
+`
+
+const sendmailQueue = `		/var/spool/mqueue (1 request)
+-----Q-ID----- --Size-- -----Q-Time----- ------------Sender/Recipient-----------
+x9JA0b3C012345     1234 Mon Oct 19 10:00 <wordpress@example.com>
+                 (Deferred: Connection refused by mx.example.com.)
+					 <user@example.com>
+		Total requests: 1
+`
+
+const eximQueue = ` 4h  1.2K 1kX9Yz-000123-AB <wordpress@example.com>
+          user@example.com
+
+ 2m  1.1K 1kX9Za-000124-AC <wordpress@example.com>
+          admin@example.com
+`
+
+func TestParseMailQueue(t *testing.T) {
+	tests := []struct {
+		name     string
+		out      string
+		expected MailQueue
+	}{
+		{"empty Postfix", "Mail queue is empty\n", MailQueue{0, map[string]int{}}},
+		{"Postfix", postfixQueue, MailQueue{2, map[string]int{"connect to mx.example.com[192.0.2.1]:25: Connection timed out": 2}}},
+		{"empty Sendmail", "/var/spool/mqueue is empty\n\t\tTotal requests: 0\n", MailQueue{0, map[string]int{}}},
+		{"Sendmail", sendmailQueue, MailQueue{1, map[string]int{"Deferred: Connection refused by mx.example.com.": 1}}},
+		{"Exim", eximQueue, MailQueue{2, map[string]int{}}},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Parse %s mail queue", test.name), func(t *testing.T) {
+			if queue := parseMailQueue(test.out); !reflect.DeepEqual(queue, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, queue)
+			}
+		})
+	}
+}
+
+func TestReadSendmailPath(t *testing.T) {
+	tests := []struct {
+		ini      string
+		expected string
+	}{
+		{"[mail function]\nsendmail_path = /usr/sbin/sendmail -t -i\n", "/usr/sbin/sendmail -t -i"},
+		{"sendmail_path = \"/usr/bin/msmtp -t\" ; msmtp\n", "/usr/bin/msmtp -t"},
+		{"sendmail_path=/usr/sbin/sendmail -t ; comment\n", "/usr/sbin/sendmail -t"},
+		{";sendmail_path =\n", ""},
+		{"sendmail_path = /a\nsendmail_path = /b\n", "/b"},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Read sendmail_path from %q", test.ini), func(t *testing.T) {
+			phpIni := filepath.Join(t.TempDir(), "php.ini")
+			if err := os.WriteFile(phpIni, []byte(test.ini), 0644); err != nil {
+				t.Fatal(err)
+			}
+			value, err := readSendmailPath(phpIni)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if value != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, value)
+			}
+		})
+	}
+}
+
+// withMailQueue replaces the output of mailq until the test finishes
+func withMailQueue(t *testing.T, out string) {
+	previous := runCommand
+	t.Cleanup(func() { runCommand = previous })
+	runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name != "mailq" {
+			return nil, os.ErrNotExist
+		}
+		return []byte(out), nil
+	}
+}
+
+func TestRunLocalMTAChecks(t *testing.T) {
+	installDir := t.TempDir()
+	sendmail := filepath.Join(installDir, "sendmail")
+	if err := os.WriteFile(sendmail, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	notExecutable := filepath.Join(installDir, "not-executable")
+	if err := os.WriteFile(notExecutable, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(installDir, "php/etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		sendmailPath string
+		queue        string
+		err          string
+	}{
+		{sendmail + " -t -i", "Mail queue is empty\n", ""},
+		{sendmail + " -t -i", postfixQueue, "2 messages stuck in the local mail queue"},
+		{sendmail + " -t -i", "-- 1 Kbytes in 1 Request.\n", ""},
+		{filepath.Join(installDir, "missing") + " -t -i", "", "not found"},
+		{notExecutable, "", "is not executable"},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Check local MTA with sendmail_path %q", test.sendmailPath), func(t *testing.T) {
+			ini := fmt.Sprintf("[mail function]\nsendmail_path = %q\n", test.sendmailPath)
+			if err := os.WriteFile(filepath.Join(installDir, "php/etc/php.ini"), []byte(ini), 0644); err != nil {
+				t.Fatal(err)
+			}
+			withMailQueue(t, test.queue)
+			err := RunLocalMTAChecks(context.Background(), installDir, &LocalMTAOptions{})
+			if test.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+	t.Run("Check the sendmail command of the application", func(t *testing.T) {
+		withMailQueue(t, "Mail queue is empty\n")
+		options := &LocalMTAOptions{PHPIni: filepath.Join(installDir, "missing.ini"), Sendmail: notExecutable + " -i"}
+		if err := RunLocalMTAChecks(context.Background(), installDir, options); err == nil || !strings.Contains(err.Error(), "is not executable") {
+			t.Errorf("expected not executable error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/juju/errors"
+)
+
+// pollInterval is the time between mailbox checks while waiting for the testing mail
+var pollInterval = 5 * time.Second
+
+// defaultMailboxPorts are the ports of each mailbox URL scheme
+var defaultMailboxPorts = map[string]int{"imap": 143, "imaps": 993, "pop3": 110, "pop3s": 995}
+
+// spamFolderRe matches the names of the folders where the mail providers store the spam
+var spamFolderRe = regexp.MustCompile(`(?i)(spam|junk|bulk)`)
+
+// MailboxOptions configures the end-to-end delivery check
+type MailboxOptions struct {
+	URL      string
+	Password string
+	Timeout  time.Duration
+}
+
+// NewMailboxOptionsFromFlags creates a MailboxOptions from the provided command line flags
+func NewMailboxOptionsFromFlags(fs *flag.FlagSet) *MailboxOptions {
+	options := MailboxOptions{}
+	fs.StringVar(&options.URL, "mailbox", "", "Mailbox of the recipient to check the delivery, e.g. imaps://user@imap.example.com or pop3s://user@pop.example.com")
+	fs.StringVar(&options.Password, "mailbox_password", "", "Password of the mailbox (it can also be set in the mailbox URL)")
+	fs.DurationVar(&options.Timeout, "delivery_timeout", 2*time.Minute, "Time to wait for the testing mail to arrive to the mailbox")
+	return &options
+}
+
+// validateTimeout checks the testing mail can arrive before the global timeout. The delivery check
+// runs after the other checks, so it needs a shorter timeout to complete
+func (o *MailboxOptions) validateTimeout(globalTimeout time.Duration) error {
+	if o.URL == "" || globalTimeout == 0 {
+		return nil
+	}
+	if o.Timeout >= globalTimeout {
+		return errors.Errorf("the delivery timeout (%s) must be lower than the global timeout (%s), use -delivery_timeout and -global_timeout flags to set them", o.Timeout, globalTimeout)
+	}
+	return nil
+}
+
+// mailbox contains the connection data of a mailbox
+type mailbox struct {
+	protocol string
+	tls      bool
+	host     string
+	port     int
+	user     string
+	password string
+}
+
+// parseMailbox parses a mailbox URL. The password of the options, if any, takes precedence
+func parseMailbox(options *MailboxOptions) (*mailbox, error) {
+	u, err := url.Parse(options.URL)
+	if err != nil {
+		return nil, errors.Errorf("invalid mailbox URL: %v", err)
+	}
+	port, ok := defaultMailboxPorts[u.Scheme]
+	if !ok {
+		return nil, errors.Errorf("invalid mailbox URL scheme %q (use imap, imaps, pop3 or pop3s)", u.Scheme)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, errors.New("the mailbox URL does not include the user")
+	}
+	m := &mailbox{
+		protocol: strings.TrimSuffix(u.Scheme, "s"),
+		tls:      strings.HasSuffix(u.Scheme, "s"),
+		host:     u.Hostname(),
+		port:     port,
+		user:     u.User.Username(),
+		password: options.Password,
+	}
+	if u.Port() != "" {
+		if m.port, err = strconv.Atoi(u.Port()); err != nil {
+			return nil, errors.Errorf("invalid mailbox port %q", u.Port())
+		}
+	}
+	if password, ok := u.User.Password(); ok && m.password == "" {
+		m.password = password
+	}
+	return m, nil
+}
+
+// dial connects to the mailbox server, using implicit TLS if required. Without it, the connection
+// is upgraded with STARTTLS (IMAP) or STLS (POP3) after reading the greeting. The connection is
+// aborted when the context is done
+func (m *mailbox) dial(ctx context.Context) (net.Conn, *textproto.Conn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(m.host, strconv.Itoa(m.port)))
+	if err != nil {
+		return nil, nil, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	if m.tls {
+		tlsConn := tls.Client(conn, tlsConfig(m.host))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			stop()
+			conn.Close()
+			return nil, nil, err
+		}
+		conn = tlsConn
+	}
+	return &stoppableConn{Conn: conn, stop: stop}, textproto.NewConn(conn), nil
+}
+
+// stoppableConn stops watching the context when the connection is closed
+type stoppableConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func (c *stoppableConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
+
+// upgrade upgrades a plain connection to TLS
+func (m *mailbox) upgrade(ctx context.Context, conn net.Conn) (*textproto.Conn, error) {
+	tlsConn := tls.Client(conn, tlsConfig(m.host))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return textproto.NewConn(tlsConn), nil
+}
+
+// imapClient is a minimal IMAP client to look for the testing mail
+type imapClient struct {
+	text *textproto.Conn
+	tag  int
+}
+
+// imapQuote quotes an IMAP string
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// cmd sends a command and returns the untagged responses
+func (c *imapClient) cmd(format string, args ...interface{}) ([]string, error) {
+	c.tag++
+	tag := fmt.Sprintf("A%03d", c.tag)
+	if err := c.text.PrintfLine("%s %s", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+	untagged := []string{}
+	for {
+		line, err := c.text.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, tag+" ") {
+			untagged = append(untagged, line)
+			continue
+		}
+		status := strings.TrimPrefix(line, tag+" ")
+		if !strings.HasPrefix(strings.ToUpper(status), "OK") {
+			return nil, errors.Errorf("IMAP server error: %s", status)
+		}
+		return untagged, nil
+	}
+}
+
+var imapListRe = regexp.MustCompile(`^\* LIST \(([^)]*)\) (?:"[^"]*"|NIL) (.+)$`)
+
+// folders returns the folders to look for the testing mail: the inbox and the spam folders
+func (c *imapClient) folders() (map[string]bool, error) {
+	lines, err := c.cmd(`LIST "" "*"`)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]bool{"INBOX": false}
+	for _, line := range lines {
+		matches := imapListRe.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		name := strings.Trim(matches[2], `"`)
+		if strings.Contains(matches[1], `\Junk`) || spamFolderRe.MatchString(name) {
+			res[name] = true
+		}
+	}
+	return res, nil
+}
+
+// findIMAP looks for a mail with the token in the subject in the inbox and spam folders
+func (m *mailbox) findIMAP(ctx context.Context, token string) (string, bool, error) {
+	conn, text, err := m.dial(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	defer conn.Close()
+	c := &imapClient{text: text}
+	if _, err := text.ReadLine(); err != nil {
+		return "", false, err
+	}
+	if !m.tls {
+		if _, err := c.cmd("STARTTLS"); err != nil {
+			return "", false, err
+		}
+		if c.text, err = m.upgrade(ctx, conn); err != nil {
+			return "", false, err
+		}
+	}
+	if _, err := c.cmd("LOGIN %s %s", imapQuote(m.user), imapQuote(m.password)); err != nil {
+		return "", false, err
+	}
+	defer c.cmd("LOGOUT")
+	folders, err := c.folders()
+	if err != nil {
+		return "", false, err
+	}
+	for folder, spam := range folders {
+		if _, err := c.cmd("EXAMINE %s", imapQuote(folder)); err != nil {
+			continue
+		}
+		lines, err := c.cmd("SEARCH SUBJECT %s", imapQuote(token))
+		if err != nil {
+			return "", false, err
+		}
+		for _, line := range lines {
+			if strings.HasPrefix(line, "* SEARCH ") && len(strings.Fields(line)) > 2 {
+				return folder, spam, nil
+			}
+		}
+	}
+	return "", false, nil
+}
+
+// pop3Cmd sends a POP3 command and returns the status line
+func pop3Cmd(text *textproto.Conn, format string, args ...interface{}) (string, error) {
+	if err := text.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+	return pop3Response(text)
+}
+
+func pop3Response(text *textproto.Conn) (string, error) {
+	line, err := text.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return "", errors.Errorf("POP3 server error: %s", line)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, "+OK")), nil
+}
+
+// pop3MaxMessages is the number of most recent messages whose headers are checked
+const pop3MaxMessages = 50
+
+// findPOP3 looks for a mail with the token in the subject in the inbox, the only folder available with POP3
+func (m *mailbox) findPOP3(ctx context.Context, token string) (string, bool, error) {
+	conn, text, err := m.dial(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	defer conn.Close()
+	if _, err := pop3Response(text); err != nil {
+		return "", false, err
+	}
+	if !m.tls {
+		if _, err := pop3Cmd(text, "STLS"); err != nil {
+			return "", false, err
+		}
+		if text, err = m.upgrade(ctx, conn); err != nil {
+			return "", false, err
+		}
+	}
+	if _, err := pop3Cmd(text, "USER %s", m.user); err != nil {
+		return "", false, err
+	}
+	if _, err := pop3Cmd(text, "PASS %s", m.password); err != nil {
+		return "", false, err
+	}
+	defer pop3Cmd(text, "QUIT")
+	stat, err := pop3Cmd(text, "STAT")
+	if err != nil {
+		return "", false, err
+	}
+	count, err := strconv.Atoi(strings.Fields(stat + " 0")[0])
+	if err != nil {
+		return "", false, errors.Errorf("unexpected STAT response %q", stat)
+	}
+	for i := count; i > 0 && i > count-pop3MaxMessages; i-- {
+		if _, err := pop3Cmd(text, "TOP %d 0", i); err != nil {
+			return "", false, err
+		}
+		headers, err := text.ReadDotLines()
+		if err != nil {
+			return "", false, err
+		}
+		for _, h := range headers {
+			if strings.HasPrefix(strings.ToLower(h), "subject:") && strings.Contains(h, token) {
+				return "INBOX", false, nil
+			}
+		}
+	}
+	return "", false, nil
+}
+
+// find looks for a mail with the token in the subject, returning the folder where it is found
+// and whether it is a spam folder
+func (m *mailbox) find(ctx context.Context, token string) (string, bool, error) {
+	if m.protocol == "pop3" {
+		return m.findPOP3(ctx, token)
+	}
+	return m.findIMAP(ctx, token)
+}
+
+// RunDeliveryChecks sends a testing mail with a unique token and polls the mailbox of the recipient
+// until it arrives, reporting the delivery latency and whether it landed in the spam folder
+func RunDeliveryChecks(ctx context.Context, settings *apps.SMTPSettings, recipient string, options *MailboxOptions) error {
+	m, err := parseMailbox(options)
+	if err != nil {
+		return err
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	token := "smtp-checker-" + hex.EncodeToString(id)
+	if err := sendMail(ctx, settings, recipient, "Testing Mail "+token); err != nil {
+		return err
+	}
+	sent := time.Now()
+	fmt.Printf("Mail with token %s sent, waiting for it in %s://%s@%s\n", token, m.protocol, m.user, m.host)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		folder, spam, err := m.find(ctx, token)
+		if err != nil {
+			// The connections time out at the context deadline, maybe right before the context is done
+			if deadline, ok := ctx.Deadline(); ctx.Err() == nil && (!ok || time.Now().Before(deadline)) {
+				return errors.Errorf("unable to check the mailbox: %v", err)
+			}
+			<-ctx.Done()
+		}
+		if folder != "" {
+			latency := time.Since(sent).Round(time.Millisecond)
+			if spam {
+				return errors.Errorf("mail delivered to the spam folder %q after %s", folder, latency)
+			}
+			fmt.Printf("Mail delivered to %s after %s\n", folder, latency)
+			if m.protocol == "pop3" {
+				fmt.Println("Note: POP3 only gives access to the inbox, use IMAP to check the spam folders")
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("mail not delivered after %s", time.Since(sent).Round(time.Second))
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,36 +1,163 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
-	"github.com/mkmik/multierror"
+	// Supported applications
+	_ "github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps/drupal"
+	_ "github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps/redmine"
+	_ "github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps/wordpress"
 )
 
-const defaultRecipient = "test@example.com"
+const (
+	defaultRecipient     = "test@example.com"
+	defaultCheckTimeout  = 10 * time.Second
+	defaultGlobalTimeout = 5 * time.Minute
+)
 
 // These variables will be overwritten automatically by the build system
 var VERSION = "devel"
 var BUILD_DATE = ""
 var COMMIT = ""
 
+// listApplications prints the supported applications and whether they are installed in a directory
+func listApplications(installDir string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "APPLICATION\tALIASES\tINSTALLED")
+	for _, app := range apps.Applications() {
+		installed := "no"
+		if configFile, layout, ok := app.Find(installDir); ok {
+			installed = fmt.Sprintf("%s (%s)", configFile, layout.Name)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", app.Name, strings.Join(app.Aliases, ", "), installed)
+	}
+	w.Flush()
+}
+
+// detectApplication returns the name of the application installed in a directory, or an empty
+// string when there is none
+func detectApplication(installDir string) (string, error) {
+	detected := apps.Detect(installDir)
+	switch len(detected) {
+	case 0:
+		return "", nil
+	case 1:
+		return detected[0].Name, nil
+	}
+	var names []string
+	for _, app := range detected {
+		names = append(names, app.Name)
+	}
+	return "", fmt.Errorf("several applications found in %q (%s), choose one using '-application' flag", installDir, strings.Join(names, ", "))
+}
+
+// isFlagSet reports whether a flag was set in the command line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// checkTarget is a configuration to check: its SMTP settings, or the local MTA or the provider API
+// the application uses instead of SMTP
+type checkTarget struct {
+	// sites are the sites sharing the configuration, on installations with several sites
+	sites       []string
+	smtp        *apps.SMTPSettings
+	localMailer apps.Mailer
+	sendmail    string
+	apiRequest  *apps.APIRequest
+	// invalid is the error found when validating the SMTP settings
+	invalid error
+}
+
+// siteConfigs returns the distinct configurations of the sites of an application
+func siteConfigs(appConfig apps.ApplicationConfig) []apps.SiteConfig {
+	if config, ok := appConfig.(apps.MultiSiteConfig); ok {
+		return config.SiteConfigs()
+	}
+	return []apps.SiteConfig{{Config: appConfig}}
+}
+
+// newCheckTarget obtains what to check from the configuration of the sites. The connection security,
+// authentication and sender set with flags take precedence over the ones of the application
+func newCheckTarget(site apps.SiteConfig, flags *apps.SMTPSettings) *checkTarget {
+	target := &checkTarget{sites: site.Sites}
+	if config, ok := site.Config.(apps.APIConfig); ok && config.APIRequest() != nil {
+		target.apiRequest = config.APIRequest()
+		fmt.Printf("The application is configured to send mails using the %s API instead of SMTP, its credentials will be checked\n", target.apiRequest.Provider)
+		return target
+	}
+	if config, ok := site.Config.(apps.MailerConfig); ok && config.Mailer().Local() {
+		target.localMailer = config.Mailer()
+		if config, ok := site.Config.(apps.SendmailConfig); ok {
+			target.sendmail = config.SendmailCommand()
+		}
+		fmt.Printf("The application is configured to send mails using the %q mailer instead of SMTP, the local MTA will be checked\n", target.localMailer)
+		return target
+	}
+	if target.invalid = site.Config.ValidateSMTPSettings(); target.invalid != nil {
+		return target
+	}
+	target.smtp = site.Config.GetSMTPSettings()
+	if isFlagSet("smtp_security") {
+		target.smtp.Security = flags.Security
+	}
+	if isFlagSet("smtp_auth") {
+		target.smtp.Auth = flags.Auth
+	}
+	if isFlagSet("mail_from") {
+		target.smtp.From = flags.From
+	}
+	fmt.Println("SMTP configuration successfully retrieved!!")
+	return target
+}
+
 func main() {
 	var (
-		installDir   string
-		app          string
-		recipient    string
-		getVersion   bool
-		secureOutput bool
+		installDir     string
+		app            string
+		configFile     string
+		recipient      string
+		getVersion     bool
+		listApps       bool
+		secureOutput   bool
+		transcriptFile string
+		verbose        bool
+		checkTimeout   time.Duration
+		globalTimeout  time.Duration
 	)
 	flag.StringVar(&installDir, "install_dir", "/opt/bitnami", "Installation Directory")
-	flag.StringVar(&app, "application", "", "Application")
+	flag.StringVar(&app, "application", "", "Application (by default, the one installed in the installation directory)")
+	flag.StringVar(&configFile, "config_file", "", "Configuration file of the application (by default, it is searched in the known layouts)")
+	flag.BoolVar(&listApps, "list_applications", false, "List the supported applications")
 	flag.StringVar(&recipient, "mail_recipient", defaultRecipient, fmt.Sprintf("Mail Recipient (%s by default)", defaultRecipient))
 	flag.BoolVar(&getVersion, "version", false, "Show current version")
 	flag.BoolVar(&secureOutput, "secure_output", false, "Hide SMTP password in output")
+	flag.StringVar(&transcriptFile, "transcript", "", "Write a transcript of the SMTP sessions to this file")
+	flag.BoolVar(&verbose, "verbose", false, "Print a transcript of the SMTP sessions")
+	flag.DurationVar(&checkTimeout, "timeout", defaultCheckTimeout, "Timeout of each check")
+	flag.DurationVar(&globalTimeout, "global_timeout", defaultGlobalTimeout, "Timeout of all the checks (0 to disable it)")
 	smtp := apps.NewSMTPSettingsFromFlags(flag.CommandLine)
+	ntpOptions := NewNTPOptionsFromFlags(flag.CommandLine)
+	dnsOptions := NewDNSOptionsFromFlags(flag.CommandLine)
+	mailboxOptions := NewMailboxOptionsFromFlags(flag.CommandLine)
+	localMTAOptions := NewLocalMTAOptionsFromFlags(flag.CommandLine)
 	flag.Parse()
 
 	if getVersion {
@@ -40,6 +167,31 @@ func main() {
 		os.Exit(0)
 	}
 
+	if listApps {
+		listApplications(installDir)
+		os.Exit(0)
+	}
+
+	if err := mailboxOptions.validateTimeout(globalTimeout); err != nil {
+		log.Fatal(err)
+	}
+
+	// The application is detected only when the SMTP settings are not provided with flags
+	if app == "" && configFile != "" {
+		log.Fatalf("Indicate the application of the configuration file using '-application' flag")
+	}
+	if app == "" && !isFlagSet("smtp_host") {
+		detected, err := detectApplication(installDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if detected != "" {
+			fmt.Printf("Detected application %q in %q\n", detected, installDir)
+			app = detected
+		}
+	}
+
+	targets := []*checkTarget{{smtp: smtp}}
 	if app != "" {
 		fmt.Printf(`======================================
 SMTP CONFIGURATION
@@ -49,19 +201,21 @@ Obtaining SMTP configuration for app: %q
 
 `, app, installDir)
 
-		appConfig, err := ObtainConfigData(installDir, app)
+		appConfig, err := ObtainConfigData(installDir, app, configFile)
 		if err != nil {
 			log.Fatalf("Found errors when obtaining the SMTP configuration: %q", err)
 		}
-		err = appConfig.ValidateSMTPSettings()
-		if err != nil {
-			log.Fatalf("Found errors when validating the SMTP settings: %q", err)
+		sites := siteConfigs(appConfig)
+		targets = nil
+		for _, site := range sites {
+			target := newCheckTarget(site, smtp)
+			// With several sites, the invalid settings of one of them are reported with the checks
+			if target.invalid != nil && len(sites) == 1 {
+				log.Fatalf("Found errors when validating the SMTP settings: %q", target.invalid)
+			}
+			targets = append(targets, target)
 		}
-		smtp = appConfig.GetSMTPSettings()
-		fmt.Println("SMTP configuration successfully retrieved!!")
-	}
-
-	if smtp.Host == "" || smtp.Port == 0 || smtp.User == "" || smtp.Pass == "" {
+	} else if smtp.Host == "" || smtp.Port == 0 || (smtp.Auth != apps.AuthNone && (smtp.User == "" || smtp.Pass == "")) {
 		log.Fatalf("Indicate your application using '-application' flag or set the smtp credentials using 'smtp-host', 'smtp-port', '-smtp-user' and '-smtp-password' flags")
 	}
 
@@ -70,53 +224,161 @@ Obtaining SMTP configuration for app: %q
 		recipientText = fmt.Sprintf("%s (invalid mail account, use -mail_recipient lag to indicate a valid one)", defaultRecipient)
 	}
 
-	passwordOutput := "xxxxxx"
-	if !secureOutput {
-		passwordOutput = smtp.Pass
-	}
-
 	fmt.Printf(`
 ======================================
 SMTP CHECKS
 ======================================
-Using SMTP credentials:
+`)
+
+	var transcriptWriters []io.Writer
+	if transcriptFile != "" {
+		f, err := os.Create(transcriptFile)
+		if err != nil {
+			log.Fatalf("Unable to create the transcript file: %q", err)
+		}
+		defer f.Close()
+		transcriptWriters = append(transcriptWriters, f)
+	}
+	if verbose {
+		transcriptWriters = append(transcriptWriters, os.Stdout)
+	}
+	if len(transcriptWriters) > 0 {
+		transcript = NewTranscript(io.MultiWriter(transcriptWriters...))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if globalTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, globalTimeout)
+		defer cancel()
+	}
+	checks := &checkRunner{ctx: ctx, timeout: checkTimeout}
+
+	// The clock of the host is the same for every site
+	checks.run("server time offset", func(ctx context.Context) error {
+		return RunNTPChecks(ctx, ntpOptions)
+	})
+
+	localMTAChecked := false
+	for _, target := range targets {
+		if len(target.sites) > 0 {
+			fmt.Printf("\n== Configuration of the sites: %s ==\n", strings.Join(target.sites, ", "))
+		}
+		if target.invalid != nil {
+			checks.run("SMTP settings", func(ctx context.Context) error {
+				return target.invalid
+			})
+			continue
+		}
+		if target.apiRequest != nil {
+			fmt.Printf("Checking the credentials of the %s API\n\n", target.apiRequest.Provider)
+			checks.run("Mail provider API credentials", func(ctx context.Context) error {
+				return RunAPIChecks(ctx, target.apiRequest)
+			})
+			continue
+		}
+		if target.localMailer != "" {
+			fmt.Printf("Checking the local MTA used by the %q mailer\n\n", target.localMailer)
+			localMTAOptions.Sendmail = target.sendmail
+			checks.run("Local MTA used by PHP mail() and sendmail", func(ctx context.Context) error {
+				return RunLocalMTAChecks(ctx, installDir, localMTAOptions)
+			})
+			localMTAChecked = true
+			continue
+		}
+
+		smtp := target.smtp
+		if smtp.Security == "" {
+			smtp.Security = apps.SecurityForPort(smtp.Port)
+		}
+
+		securityOutput := string(smtp.Security)
+		if securityOutput == "" {
+			securityOutput = "STARTTLS if offered by the server"
+		}
+
+		fromOutput := smtp.From
+		if fromOutput == "" {
+			fromOutput = smtp.User
+		}
+
+		authOutput := string(smtp.Auth)
+		if authOutput == "" {
+			authOutput = "negotiated with the server"
+		}
+
+		passwordOutput := "xxxxxx"
+		if !secureOutput {
+			passwordOutput = smtp.Pass
+		}
+
+		fmt.Printf(`Using SMTP credentials:
   - SMTP Host: %q
   - SMTP Port: %d
   - SMTP User: %q
   - SMTP Password: %q
+  - SMTP Security: %q
+  - SMTP Authentication: %q
+  - Mail Sender: %q
   - Mail Recipient: %q
 
-`, smtp.Host, smtp.Port, smtp.User, passwordOutput, recipientText)
+`, smtp.Host, smtp.Port, smtp.User, passwordOutput, securityOutput, authOutput, fromOutput, recipientText)
 
-	var errors error
+		checks.run("SMTP provider settings", func(ctx context.Context) error {
+			return RunProviderChecks(smtp)
+		})
 
-	fmt.Println("-- Check: Connectivity with SMTP server --")
-	err := RunConnectivityChecks(smtp.Host, smtp.Port)
-	if err != nil {
-		errors = multierror.Append(errors, err)
-	}
-
-	if smtp.Port == 465 {
-		fmt.Println("-- Check: Connectivity with SMTP server via TLS --")
-		err = RunTLSConnectivityChecks(smtp.Host, smtp.Port)
+		err := checks.run("Connectivity with SMTP server", func(ctx context.Context) error {
+			return RunConnectivityChecks(ctx, smtp.Host, smtp.Port)
+		})
 		if err != nil {
-			errors = multierror.Append(errors, err)
+			checks.run("Alternative SMTP ports", func(ctx context.Context) error {
+				return RunAlternativePortsChecks(ctx, smtp.Host, smtp.Port)
+			})
 		}
-	}
 
-	fmt.Println("-- Check: server time offset --")
-	err = RunNTPChecks()
-	if err != nil {
-		errors = multierror.Append(errors, err)
-	}
+		switch smtp.Security {
+		case apps.SecurityImplicitTLS:
+			checks.run("Connectivity with SMTP server via TLS", func(ctx context.Context) error {
+				return RunTLSConnectivityChecks(ctx, smtp.Host, smtp.Port)
+			})
+		case apps.SecuritySTARTTLS, "":
+			checks.run("STARTTLS upgrade with SMTP server", func(ctx context.Context) error {
+				return RunSTARTTLSChecks(ctx, smtp)
+			})
+		}
+
+		checks.run("SMTP authentication", func(ctx context.Context) error {
+			return RunAuthChecks(ctx, smtp)
+		})
+
+		checks.run("Mail sender", func(ctx context.Context) error {
+			return RunSenderChecks(smtp)
+		})
+
+		checks.run("DNS records of the sender domain", func(ctx context.Context) error {
+			return RunDNSChecks(ctx, smtp, dnsOptions)
+		})
 
-	fmt.Println("-- Check: Send mail via SMTP --")
-	if recipient != defaultRecipient {
-		fmt.Printf("\nNote: Remember to check the recipient's mail inbox!\n")
+		checks.run("Send mail via SMTP", func(ctx context.Context) error {
+			if recipient != defaultRecipient {
+				fmt.Printf("\nNote: Remember to check the recipient's mail inbox!\n")
+			}
+			return RunSendMailChecks(ctx, smtp, recipient)
+		})
+
+		if mailboxOptions.URL != "" {
+			checks.runWithTimeout("Mail delivery to the recipient mailbox", mailboxOptions.Timeout, func(ctx context.Context) error {
+				return RunDeliveryChecks(ctx, smtp, recipient, mailboxOptions)
+			})
+		}
 	}
-	err = RunSendMailChecks(smtp, recipient)
-	if err != nil {
-		errors = multierror.Append(errors, err)
+
+	if localMTAOptions.Enabled && !localMTAChecked {
+		checks.run("Local MTA used by PHP mail() and sendmail", func(ctx context.Context) error {
+			return RunLocalMTAChecks(ctx, installDir, localMTAOptions)
+		})
 	}
 
 	fmt.Printf(`
@@ -125,7 +387,16 @@ SMTP CHECKS FINISHED
 ======================================
 
 `)
-	if errors != nil {
-		log.Fatalf("Found errors when checking the SMTP configuration:\n%v", errors)
+	if transcriptFile != "" {
+		fmt.Printf("SMTP sessions transcript written to %q\n\n", transcriptFile)
+	}
+	switch ctx.Err() {
+	case context.Canceled:
+		log.Fatalf("SMTP checks interrupted, the remaining checks were skipped:\n%v", checks.errors)
+	case context.DeadlineExceeded:
+		log.Fatalf("Global timeout of %s reached, the remaining checks were skipped:\n%v", globalTimeout, checks.errors)
+	}
+	if checks.errors != nil {
+		log.Fatalf("Found errors when checking the SMTP configuration:\n%v", checks.errors)
 	}
 }
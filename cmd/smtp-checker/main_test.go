@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectApplication(t *testing.T) {
+	tests := []struct {
+		files    []string
+		expected string
+		err      string
+	}{
+		{nil, "", ""},
+		{[]string{"apps/wordpress/htdocs/wp-config.php"}, "wordpress", ""},
+		{[]string{"wordpress/wp-config.php"}, "wordpress", ""},
+		{[]string{"apps/redmine/htdocs/config/configuration.yml"}, "redmine", ""},
+		{[]string{"redmine/config/configuration.yml"}, "redmine", ""},
+		{[]string{"drupal/sites/default/settings.php"}, "drupal", ""},
+		{[]string{"apps/drupal/htdocs/sites/default/settings.php"}, "drupal", ""},
+		{[]string{"wordpress/wp-config.php", "redmine/config/configuration.yml"}, "", "several applications found"},
+	}
+	for _, test := range tests {
+		t.Run("Detect application with files "+strings.Join(test.files, ", "), func(t *testing.T) {
+			installDir := t.TempDir()
+			for _, file := range test.files {
+				path := filepath.Join(installDir, file)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			app, err := detectApplication(installDir)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if app != test.expected {
+				t.Errorf("expected application %q, got %q", test.expected, app)
+			}
+		})
+	}
+}
+
+func TestObtainConfigDataFromEnvironment(t *testing.T) {
+	t.Run("Check the environment variables are used when there is no configuration file", func(t *testing.T) {
+		t.Setenv("REDMINE_SMTP_HOST", "smtp.example.com")
+		t.Setenv("REDMINE_SMTP_PORT_NUMBER", "587")
+		appConfig, err := ObtainConfigData(t.TempDir(), "redmine", "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if settings := appConfig.GetSMTPSettings(); settings.Host != "smtp.example.com" || settings.Port != 587 {
+			t.Errorf("unexpected settings: %+v", settings)
+		}
+	})
+	t.Run("Check an error is returned without configuration file nor variables", func(t *testing.T) {
+		if _, err := ObtainConfigData(t.TempDir(), "redmine", ""); err == nil || !strings.Contains(err.Error(), "not found in the known layouts") {
+			t.Errorf("expected configuration file not found error, got %v", err)
+		}
+	})
+}
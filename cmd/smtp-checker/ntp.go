@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/ntp"
+	"github.com/juju/errors"
+	"github.com/mkmik/multierror"
+)
+
+const (
+	defaultNTPServer = "pool.ntp.org"
+	maxClockOffset   = 1 * time.Second
+)
+
+// timesyncSynchronizedFile is created by systemd-timesyncd when the clock is synchronised
+var timesyncSynchronizedFile = "/run/systemd/timesync/synchronized"
+
+// runCommand runs a command and returns its output
+var runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+func absDuration(d time.Duration) time.Duration {
+	return time.Duration(math.Abs(float64(d)))
+}
+
+// stringList is a comma separated list that implements flag.Value
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+// NTPOptions configures the time synchronisation check
+type NTPOptions struct {
+	Servers   stringList
+	MaxOffset time.Duration
+	Skip      bool
+}
+
+// NewNTPOptionsFromFlags creates a NTPOptions from the provided command line flags
+func NewNTPOptionsFromFlags(fs *flag.FlagSet) *NTPOptions {
+	options := NTPOptions{Servers: stringList{defaultNTPServer}}
+	fs.Var(&options.Servers, "ntp_server", "Comma separated list of NTP servers to check the time offset against")
+	fs.DurationVar(&options.MaxOffset, "max_clock_offset", maxClockOffset, "Maximum time offset allowed")
+	fs.BoolVar(&options.Skip, "skip_ntp", false, "Skip the time synchronisation check")
+	return &options
+}
+
+// queryNTP queries a NTP server, given as host or host:port, until the context is done
+func queryNTP(ctx context.Context, server string) (*ntp.Response, error) {
+	options := ntp.QueryOptions{}
+	host := server
+	if h, p, err := net.SplitHostPort(server); err == nil {
+		host = h
+		if options.Port, err = strconv.Atoi(p); err != nil {
+			return nil, errors.Errorf("invalid port in NTP server %q", server)
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		options.Timeout = time.Until(deadline)
+	}
+	type result struct {
+		response *ntp.Response
+		err      error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		response, err := ntp.QueryWithOptions(host, options)
+		if err == nil {
+			err = response.Validate()
+		}
+		ch <- result{response, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		return r.response, r.err
+	}
+}
+
+// TimeSyncStatus is the clock synchronisation status reported by the local time daemon
+type TimeSyncStatus struct {
+	Source       string
+	Synchronized bool
+	// Offset is only reported by some daemons
+	Offset      time.Duration
+	OffsetKnown bool
+}
+
+// chronyStatus reads the status of chrony with "chronyc -c tracking", which prints the reference ID,
+// name, stratum, reference time, system time offset... and leap status as comma separated values
+func chronyStatus(ctx context.Context) (*TimeSyncStatus, error) {
+	out, err := runCommand(ctx, "chronyc", "-c", "tracking")
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(strings.TrimSpace(string(out)), ",")
+	if len(fields) < 14 {
+		return nil, errors.Errorf("unexpected chronyc output %q", out)
+	}
+	seconds, err := strconv.ParseFloat(fields[4], 64)
+	if err != nil {
+		return nil, errors.Errorf("unexpected chronyc system time %q", fields[4])
+	}
+	return &TimeSyncStatus{
+		Source:       fmt.Sprintf("chrony (reference %s)", fields[1]),
+		Synchronized: fields[13] != "Not synchronised",
+		Offset:       time.Duration(seconds * float64(time.Second)),
+		OffsetKnown:  true,
+	}, nil
+}
+
+// timesyncdStatus reads the status of systemd-timesyncd, which does not report the offset
+func timesyncdStatus(ctx context.Context) (*TimeSyncStatus, error) {
+	status := &TimeSyncStatus{Source: "systemd-timesyncd"}
+	if _, err := os.Stat(timesyncSynchronizedFile); err == nil {
+		status.Synchronized = true
+		return status, nil
+	}
+	out, err := runCommand(ctx, "timedatectl", "show", "--property=NTPSynchronized", "--value")
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	if scanner.Scan() {
+		status.Synchronized = strings.TrimSpace(scanner.Text()) == "yes"
+	}
+	return status, nil
+}
+
+// LocalTimeSyncStatus obtains the clock synchronisation status from chrony or systemd-timesyncd
+func LocalTimeSyncStatus(ctx context.Context) (*TimeSyncStatus, error) {
+	status, chronyErr := chronyStatus(ctx)
+	if chronyErr == nil {
+		return status, nil
+	}
+	status, timesyncdErr := timesyncdStatus(ctx)
+	if timesyncdErr == nil {
+		return status, nil
+	}
+	return nil, errors.Errorf("chrony: %v; systemd-timesyncd: %v", chronyErr, timesyncdErr)
+}
+
+func checkOffset(offset, maxOffset time.Duration) error {
+	fmt.Printf("Time offset: %s\n", offset)
+	if absDuration(offset) > maxOffset {
+		return errors.Errorf("incorrect time offset (>%s), synchronize your server clock via ntp", maxOffset)
+	}
+	return nil
+}
+
+// RunNTPChecks performs checks on the Time offset respect the NTP servers. When none of them
+// is reachable, the synchronisation status of the local time daemon is checked
+func RunNTPChecks(ctx context.Context, options *NTPOptions) error {
+	if options.Skip {
+		fmt.Println("Time synchronisation check skipped")
+		return nil
+	}
+	var ntpErrors error
+	source := ""
+	for _, server := range options.Servers {
+		rp, err := queryNTP(ctx, server)
+		if err != nil {
+			ntpErrors = multierror.Append(ntpErrors, errors.Errorf("%s: %v", server, err))
+			continue
+		}
+		source = "NTP server " + server
+		fmt.Printf("Source: %s\n", source)
+		if err := checkOffset(rp.ClockOffset, options.MaxOffset); err != nil {
+			return err
+		}
+		break
+	}
+	if source == "" {
+		if ntpErrors != nil {
+			fmt.Printf("Unable to query the NTP servers, checking the local time synchronisation status:\n%v\n", ntpErrors)
+		}
+		status, err := LocalTimeSyncStatus(ctx)
+		if err != nil {
+			return errors.Errorf("unable to check the time synchronisation. NTP servers: %v. Local time daemons: %v", ntpErrors, err)
+		}
+		fmt.Printf("Source: %s\n", status.Source)
+		if !status.Synchronized {
+			return errors.Errorf("%s reports the clock is not synchronised", status.Source)
+		}
+		if status.OffsetKnown {
+			if err := checkOffset(status.Offset, options.MaxOffset); err != nil {
+				return err
+			}
+		}
+	}
+	h, err := os.Hostname()
+	if err != nil {
+		h = "localhost"
+	}
+	fmt.Printf("Time synchronisation of host %s within reasonable bounds!\n", h)
+	return nil
+}
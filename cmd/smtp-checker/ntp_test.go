@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ntpEpoch is the start of the NTP timestamps
+var ntpEpoch = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func ntpTimestamp(t time.Time) uint64 {
+	d := t.Sub(ntpEpoch)
+	seconds := uint64(d / time.Second)
+	fraction := uint64(d%time.Second) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+// startTestNTPServer starts a NTP server on a random local port whose clock is off by offset
+func startTestNTPServer(t *testing.T, offset time.Duration) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		request := make([]byte, 48)
+		for {
+			_, addr, err := conn.ReadFrom(request)
+			if err != nil {
+				return
+			}
+			now := time.Now().Add(offset)
+			response := make([]byte, 48)
+			// Leap indicator 0, version 4, server mode
+			response[0] = 0<<6 | 4<<3 | 4
+			response[1] = 2
+			binary.BigEndian.PutUint64(response[16:], ntpTimestamp(now.Add(-time.Minute)))
+			copy(response[24:32], request[40:48])
+			binary.BigEndian.PutUint64(response[32:], ntpTimestamp(now))
+			binary.BigEndian.PutUint64(response[40:], ntpTimestamp(now))
+			conn.WriteTo(response, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// unreachableNTPServer returns the address of a local UDP port nothing is listening on
+func unreachableNTPServer(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+	return addr
+}
+
+// withLocalTimeSync replaces the local time daemons by the given chronyc and timedatectl outputs
+func withLocalTimeSync(t *testing.T, chronyc, timedatectl string, timesyncSynchronized bool) {
+	previousRunCommand, previousFile := runCommand, timesyncSynchronizedFile
+	t.Cleanup(func() { runCommand, timesyncSynchronizedFile = previousRunCommand, previousFile })
+	runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		output := map[string]string{"chronyc": chronyc, "timedatectl": timedatectl}[name]
+		if output == "" {
+			return nil, os.ErrNotExist
+		}
+		return []byte(output), nil
+	}
+	timesyncSynchronizedFile = filepath.Join(t.TempDir(), "synchronized")
+	if timesyncSynchronized {
+		if err := os.WriteFile(timesyncSynchronizedFile, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRunNTPChecks(t *testing.T) {
+	ctx := context.Background()
+	t.Run("Check time offset via NTP", func(t *testing.T) {
+		withLocalTimeSync(t, "", "", false)
+		options := &NTPOptions{Servers: stringList{startTestNTPServer(t, 0)}, MaxOffset: time.Second}
+		if err := RunNTPChecks(ctx, options); err != nil {
+			t.Errorf("error checking time offset via NTP: %v", err)
+		}
+	})
+	t.Run("Check the next NTP server is used when one is unreachable", func(t *testing.T) {
+		withLocalTimeSync(t, "", "", false)
+		options := &NTPOptions{Servers: stringList{unreachableNTPServer(t), startTestNTPServer(t, 0)}, MaxOffset: time.Second}
+		if err := RunNTPChecks(ctx, options); err != nil {
+			t.Errorf("error checking time offset via NTP: %v", err)
+		}
+	})
+	t.Run("Check a large time offset is detected", func(t *testing.T) {
+		options := &NTPOptions{Servers: stringList{startTestNTPServer(t, 5*time.Second)}, MaxOffset: time.Second}
+		err := RunNTPChecks(ctx, options)
+		if err == nil || !strings.Contains(err.Error(), "incorrect time offset") {
+			t.Errorf("expected time offset error, got %v", err)
+		}
+	})
+	t.Run("Check the check can be skipped", func(t *testing.T) {
+		if err := RunNTPChecks(ctx, &NTPOptions{Skip: true}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+	localTests := []struct {
+		name                 string
+		chronyc, timedatectl string
+		timesyncSynchronized bool
+		err                  string
+	}{
+		{"chrony synchronised", "A9FEA97B,169.254.169.123,4,1700000000.1,0.000012,0.0,0.0,0.0,0.0,0.0,0.0,0.0,64.0,Normal\n", "", false, ""},
+		{"chrony not synchronised", "7F7F0101,,10,0.0,0.0,0.0,0.0,0.0,0.0,0.0,0.0,0.0,0.0,Not synchronised\n", "", false, "not synchronised"},
+		{"chrony offset too large", "A9FEA97B,169.254.169.123,4,1700000000.1,-3.5,0.0,0.0,0.0,0.0,0.0,0.0,0.0,64.0,Normal\n", "", false, "incorrect time offset"},
+		{"systemd-timesyncd synchronised file", "", "", true, ""},
+		{"systemd-timesyncd synchronised", "", "yes\n", false, ""},
+		{"systemd-timesyncd not synchronised", "", "no\n", false, "not synchronised"},
+		{"no time daemon", "", "", false, "unable to check the time synchronisation"},
+	}
+	for _, test := range localTests {
+		t.Run("Check local time synchronisation status with "+test.name, func(t *testing.T) {
+			withLocalTimeSync(t, test.chronyc, test.timedatectl, test.timesyncSynchronized)
+			options := &NTPOptions{Servers: stringList{unreachableNTPServer(t)}, MaxOffset: time.Second}
+			err := RunNTPChecks(ctx, options)
+			if test.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/mkmik/multierror"
+)
+
+// Phases measures the elapsed time of the phases of a check (DNS, connect, banner, TLS, auth, data)
+type Phases struct {
+	names     []string
+	durations []time.Duration
+	failed    string
+}
+
+// Measure runs a phase and records its elapsed time
+func (p *Phases) Measure(name string, phase func() error) error {
+	start := time.Now()
+	err := phase()
+	p.names = append(p.names, name)
+	p.durations = append(p.durations, time.Since(start))
+	if err != nil {
+		p.failed = name
+	}
+	return err
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+func (p *Phases) String() string {
+	parts := []string{}
+	for i, name := range p.names {
+		part := fmt.Sprintf("%s %s", name, formatDuration(p.durations[i]))
+		if name == p.failed && i == len(p.names)-1 {
+			part += " (failed)"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Print prints the elapsed time of the phases measured, if any
+func (p *Phases) Print() {
+	if len(p.names) > 0 {
+		fmt.Printf("Elapsed time: %s\n", p)
+	}
+}
+
+// checkRunner runs the checks with a timeout each. When its context is done because of an
+// interruption or the global timeout, the remaining checks are skipped
+type checkRunner struct {
+	ctx     context.Context
+	timeout time.Duration
+	errors  error
+}
+
+// run prints the title of a check and runs it, returning its error
+func (r *checkRunner) run(title string, check func(ctx context.Context) error) error {
+	return r.runWithTimeout(title, r.timeout, check)
+}
+
+// runWithTimeout runs a check that needs a timeout other than the one of the runner
+func (r *checkRunner) runWithTimeout(title string, timeout time.Duration, check func(ctx context.Context) error) error {
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+	fmt.Printf("-- Check: %s --\n", title)
+	ctx, cancel := context.WithTimeout(r.ctx, timeout)
+	defer cancel()
+	err := check(ctx)
+	if err == nil {
+		return nil
+	}
+	switch {
+	case r.ctx.Err() == context.Canceled:
+		err = errors.Errorf("%s check interrupted: %v", title, err)
+	case r.ctx.Err() == context.DeadlineExceeded:
+		err = errors.Errorf("%s check stopped by the global timeout: %v", title, err)
+	case ctx.Err() == context.DeadlineExceeded:
+		err = errors.Errorf("%s check timed out after %s: %v", title, timeout, err)
+	}
+	r.errors = multierror.Append(r.errors, err)
+	return err
+}
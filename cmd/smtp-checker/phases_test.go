@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+)
+
+func TestPhases(t *testing.T) {
+	t.Run("Check the phases are reported in order with the failed one", func(t *testing.T) {
+		phases := &Phases{}
+		phases.Measure("DNS", func() error { return nil })
+		phases.Measure("connect", func() error { return context.DeadlineExceeded })
+		if s := phases.String(); !strings.HasPrefix(s, "DNS ") || !strings.Contains(s, ", connect ") || !strings.HasSuffix(s, " (failed)") {
+			t.Errorf("Incorrect phases description %q", s)
+		}
+	})
+}
+
+func TestCheckRunner(t *testing.T) {
+	t.Run("Check a blackholed SMTP server does not hang the checks", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		// Accept the connections but never send the greeting
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+		checks := &checkRunner{ctx: context.Background(), timeout: 200 * time.Millisecond}
+		start := time.Now()
+		err = checks.run("STARTTLS upgrade with SMTP server", func(ctx context.Context) error {
+			return RunSTARTTLSChecks(ctx, &apps.SMTPSettings{Host: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port})
+		})
+		if err == nil || !strings.Contains(err.Error(), "timed out after 200ms") {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("check took %s, expected it to be aborted after the timeout", elapsed)
+		}
+	})
+	t.Run("Check the checks are skipped once interrupted", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		checks := &checkRunner{ctx: ctx, timeout: time.Second}
+		ran := false
+		err := checks.run("Skipped", func(ctx context.Context) error {
+			ran = true
+			return nil
+		})
+		if ran || err != context.Canceled {
+			t.Errorf("expected the check to be skipped, ran: %v, error: %v", ran, err)
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/juju/errors"
+)
+
+// alternativePorts are the ports SMTP servers usually listen on, in order of preference
+var alternativePorts = []int{587, 465, 2525, 25}
+
+// implicitTLSPort is the port SMTP servers use for implicit TLS
+var implicitTLSPort = 465
+
+// probeTimeout is the connection timeout when probing the alternative ports
+var probeTimeout = 3 * time.Second
+
+// PortStatus is the result of probing a port
+type PortStatus string
+
+// Possible results of a port probe
+const (
+	PortOpen    PortStatus = "open"
+	PortTimeout PortStatus = "timeout"
+	PortRefused PortStatus = "refused"
+	PortError   PortStatus = "error"
+)
+
+// PortProbe is the result of probing a port of the SMTP server
+type PortProbe struct {
+	Port     int
+	Status   PortStatus
+	Security apps.ConnectionSecurity
+	Err      error
+	// CertErr is the verification error of the certificate of an implicit TLS port
+	CertErr error
+}
+
+// Description explains the probe result
+func (p PortProbe) Description() string {
+	switch p.Status {
+	case PortOpen:
+		switch p.Security {
+		case apps.SecurityImplicitTLS:
+			if p.CertErr != nil {
+				return fmt.Sprintf("SMTP server reachable using implicit TLS, but its certificate is not trusted: %v", p.CertErr)
+			}
+			return "SMTP server reachable using implicit TLS"
+		case apps.SecuritySTARTTLS:
+			return "SMTP server reachable, it offers STARTTLS"
+		case apps.SecurityNone:
+			return "SMTP server reachable, it does not offer STARTTLS"
+		}
+		return "port reachable, but it does not look like a SMTP server"
+	case PortTimeout:
+		return "connection timed out, outbound traffic is likely blocked by a firewall or the cloud provider"
+	case PortRefused:
+		return "connection refused, the server is not listening on this port"
+	}
+	return p.Err.Error()
+}
+
+// dialStatus classifies a connection error
+func dialStatus(err error) PortStatus {
+	if err == nil {
+		return PortOpen
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return PortRefused
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return PortTimeout
+	}
+	return PortError
+}
+
+// detectSecurity checks whether a reachable port talks SMTP with implicit TLS, STARTTLS or no
+// encryption. It returns an empty string when it does not. When the certificate of an implicit TLS
+// port can not be verified, the verification error is returned too
+func detectSecurity(ctx context.Context, host string, port int) (apps.ConnectionSecurity, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	settings := &apps.SMTPSettings{Host: host, Port: port}
+	if port == implicitTLSPort {
+		settings.Security = apps.SecurityImplicitTLS
+	}
+	c, err := dialSMTP(ctx, settings, &Phases{})
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return apps.SecurityImplicitTLS, certErr
+	}
+	if err != nil {
+		return "", nil
+	}
+	defer c.Close()
+	if settings.Security == apps.SecurityImplicitTLS {
+		return apps.SecurityImplicitTLS, nil
+	}
+	if err := c.Hello("localhost"); err != nil {
+		return "", nil
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		return apps.SecuritySTARTTLS, nil
+	}
+	return apps.SecurityNone, nil
+}
+
+// ProbePorts tries to connect to the alternative SMTP ports of a host concurrently
+func ProbePorts(ctx context.Context, host string) []PortProbe {
+	res := make([]PortProbe, len(alternativePorts))
+	var wg sync.WaitGroup
+	for i, port := range alternativePorts {
+		wg.Add(1)
+		go func(i, port int) {
+			defer wg.Done()
+			dialCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+			defer cancel()
+			conn, err := (&net.Dialer{}).DialContext(dialCtx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+			res[i] = PortProbe{Port: port, Status: dialStatus(err), Err: err}
+			if err != nil {
+				return
+			}
+			conn.Close()
+			res[i].Security, res[i].CertErr = detectSecurity(ctx, host, port)
+		}(i, port)
+	}
+	wg.Wait()
+	return res
+}
+
+// recommendPort returns the first reachable SMTP port, preferring the encrypted ones
+func recommendPort(probes []PortProbe) (PortProbe, bool) {
+	for _, security := range []apps.ConnectionSecurity{apps.SecuritySTARTTLS, apps.SecurityImplicitTLS, apps.SecurityNone} {
+		for _, p := range probes {
+			if p.Status == PortOpen && p.Security == security {
+				return p, true
+			}
+		}
+	}
+	return PortProbe{}, false
+}
+
+// RunAlternativePortsChecks probes the usual SMTP ports of the host to tell whether the connection
+// failure is caused by egress blocking, and recommends a working port and connection security
+func RunAlternativePortsChecks(ctx context.Context, host string, port int) error {
+	fmt.Printf("Probing alternative ports of %s\n", host)
+	probes := ProbePorts(ctx, host)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PORT\tSTATUS\tDETAILS")
+	for _, p := range probes {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", p.Port, p.Status, p.Description())
+	}
+	w.Flush()
+	recommended, ok := recommendPort(probes)
+	if !ok {
+		return errors.Errorf("no SMTP port of %s is reachable, check the host name and the firewall rules", host)
+	}
+	if recommended.Port == port {
+		fmt.Printf("Port %d is reachable now, the connection failure may be transient\n", port)
+		return nil
+	}
+	fmt.Printf("Recommendation: use port %d with %s connection security\n", recommended.Port, recommended.Security)
+	return nil
+}
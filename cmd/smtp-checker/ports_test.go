@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+)
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// closedPort returns a local port nothing is listening on
+func closedPort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return port
+}
+
+func TestDialStatus(t *testing.T) {
+	t.Run("Check a timeout is detected", func(t *testing.T) {
+		if status := dialStatus(&net.OpError{Op: "dial", Err: timeoutError{}}); status != PortTimeout {
+			t.Errorf("expected %s, got %s", PortTimeout, status)
+		}
+	})
+	t.Run("Check a refused connection is detected", func(t *testing.T) {
+		_, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(closedPort(t))))
+		if status := dialStatus(err); status != PortRefused {
+			t.Errorf("expected %s, got %s (%v)", PortRefused, status, err)
+		}
+	})
+}
+
+func TestProbePorts(t *testing.T) {
+	startTLSServer := startTestSMTPServer(t, nil)
+	tlsServer := startTestSMTPServer(t, func(s *testSMTPServer) { s.implicitTLS = true })
+	plainServer := startTestSMTPServer(t, func(s *testSMTPServer) { s.extensions = nil })
+	refused := closedPort(t)
+	previousPorts, previousTimeout := alternativePorts, probeTimeout
+	probeTimeout = 500 * time.Millisecond
+	defer func() { alternativePorts, probeTimeout = previousPorts, previousTimeout }()
+
+	t.Run("Check the probe results", func(t *testing.T) {
+		alternativePorts = []int{refused, plainServer.settings().Port, startTLSServer.settings().Port}
+		probes := ProbePorts(context.Background(), "127.0.0.1")
+		expected := []PortProbe{
+			{Port: refused, Status: PortRefused},
+			{Port: plainServer.settings().Port, Status: PortOpen, Security: apps.SecurityNone},
+			{Port: startTLSServer.settings().Port, Status: PortOpen, Security: apps.SecuritySTARTTLS},
+		}
+		for i, p := range probes {
+			if p.Port != expected[i].Port || p.Status != expected[i].Status || p.Security != expected[i].Security {
+				t.Errorf("expected %+v, got %+v", expected[i], p)
+			}
+		}
+		recommended, ok := recommendPort(probes)
+		if !ok || recommended.Port != startTLSServer.settings().Port {
+			t.Errorf("expected the STARTTLS port to be recommended, got %+v", recommended)
+		}
+	})
+	t.Run("Check implicit TLS is only detected on port 465", func(t *testing.T) {
+		alternativePorts = []int{tlsServer.settings().Port}
+		probes := ProbePorts(context.Background(), "127.0.0.1")
+		if probes[0].Status != PortOpen || probes[0].Security != "" {
+			t.Errorf("expected an open port with unknown security, got %+v", probes[0])
+		}
+	})
+	t.Run("Check untrusted certificates of implicit TLS ports are reported", func(t *testing.T) {
+		previousPort, previousRootCAs := implicitTLSPort, rootCAs
+		defer func() { implicitTLSPort, rootCAs = previousPort, previousRootCAs }()
+		implicitTLSPort = tlsServer.settings().Port
+		alternativePorts = []int{implicitTLSPort}
+		rootCAs = x509.NewCertPool()
+		probes := ProbePorts(context.Background(), "127.0.0.1")
+		if probes[0].Security != apps.SecurityImplicitTLS || probes[0].CertErr == nil {
+			t.Errorf("expected implicit TLS with a certificate error, got %+v", probes[0])
+		}
+		if description := probes[0].Description(); !strings.Contains(description, "certificate is not trusted") {
+			t.Errorf("expected the certificate error in the description, got %q", description)
+		}
+	})
+	t.Run("Check an error is returned when no port is reachable", func(t *testing.T) {
+		alternativePorts = []int{refused}
+		if err := RunAlternativePortsChecks(context.Background(), "127.0.0.1", refused); err == nil {
+			t.Errorf("expected error when no port is reachable")
+		}
+	})
+}
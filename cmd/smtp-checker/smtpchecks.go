@@ -2,60 +2,99 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
-	"math"
 	"net"
-	"net/smtp"
+	"net/mail"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
-	"github.com/andybalholm/crlf"
-	"github.com/beevik/ntp"
 	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
-	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps/redmine"
-	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps/wordpress"
 	"github.com/juju/errors"
 )
 
-const (
-	timeout        = 10 * time.Second
-	maxClockOffset = 1 * time.Second
-)
-
-func absDuration(d time.Duration) time.Duration {
-	return time.Duration(math.Abs(float64(d)))
-}
+// rootCAs are the certificate authorities used to validate the SMTP server certificate. When nil,
+// the system ones are used
+var rootCAs *x509.CertPool
 
 // ObtainConfigData obtains the configuration data from
-// the app
-func ObtainConfigData(installDir string, app string) (appConfig apps.ApplicationConfig, err error) {
-	parsers := map[string]func(string) (apps.ApplicationConfig, error){
-		"redmine":   redmine.ParseConfig,
-		"wordpress": wordpress.QueryConfig,
-	}
-	parse, ok := parsers[app]
+// the app. When no configuration file is given, it is searched in the known layouts. When the
+// SMTP settings are also set with the environment variables of the container, they are compared
+// with the persisted ones, and used if those can not be obtained
+func ObtainConfigData(installDir string, app string, configFile string) (appConfig apps.ApplicationConfig, err error) {
+	application, ok := apps.Lookup(app)
 	if !ok {
 		var names []string
-		for k := range parsers {
-			names = append(names, k)
+		for _, a := range apps.Applications() {
+			names = append(names, a.Name)
 		}
 		return nil, errors.Errorf("bad app name %q; currently supported: %s", app, strings.Join(names, ", "))
 	}
-	return parse(installDir)
+	var envConfig *apps.EnvConfig
+	if application.EnvPrefix != "" {
+		if envConfig, err = apps.LoadEnvConfig(application.EnvPrefix); err != nil {
+			return nil, err
+		}
+	}
+	if configFile == "" {
+		var layout apps.Layout
+		if configFile, layout, ok = application.Find(installDir); !ok {
+			if envConfig != nil {
+				fmt.Printf("%s configuration file not found, using the %s_SMTP_* environment variables\n", application.Name, application.EnvPrefix)
+				return envConfig, nil
+			}
+			return nil, errors.Errorf("%s configuration file %q not found in the known layouts, set it using '-config_file' flag", application.Name, application.ConfigFile)
+		}
+		fmt.Printf("Found %s layout in %q\n", layout.Name, filepath.Dir(configFile))
+	}
+	appConfig, err = application.Load(configFile)
+	if envConfig == nil {
+		return appConfig, err
+	}
+	if err != nil {
+		fmt.Printf("Unable to obtain the persisted configuration, using the %s_SMTP_* environment variables: %v\n", application.EnvPrefix, err)
+		return envConfig, nil
+	}
+	printDrift(envConfig.Drift(appConfig.GetSMTPSettings()))
+	return appConfig, nil
+}
+
+// printDrift prints the differences between the environment variables and the persisted configuration
+func printDrift(drift []apps.Drift) {
+	if len(drift) == 0 {
+		fmt.Println("The environment variables match the persisted configuration")
+		return
+	}
+	fmt.Println("Warning: the environment variables differ from the persisted configuration, which is the one used. The variables are only applied when the container is initialised for the first time")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VARIABLE\tENVIRONMENT\tPERSISTED")
+	for _, d := range drift {
+		fmt.Fprintf(w, "%s\t%q\t%q\n", d.Variable, d.Env, d.Persisted)
+	}
+	w.Flush()
 }
 
 // RunConnectiviyChecks performs checks on the connectivity
 // with SMTP server
-func RunConnectivityChecks(hostname string, port int) error {
-	smtpServer := fmt.Sprintf("%s:%d", hostname, port)
-	tcpAddr, err := net.ResolveTCPAddr("tcp", smtpServer)
-	if err != nil {
-		return err
-	}
-	conn, err := net.DialTCP("tcp", nil, tcpAddr)
-	if err != nil {
+func RunConnectivityChecks(ctx context.Context, hostname string, port int) error {
+	phases := &Phases{}
+	defer phases.Print()
+	conn, err := dialTCP(ctx, hostname, port, phases)
+	smtpServer := net.JoinHostPort(hostname, strconv.Itoa(port))
+	switch dialStatus(err) {
+	case PortTimeout:
+		return errors.Errorf("connection to %s timed out, outbound traffic may be blocked by a firewall: %v", smtpServer, err)
+	case PortRefused:
+		return errors.Errorf("connection to %s refused, the SMTP server is not listening on port %d: %v", smtpServer, port, err)
+	case PortError:
 		return err
 	}
 	conn.Close()
@@ -64,53 +103,261 @@ func RunConnectivityChecks(hostname string, port int) error {
 }
 
 // RunTLSConnectiviyChecks performs checks on the connectivity with SMTP server
-func RunTLSConnectivityChecks(hostname string, port int) error {
-	smtpServer := fmt.Sprintf("%s:%d", hostname, port)
-	conn, err := tls.Dial("tcp", smtpServer, nil)
+func RunTLSConnectivityChecks(ctx context.Context, hostname string, port int) error {
+	phases := &Phases{}
+	defer phases.Print()
+	conn, err := dialTCP(ctx, hostname, port, phases)
 	if err != nil {
 		return err
 	}
-	conn.Close()
+	tlsConn := tls.Client(conn, tlsConfig(hostname))
+	defer tlsConn.Close()
+	if err := phases.Measure("TLS", func() error { return tlsConn.HandshakeContext(ctx) }); err != nil {
+		return err
+	}
 	fmt.Println("Succesful TLS connectivity!")
 	return nil
 }
 
-// RunNTPChecks performs checks on the Time offset respect a NTP pool
-func RunNTPChecks() error {
-	rp, err := ntp.QueryWithOptions("pool.ntp.org", ntp.QueryOptions{Timeout: timeout})
+func tlsConfig(host string) *tls.Config {
+	return &tls.Config{ServerName: host, RootCAs: rootCAs}
+}
+
+// dialTCP resolves the host name and connects to the first address that accepts the connection
+func dialTCP(ctx context.Context, hostname string, port int, phases *Phases) (net.Conn, error) {
+	var addrs []string
+	err := phases.Measure("DNS", func() (err error) {
+		addrs, err = net.DefaultResolver.LookupHost(ctx, hostname)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	err = phases.Measure("connect", func() (err error) {
+		dialer := &net.Dialer{}
+		for _, addr := range addrs {
+			conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+		}
+		return err
+	})
+	return conn, err
+}
+
+// dialSMTP connects to the SMTP server and reads its greeting. With implicit TLS, the TLS
+// handshake is done before any SMTP command is sent. The connection is aborted when the
+// context is done
+func dialSMTP(ctx context.Context, settings *apps.SMTPSettings, phases *Phases) (*smtpClient, error) {
+	transcript.Note("Connecting to %s", net.JoinHostPort(settings.Host, strconv.Itoa(settings.Port)))
+	conn, err := dialTCP(ctx, settings.Host, settings.Port, phases)
+	if err != nil {
+		transcript.Note("Connection failed: %v", err)
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	if settings.Security == apps.SecurityImplicitTLS {
+		tlsConn := tls.Client(conn, tlsConfig(settings.Host))
+		if err := phases.Measure("TLS", func() error { return tlsConn.HandshakeContext(ctx) }); err != nil {
+			stop()
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	var c *smtpClient
+	err = phases.Measure("banner", func() (err error) {
+		c, err = newSMTPClient(conn, settings.Host)
+		return err
+	})
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, err
+	}
+	c.phases, c.stop = phases, stop
+	return c, nil
+}
+
+// startTLS upgrades the connection with STARTTLS as required by the connection security of the
+// settings. When it is not set, the connection is upgraded only if the server offers STARTTLS.
+// It returns whether the connection was upgraded
+func startTLS(c *smtpClient, settings *apps.SMTPSettings) (bool, error) {
+	if settings.Security == apps.SecurityNone || settings.Security == apps.SecurityImplicitTLS {
+		return false, nil
+	}
+	ok, _ := c.Extension("STARTTLS")
+	if !ok {
+		if settings.Security == apps.SecuritySTARTTLS {
+			return false, errors.Errorf("SMTP server %s:%d does not offer STARTTLS, which is required on port %d. Check the port or use the implicit-tls or none connection security",
+				settings.Host, settings.Port, settings.Port)
+		}
+		return false, nil
+	}
+	if err := c.phases.Measure("TLS", func() error { return c.StartTLS(tlsConfig(settings.Host)) }); err != nil {
+		return false, errors.Errorf("STARTTLS upgrade failed: %v", err)
+	}
+	return true, nil
+}
+
+// RunSTARTTLSChecks checks the SMTP server offers STARTTLS and the connection can be upgraded
+// with a valid certificate
+func RunSTARTTLSChecks(ctx context.Context, settings *apps.SMTPSettings) error {
+	phases := &Phases{}
+	defer phases.Print()
+	c, err := dialSMTP(ctx, settings, phases)
 	if err != nil {
 		return err
 	}
-	if absDuration(rp.ClockOffset) > maxClockOffset {
-		return errors.Errorf("incorrect time offset (>%s, synchronize your server clock via ntp", maxClockOffset)
+	defer c.Close()
+	if err := c.Hello("localhost"); err != nil {
+		return err
+	}
+	upgraded, err := startTLS(c, settings)
+	if err != nil {
+		return err
+	}
+	if !upgraded {
+		fmt.Println("SMTP server does not offer STARTTLS, mails will be sent unencrypted")
+		return c.Quit()
+	}
+	state, _ := c.TLSConnectionState()
+	cert := state.PeerCertificates[0]
+	fmt.Printf(`Certificate subject: %q
+Certificate issuer: %q
+Certificate expiration: %s
+`, cert.Subject.CommonName, cert.Issuer.CommonName, cert.NotAfter.Format(time.RFC1123))
+	fmt.Println("Succesful STARTTLS upgrade!")
+	return c.Quit()
+}
+
+// domain returns the domain of a mail address
+func domain(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return strings.ToLower(address[i+1:])
+	}
+	return ""
+}
+
+// RunSenderChecks checks the sender is a valid address and warns when its domain does not match
+// the one of the SMTP user, as many providers reject or rewrite those mails
+func RunSenderChecks(settings *apps.SMTPSettings) error {
+	if settings.From == "" {
+		if _, err := mail.ParseAddress(settings.User); err != nil {
+			return errors.Errorf("no sender set and SMTP user %q is not a mail address, set the sender using '-mail_from' flag", settings.User)
+		}
+		fmt.Println("Warning: no sender set, the SMTP user is used as sender")
+		return nil
 	}
-	h, err := os.Hostname()
+	from, err := settings.FromAddress()
 	if err != nil {
-		h = "localhost"
+		return errors.Errorf("invalid sender %q: %v", settings.From, err)
 	}
-	fmt.Printf("Time synchronisation of host %s within reasonable bounds!\n", h)
+	fmt.Printf("Sender: %q\n", from.String())
+	userDomain := domain(settings.User)
+	if userDomain != "" && userDomain != domain(from.Address) {
+		fmt.Printf("Warning: the sender domain %q does not match the domain of the SMTP user %q. The SMTP server may reject or rewrite the mail\n",
+			domain(from.Address), settings.User)
+		return nil
+	}
+	fmt.Println("Sender is valid!")
 	return nil
 }
 
-// RunSendMailChecks performs checks on sending mails via SMTP
-func RunSendMailChecks(settings *apps.SMTPSettings, recipient string) error {
-	auth := smtp.PlainAuth(
-		"",
-		settings.User,
-		settings.Pass,
-		settings.Host,
-	)
-	sender := settings.User
-	smtpServer := fmt.Sprintf("%s:%d", settings.Host, settings.Port)
-	var msg bytes.Buffer
-	w := crlf.NewWriter(&msg)
-	fmt.Fprintf(w, "To: %s\n", recipient)
-	fmt.Fprintf(w, `Subject: Testing Mail
+// RunProviderChecks validates the settings against the profile of the provider of the SMTP host,
+// when it is a well-known one
+func RunProviderChecks(settings *apps.SMTPSettings) error {
+	provider, ok := apps.ProviderForHost(settings.Host)
+	if !ok {
+		fmt.Printf("%s is not a well-known SMTP provider, skipping\n", settings.Host)
+		return nil
+	}
+	fmt.Printf("SMTP provider: %s\n", provider.Name)
+	if provider.Note != "" {
+		fmt.Printf("Note: %s\n", provider.Note)
+	}
+	if warning := provider.SenderWarning(settings); warning != "" {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+	if err := provider.Validate(settings); err != nil {
+		return errors.Errorf("settings not valid for %s:\n%v", provider.Name, err)
+	}
+	fmt.Printf("Settings match the %s profile!\n", provider.Name)
+	return nil
+}
 
-This is a testing email body.`)
-	if err := smtp.SendMail(smtpServer, auth, sender, []string{recipient}, msg.Bytes()); err != nil {
+// messageID generates a unique Message-ID for the sender domain
+func messageID(from *mail.Address) string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	host := domain(from.Address)
+	if host == "" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(id), host)
+}
+
+// RunSendMailChecks performs checks on sending mails via SMTP
+func RunSendMailChecks(ctx context.Context, settings *apps.SMTPSettings, recipient string) error {
+	if err := sendMail(ctx, settings, recipient, "Testing Mail"); err != nil {
 		return err
 	}
 	fmt.Println("Mail successfully sent via SMTP!")
 	return nil
 }
+
+// sendMail sends a testing mail with the given subject
+func sendMail(ctx context.Context, settings *apps.SMTPSettings, recipient, subject string) error {
+	from, err := settings.FromAddress()
+	if err != nil {
+		return errors.Errorf("invalid sender: %v", err)
+	}
+	phases := &Phases{}
+	defer phases.Print()
+	c, err := dialSMTP(ctx, settings, phases)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Hello("localhost"); err != nil {
+		return err
+	}
+	if _, err := startTLS(c, settings); err != nil {
+		return err
+	}
+	if _, err := authenticate(c, settings); err != nil {
+		return err
+	}
+	// The DATA writer converts the line endings to CRLF
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\n", recipient)
+	fmt.Fprintf(&msg, "Date: %s\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: %s\n", messageID(from))
+	fmt.Fprintf(&msg, "Subject: %s\n", subject)
+	fmt.Fprintf(&msg, "\nThis is a testing email body.")
+	err = phases.Measure("data", func() error {
+		if err := c.Mail(from.Address); err != nil {
+			return err
+		}
+		if err := c.Rcpt(recipient); err != nil {
+			return err
+		}
+		data, err := c.Data()
+		if err != nil {
+			return err
+		}
+		if _, err := data.Write(msg.Bytes()); err != nil {
+			return err
+		}
+		return data.Close()
+	})
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
@@ -10,22 +13,13 @@ import (
 
 func TestRunTLSConnectivityChecks(t *testing.T) {
 	t.Run("Check connectivity with SMTP server via TLS", func(t *testing.T) {
-		err := RunTLSConnectivityChecks("smtp.gmail.com", 465)
+		err := RunTLSConnectivityChecks(context.Background(), "smtp.gmail.com", 465)
 		if err != nil {
 			t.Errorf("error connecting to smtp server via tls: %v", err)
 		}
 	})
 }
 
-func TestRunNTPChecks(t *testing.T) {
-	t.Run("Check time offset via NTP", func(t *testing.T) {
-		err := RunNTPChecks()
-		if err != nil {
-			t.Errorf("error checking time offset via NTP: %v", err)
-		}
-	})
-}
-
 func TestRunSendMailChecks(t *testing.T) {
 	t.Run("Check mail delivery via SMTP", func(t *testing.T) {
 		port, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
@@ -35,9 +29,108 @@ func TestRunSendMailChecks(t *testing.T) {
 			User: os.Getenv("SMTP_USER"),
 			Pass: os.Getenv("SMTP_PASS"),
 		}
-		err := RunSendMailChecks(&smtp, "test@example.com")
+		err := RunSendMailChecks(context.Background(), &smtp, "test@example.com")
 		if err != nil {
 			t.Errorf("error checking mail delivery via SMTP: %v", err)
 		}
 	})
 }
+
+func TestRunSTARTTLSChecks(t *testing.T) {
+	t.Run("Check STARTTLS upgrade", func(t *testing.T) {
+		server := startTestSMTPServer(t, nil)
+		settings := server.settings()
+		settings.Security = apps.SecuritySTARTTLS
+		if err := RunSTARTTLSChecks(context.Background(), settings); err != nil {
+			t.Errorf("error upgrading connection with STARTTLS: %v", err)
+		}
+	})
+
+	t.Run("Check STARTTLS required but not offered", func(t *testing.T) {
+		server := startTestSMTPServer(t, func(s *testSMTPServer) {
+			s.extensions = []string{"AUTH PLAIN"}
+		})
+		settings := server.settings()
+		settings.Security = apps.SecuritySTARTTLS
+		if err := RunSTARTTLSChecks(context.Background(), settings); err == nil {
+			t.Errorf("expected error when STARTTLS is required but not offered")
+		}
+		settings.Security = ""
+		if err := RunSTARTTLSChecks(context.Background(), settings); err != nil {
+			t.Errorf("error checking optional STARTTLS: %v", err)
+		}
+	})
+
+	t.Run("Check untrusted certificate", func(t *testing.T) {
+		server := startTestSMTPServer(t, nil)
+		rootCAs = nil
+		settings := server.settings()
+		settings.Security = apps.SecuritySTARTTLS
+		if err := RunSTARTTLSChecks(context.Background(), settings); err == nil {
+			t.Errorf("expected error validating an untrusted certificate")
+		}
+	})
+}
+
+func TestRunSendMailChecksSecurity(t *testing.T) {
+	for _, security := range []apps.ConnectionSecurity{apps.SecurityImplicitTLS, apps.SecuritySTARTTLS, ""} {
+		t.Run(fmt.Sprintf("Check mail delivery with %q connection security", security), func(t *testing.T) {
+			server := startTestSMTPServer(t, func(s *testSMTPServer) {
+				s.implicitTLS = security == apps.SecurityImplicitTLS
+			})
+			settings := server.settings()
+			settings.Security = security
+			if err := RunSendMailChecks(context.Background(), settings, "test@example.com"); err != nil {
+				t.Fatalf("error checking mail delivery via SMTP: %v", err)
+			}
+			messages := server.received()
+			if len(messages) != 1 || messages[0].from != "smtp-user" || messages[0].to[0] != "test@example.com" {
+				t.Errorf("Incorrect messages received by the SMTP server: %+v", messages)
+			}
+		})
+	}
+}
+
+func TestRunSendMailChecksSender(t *testing.T) {
+	t.Run("Check the configured sender is used in the envelope and headers", func(t *testing.T) {
+		server := startTestSMTPServer(t, nil)
+		settings := server.settings()
+		settings.From = "Blog <blog@example.com>"
+		if err := RunSendMailChecks(context.Background(), settings, "test@example.com"); err != nil {
+			t.Fatalf("error checking mail delivery via SMTP: %v", err)
+		}
+		messages := server.received()
+		if len(messages) != 1 || messages[0].from != "blog@example.com" {
+			t.Fatalf("Incorrect messages received by the SMTP server: %+v", messages)
+		}
+		for _, header := range []string{"From: \"Blog\" <blog@example.com>\n", "\nDate: ", "\nMessage-ID: <"} {
+			if !strings.Contains(messages[0].data, header) {
+				t.Errorf("Header %q not found in message:\n%s", header, messages[0].data)
+			}
+		}
+	})
+}
+
+func TestRunSenderChecks(t *testing.T) {
+	tests := []struct {
+		user, from string
+		err        string
+	}{
+		{"user@example.com", "Blog <blog@example.com>", ""},
+		{"user@example.com", "", ""},
+		{"apikey", "blog@example.com", ""},
+		{"apikey", "", "set the sender using '-mail_from' flag"},
+		{"user@example.com", "blog@", "invalid sender"},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Check sender %q with user %q", test.from, test.user), func(t *testing.T) {
+			err := RunSenderChecks(&apps.SMTPSettings{User: test.user, From: test.from})
+			if test.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
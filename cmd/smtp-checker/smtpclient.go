@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+)
+
+// redacted replaces the authentication data in the transcript
+const redacted = "[redacted]"
+
+// smtpClient is a SMTP client with the same methods as net/smtp.Client that records the session
+// in the transcript. net/smtp does not allow to record it after the STARTTLS upgrade
+type smtpClient struct {
+	Text       *textproto.Conn
+	conn       net.Conn
+	serverName string
+	localName  string
+	tls        bool
+	ext        map[string]string
+	auth       []string
+	// phases measures the elapsed time of the session phases
+	phases *Phases
+	// stop stops aborting the connection when the context of the session is done
+	stop func() bool
+}
+
+// newSMTPClient returns a client using an existing connection, after reading the server greeting
+func newSMTPClient(conn net.Conn, host string) (*smtpClient, error) {
+	c := &smtpClient{Text: textproto.NewConn(conn), conn: conn, serverName: host, localName: "localhost", phases: &Phases{}}
+	_, c.tls = conn.(*tls.Conn)
+	if _, _, err := c.readResponse(220); err != nil {
+		c.Text.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// send writes a command, recording display instead of the command itself when it is not empty
+func (c *smtpClient) send(line, display string) error {
+	if display == "" {
+		display = line
+	}
+	transcript.Sent(display)
+	return c.Text.PrintfLine("%s", line)
+}
+
+func (c *smtpClient) readResponse(expectCode int) (int, string, error) {
+	code, msg, err := c.Text.ReadResponse(expectCode)
+	if code != 0 {
+		transcript.Received(code, msg)
+	}
+	return code, msg, err
+}
+
+func (c *smtpClient) cmd(expectCode int, format string, args ...interface{}) (int, string, error) {
+	if err := c.send(fmt.Sprintf(format, args...), ""); err != nil {
+		return 0, "", err
+	}
+	return c.readResponse(expectCode)
+}
+
+// Hello sends EHLO, falling back to HELO, with the given host name
+func (c *smtpClient) Hello(localName string) error {
+	c.localName = localName
+	return c.ehlo()
+}
+
+func (c *smtpClient) ehlo() error {
+	_, msg, err := c.cmd(250, "EHLO %s", c.localName)
+	if err != nil {
+		_, _, err = c.cmd(250, "HELO %s", c.localName)
+		return err
+	}
+	c.ext = map[string]string{}
+	c.auth = nil
+	lines := strings.Split(msg, "\n")
+	for _, line := range lines[1:] {
+		name, params, _ := strings.Cut(line, " ")
+		c.ext[strings.ToUpper(name)] = params
+	}
+	if mechs, ok := c.ext["AUTH"]; ok {
+		c.auth = strings.Fields(mechs)
+	}
+	return nil
+}
+
+// Extension reports whether the server supports an extension and its parameters
+func (c *smtpClient) Extension(ext string) (bool, string) {
+	params, ok := c.ext[strings.ToUpper(ext)]
+	return ok, params
+}
+
+// StartTLS upgrades the connection and sends EHLO again, as the extensions may change
+func (c *smtpClient) StartTLS(config *tls.Config) error {
+	if _, _, err := c.cmd(220, "STARTTLS"); err != nil {
+		return err
+	}
+	tlsConn := tls.Client(c.conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		transcript.Note("TLS handshake failed: %v", err)
+		return err
+	}
+	state := tlsConn.ConnectionState()
+	transcript.Note("TLS handshake completed: %s, %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	c.conn, c.tls = tlsConn, true
+	c.Text = textproto.NewConn(tlsConn)
+	return c.ehlo()
+}
+
+// TLSConnectionState returns the TLS state of the connection, if it uses TLS
+func (c *smtpClient) TLSConnectionState() (tls.ConnectionState, bool) {
+	tlsConn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	return tlsConn.ConnectionState(), true
+}
+
+// Auth authenticates with a net/smtp mechanism. The data exchanged is redacted in the transcript
+func (c *smtpClient) Auth(a smtp.Auth) error {
+	encoding := base64.StdEncoding
+	mech, resp, err := a.Start(&smtp.ServerInfo{Name: c.serverName, TLS: c.tls, Auth: c.auth})
+	if err != nil {
+		c.Quit()
+		return err
+	}
+	line, display := "AUTH "+mech, "AUTH "+mech
+	if resp != nil {
+		line += " " + encoding.EncodeToString(resp)
+		display += " " + redacted
+	}
+	if err := c.send(line, display); err != nil {
+		return err
+	}
+	code, msg64, err := c.readResponse(0)
+	for err == nil {
+		var msg []byte
+		switch code {
+		case 334:
+			msg, err = encoding.DecodeString(msg64)
+		case 235:
+			msg = []byte(msg64)
+		default:
+			err = &textproto.Error{Code: code, Msg: msg64}
+		}
+		if err == nil {
+			resp, err = a.Next(msg, code == 334)
+		}
+		if err != nil {
+			// Cancel the exchange
+			c.cmd(501, "*")
+			c.Quit()
+			break
+		}
+		if resp == nil {
+			break
+		}
+		if err = c.send(encoding.EncodeToString(resp), redacted); err != nil {
+			break
+		}
+		code, msg64, err = c.readResponse(0)
+	}
+	return err
+}
+
+// Mail sends the MAIL FROM command
+func (c *smtpClient) Mail(from string) error {
+	_, _, err := c.cmd(250, "MAIL FROM:<%s>", from)
+	return err
+}
+
+// Rcpt sends the RCPT TO command
+func (c *smtpClient) Rcpt(to string) error {
+	_, _, err := c.cmd(25, "RCPT TO:<%s>", to)
+	return err
+}
+
+// dataWriter writes the message and reads the server response when it is closed
+type dataWriter struct {
+	c *smtpClient
+	io.WriteCloser
+	size int
+}
+
+func (d *dataWriter) Write(p []byte) (int, error) {
+	n, err := d.WriteCloser.Write(p)
+	d.size += n
+	return n, err
+}
+
+func (d *dataWriter) Close() error {
+	if err := d.WriteCloser.Close(); err != nil {
+		return err
+	}
+	transcript.Note("%d bytes of message data sent", d.size)
+	_, _, err := d.c.readResponse(250)
+	return err
+}
+
+// Data sends the DATA command and returns a writer for the message
+func (c *smtpClient) Data() (io.WriteCloser, error) {
+	if _, _, err := c.cmd(354, "DATA"); err != nil {
+		return nil, err
+	}
+	return &dataWriter{c: c, WriteCloser: c.Text.DotWriter()}, nil
+}
+
+// Quit sends the QUIT command and closes the connection
+func (c *smtpClient) Quit() error {
+	if _, _, err := c.cmd(221, "QUIT"); err != nil {
+		c.Close()
+		return err
+	}
+	return c.Close()
+}
+
+// Close closes the connection
+func (c *smtpClient) Close() error {
+	if c.stop != nil {
+		c.stop()
+	}
+	return c.Text.Close()
+}
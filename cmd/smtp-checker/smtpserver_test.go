@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitnami/healthcheck-tools/cmd/smtp-checker/apps"
+)
+
+// testMessage is a mail received by the test SMTP server
+type testMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// testSMTPServer is a minimal SMTP server used as a stand-in for the real ones in the tests
+type testSMTPServer struct {
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	extensions  []string
+	user        string
+	pass        string
+
+	mu         sync.Mutex
+	messages   []testMessage
+	mechanisms []string
+}
+
+// newTestCertificate creates a self-signed certificate for 127.0.0.1 and a pool to validate it
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "smtp.example.com"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// startTestSMTPServer starts a test SMTP server on a random local port. The server certificate
+// is trusted by the checks until the test finishes
+func startTestSMTPServer(t *testing.T, configure func(s *testSMTPServer)) *testSMTPServer {
+	cert, pool := newTestCertificate(t)
+	s := &testSMTPServer{
+		tlsConfig:  &tls.Config{Certificates: []tls.Certificate{cert}},
+		extensions: []string{"STARTTLS", "AUTH PLAIN"},
+		user:       "smtp-user",
+		pass:       "XXXXXXXX",
+	}
+	if configure != nil {
+		configure(s)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.implicitTLS {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+	s.listener = listener
+	previousRootCAs := rootCAs
+	rootCAs = pool
+	t.Cleanup(func() {
+		listener.Close()
+		rootCAs = previousRootCAs
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// settings returns the SMTP settings to connect to the test server
+func (s *testSMTPServer) settings() *apps.SMTPSettings {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return &apps.SMTPSettings{Host: "127.0.0.1", Port: addr.Port, User: s.user, Pass: s.pass}
+}
+
+func (s *testSMTPServer) received() []testMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]testMessage{}, s.messages...)
+}
+
+// usedMechanisms returns the mechanisms of the AUTH commands received
+func (s *testSMTPServer) usedMechanisms() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.mechanisms...)
+}
+
+// challenge sends a 334 challenge and returns the decoded response of the client
+func challenge(text *textproto.Conn, prompt string) (string, bool) {
+	text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+	line, err := text.ReadLine()
+	if err != nil {
+		return "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return "", false
+	}
+	return string(decoded), true
+}
+
+// initialResponse returns the decoded initial response of an AUTH command, or asks for it
+func initialResponse(text *textproto.Conn, args []string) (string, bool) {
+	if len(args) < 2 {
+		return challenge(text, "")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(args[1])
+	if err != nil {
+		return "", false
+	}
+	return string(decoded), true
+}
+
+// authenticate runs an AUTH exchange and reports whether the credentials are valid
+func (s *testSMTPServer) authenticate(text *textproto.Conn, args []string) bool {
+	if len(args) == 0 || !s.offers("AUTH") {
+		return false
+	}
+	mechanism := strings.ToUpper(args[0])
+	offered := false
+	for _, ext := range s.extensions {
+		fields := strings.Fields(ext)
+		if len(fields) > 0 && fields[0] == "AUTH" {
+			for _, m := range fields[1:] {
+				offered = offered || m == mechanism
+			}
+		}
+	}
+	if !offered {
+		return false
+	}
+	s.mu.Lock()
+	s.mechanisms = append(s.mechanisms, mechanism)
+	s.mu.Unlock()
+	switch mechanism {
+	case "PLAIN":
+		response, ok := initialResponse(text, args)
+		parts := strings.Split(response, "\x00")
+		return ok && len(parts) == 3 && parts[1] == s.user && parts[2] == s.pass
+	case "LOGIN":
+		user, ok := challenge(text, "Username:")
+		if !ok {
+			return false
+		}
+		pass, ok := challenge(text, "Password:")
+		return ok && user == s.user && pass == s.pass
+	case "CRAM-MD5":
+		const nonce = "<1896.697170952@smtp.example.com>"
+		response, ok := challenge(text, nonce)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(md5.New, []byte(s.pass))
+		mac.Write([]byte(nonce))
+		return response == s.user+" "+hex.EncodeToString(mac.Sum(nil))
+	case "XOAUTH2":
+		response, ok := initialResponse(text, args)
+		if ok && response == "user="+s.user+"\x01auth=Bearer "+s.pass+"\x01\x01" {
+			return true
+		}
+		// Like Gmail, send the error details as a challenge before failing
+		challenge(text, `{"status":"401","schemes":"bearer"}`)
+		return false
+	}
+	return false
+}
+
+func (s *testSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	_, isTLS := conn.(*tls.Conn)
+	text.PrintfLine("220 smtp.example.com ESMTP test server")
+	var message testMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "EHLO":
+			lines := []string{"smtp.example.com"}
+			for _, ext := range s.extensions {
+				if ext == "STARTTLS" && isTLS {
+					continue
+				}
+				lines = append(lines, ext)
+			}
+			for i, l := range lines {
+				separator := "-"
+				if i == len(lines)-1 {
+					separator = " "
+				}
+				text.PrintfLine("250%s%s", separator, l)
+			}
+		case "HELO", "NOOP", "RSET":
+			text.PrintfLine("250 OK")
+		case "STARTTLS":
+			if isTLS || !s.offers("STARTTLS") {
+				text.PrintfLine("502 5.5.1 STARTTLS not available")
+				continue
+			}
+			text.PrintfLine("220 2.0.0 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, isTLS = tlsConn, true
+			text = textproto.NewConn(conn)
+		case "AUTH":
+			if s.authenticate(text, strings.Fields(arg)) {
+				text.PrintfLine("235 2.7.0 Authentication successful")
+			} else {
+				text.PrintfLine("535 5.7.8 Authentication credentials invalid")
+			}
+		case "MAIL":
+			message = testMessage{from: pathArgument(arg, "FROM:")}
+			text.PrintfLine("250 2.1.0 OK")
+		case "RCPT":
+			message.to = append(message.to, pathArgument(arg, "TO:"))
+			text.PrintfLine("250 2.1.5 OK")
+		case "DATA":
+			text.PrintfLine("354 Go ahead")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			message.data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			text.PrintfLine("250 2.0.0 OK: queued")
+		case "QUIT":
+			text.PrintfLine("221 2.0.0 Bye")
+			return
+		default:
+			text.PrintfLine("502 5.5.2 Unknown command %s", command)
+		}
+	}
+}
+
+// pathArgument obtains the address of a MAIL FROM:<address> or RCPT TO:<address> command
+func pathArgument(arg, prefix string) string {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return ""
+	}
+	path, _, _ := strings.Cut(arg[len(prefix):], " ")
+	return strings.Trim(path, "<>")
+}
+
+// offers reports whether the server advertises an extension
+func (s *testSMTPServer) offers(extension string) bool {
+	for _, ext := range s.extensions {
+		if strings.HasPrefix(ext, extension) {
+			return true
+		}
+	}
+	return false
+}
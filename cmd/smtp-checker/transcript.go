@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transcript records the SMTP sessions of the checks. When nil, nothing is recorded
+var transcript *Transcript
+
+// Transcript writes the SMTP commands sent and the responses received, with timestamps
+type Transcript struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewTranscript returns a Transcript that writes to w
+func NewTranscript(w io.Writer) *Transcript {
+	return &Transcript{w: w}
+}
+
+func (t *Transcript) record(prefix, line string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "%s %s %s\n", time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00"), prefix, line)
+}
+
+// Sent records a line sent by the client
+func (t *Transcript) Sent(line string) {
+	t.record("C:", line)
+}
+
+// Received records a response of the server, one line per response line
+func (t *Transcript) Received(code int, msg string) {
+	lines := strings.Split(msg, "\n")
+	for i, l := range lines {
+		separator := "-"
+		if i == len(lines)-1 {
+			separator = " "
+		}
+		t.record("S:", fmt.Sprintf("%d%s%s", code, separator, l))
+	}
+}
+
+// Note records an event of the session that is not part of the SMTP protocol
+func (t *Transcript) Note(format string, args ...interface{}) {
+	t.record("*", fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestTranscript(t *testing.T) {
+	t.Run("Check the SMTP session is recorded with the credentials redacted", func(t *testing.T) {
+		server := startTestSMTPServer(t, func(s *testSMTPServer) {
+			s.extensions = []string{"STARTTLS", "AUTH PLAIN LOGIN"}
+		})
+		var out bytes.Buffer
+		transcript = NewTranscript(&out)
+		defer func() { transcript = nil }()
+		if err := RunSendMailChecks(context.Background(), server.settings(), "test@example.com"); err != nil {
+			t.Fatalf("error checking mail delivery via SMTP: %v", err)
+		}
+		for _, expected := range []string{
+			"S: 220 smtp.example.com ESMTP test server",
+			"C: EHLO localhost",
+			"S: 250-STARTTLS",
+			"C: STARTTLS",
+			"* TLS handshake completed: TLS 1.3",
+			"S: 250 AUTH PLAIN LOGIN",
+			"C: AUTH PLAIN [redacted]",
+			"S: 235 2.7.0 Authentication successful",
+			"C: MAIL FROM:<smtp-user>",
+			"S: 250 2.1.5 OK",
+			"bytes of message data sent",
+			"S: 250 2.0.0 OK: queued",
+			"C: QUIT",
+		} {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("transcript does not contain %q:\n%s", expected, out.String())
+			}
+		}
+		credentials := base64.StdEncoding.EncodeToString([]byte("\x00smtp-user\x00XXXXXXXX"))
+		if strings.Contains(out.String(), credentials) || strings.Contains(out.String(), "XXXXXXXX") {
+			t.Errorf("transcript contains the credentials:\n%s", out.String())
+		}
+	})
+	t.Run("Check the LOGIN exchange is redacted", func(t *testing.T) {
+		server := startTestSMTPServer(t, func(s *testSMTPServer) {
+			s.extensions = []string{"STARTTLS", "AUTH LOGIN"}
+		})
+		var out bytes.Buffer
+		transcript = NewTranscript(&out)
+		defer func() { transcript = nil }()
+		if err := RunAuthChecks(context.Background(), server.settings()); err != nil {
+			t.Fatalf("error checking SMTP authentication: %v", err)
+		}
+		if strings.Count(out.String(), "C: [redacted]") != 2 {
+			t.Errorf("expected the username and password to be redacted:\n%s", out.String())
+		}
+		if strings.Contains(out.String(), base64.StdEncoding.EncodeToString([]byte("XXXXXXXX"))) {
+			t.Errorf("transcript contains the password:\n%s", out.String())
+		}
+	})
+}
@@ -18,12 +18,16 @@ func main() {
 	var hostname string
 	var port int
 	var getVersion bool
+	var snapshotFile string
+	var diffFile string
 	flag.StringVar(&apacheRoot, "apache-root", "/opt/bitnami/apache2/", "Root of Apache installation")
 	flag.StringVar(&apacheConf, "apache-conf", "/opt/bitnami/apache2/conf/httpd.conf",
 		"Path to the root Apache configuration file")
 	flag.StringVar(&hostname, "hostname", "", "Web application hostname")
 	flag.IntVar(&port, "port", 443, "Web application port")
 	flag.BoolVar(&getVersion, "version", false, "Show current version")
+	flag.StringVar(&snapshotFile, "snapshot", "", "Save a JSON snapshot of the effective SSL configuration to this file")
+	flag.StringVar(&diffFile, "diff", "", "Compare the effective SSL configuration with a snapshot saved with -snapshot")
 	flag.Parse()
 	if getVersion {
 		fmt.Printf("smtp-checker %s\n", VERSION)
@@ -33,6 +37,16 @@ func main() {
 
 		os.Exit(0)
 	}
+	if snapshotFile != "" || diffFile != "" {
+		changes, err := RunSnapshotChecks(apacheConf, apacheRoot, snapshotFile, diffFile)
+		if err != nil {
+			log.Fatalf("Found errors when comparing the SSL configuration: %v", err)
+		}
+		if changes > 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	if hostname == "" {
 		log.Fatal("-hostname flag must be set")
 	}
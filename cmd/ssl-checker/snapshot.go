@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bitnami/healthcheck-tools/pkg/apache"
+)
+
+// CertificateInfo contains the identifying data of a certificate file
+type CertificateInfo struct {
+	Subject     string     `json:"subject,omitempty"`
+	Issuer      string     `json:"issuer,omitempty"`
+	NotAfter    *time.Time `json:"not_after,omitempty"`
+	Fingerprint string     `json:"fingerprint,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// SSLVirtualHost contains the effective SSL configuration of a virtual host
+type SSLVirtualHost struct {
+	Addresses       string          `json:"addresses"`
+	ServerName      string          `json:"server_name"`
+	CertificateFile string          `json:"certificate_file"`
+	KeyFile         string          `json:"key_file"`
+	ChainFile       string          `json:"chain_file,omitempty"`
+	Protocols       string          `json:"protocols"`
+	Ciphers         string          `json:"ciphers"`
+	Certificate     CertificateInfo `json:"certificate"`
+}
+
+// key identifies the virtual host across snapshots
+func (vh SSLVirtualHost) key() string {
+	return fmt.Sprintf("VirtualHost %s (%s)", vh.Addresses, vh.ServerName)
+}
+
+// FileHash contains the SHA-256 hash of a configuration file
+type FileHash struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// SSLSnapshot contains the effective SSL configuration of Apache at a given time
+type SSLSnapshot struct {
+	CreatedAt    time.Time        `json:"created_at"`
+	ApacheConf   string           `json:"apache_conf"`
+	Protocols    string           `json:"protocols"`
+	Ciphers      string           `json:"ciphers"`
+	VirtualHosts []SSLVirtualHost `json:"virtual_hosts"`
+	Files        []FileHash       `json:"files"`
+}
+
+// SnapshotChange is a difference between two snapshots
+type SnapshotChange struct {
+	Kind string
+	Item string
+	Old  string
+	New  string
+}
+
+func (c SnapshotChange) String() string {
+	switch c.Kind {
+	case "added":
+		return fmt.Sprintf("+ %s: %s", c.Item, c.New)
+	case "removed":
+		return fmt.Sprintf("- %s: %s", c.Item, c.Old)
+	default:
+		return fmt.Sprintf("~ %s: %q -> %q", c.Item, c.Old, c.New)
+	}
+}
+
+// hashFile returns the hex encoded SHA-256 hash of a file
+func hashFile(file string) (string, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// getCertificateInfo reads the first certificate of a PEM file
+func getCertificateInfo(certFile string) CertificateInfo {
+	encodedCert, err := os.ReadFile(certFile)
+	if err != nil {
+		return CertificateInfo{Error: err.Error()}
+	}
+	block, _ := pem.Decode(encodedCert)
+	if block == nil {
+		return CertificateInfo{Error: "no PEM data found"}
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return CertificateInfo{Error: err.Error()}
+	}
+	sum := sha256.Sum256(cert.Raw)
+	notAfter := cert.NotAfter.UTC()
+	return CertificateInfo{
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		NotAfter:    &notAfter,
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}
+}
+
+// directiveValue returns the whole value of the last directive with the given name, falling back to a default
+func directiveValue(directives []*apache.Directive, name, def string) string {
+	if d := apache.FindLast(directives, name); d != nil {
+		return strings.Join(d.Args, " ")
+	}
+	return def
+}
+
+// TakeSSLSnapshot obtains the effective SSL configuration from the Apache configuration files
+func TakeSSLSnapshot(confFile, apacheRoot string) (*SSLSnapshot, error) {
+	config, err := apache.LoadConfig(confFile, apacheRoot)
+	if err != nil {
+		return nil, err
+	}
+	directives := config.Effective()
+	res := &SSLSnapshot{
+		CreatedAt:    time.Now().UTC(),
+		ApacheConf:   confFile,
+		Protocols:    directiveValue(directives, "SSLProtocol", "(default)"),
+		Ciphers:      directiveValue(directives, "SSLCipherSuite", "(default)"),
+		VirtualHosts: []SSLVirtualHost{},
+		Files:        []FileHash{},
+	}
+	for _, vh := range apache.ResolveVirtualHosts(config).VirtualHosts {
+		if !vh.SSL {
+			continue
+		}
+		sslVH := SSLVirtualHost{
+			Addresses:       strings.Join(vh.Addresses, " "),
+			ServerName:      vh.ServerName,
+			CertificateFile: config.ResolvePath(directiveValue(vh.Directives, "SSLCertificateFile", directiveValue(directives, "SSLCertificateFile", ""))),
+			KeyFile:         config.ResolvePath(directiveValue(vh.Directives, "SSLCertificateKeyFile", directiveValue(directives, "SSLCertificateKeyFile", ""))),
+			ChainFile:       config.ResolvePath(directiveValue(vh.Directives, "SSLCertificateChainFile", directiveValue(directives, "SSLCertificateChainFile", ""))),
+			Protocols:       directiveValue(vh.Directives, "SSLProtocol", res.Protocols),
+			Ciphers:         directiveValue(vh.Directives, "SSLCipherSuite", res.Ciphers),
+		}
+		if sslVH.CertificateFile != "" {
+			sslVH.Certificate = getCertificateInfo(sslVH.CertificateFile)
+		}
+		res.VirtualHosts = append(res.VirtualHosts, sslVH)
+	}
+	for _, file := range config.Files {
+		hash, err := hashFile(file)
+		if err != nil {
+			return nil, err
+		}
+		res.Files = append(res.Files, FileHash{file, hash})
+	}
+	return res, nil
+}
+
+// SaveSSLSnapshot writes a snapshot as JSON
+func SaveSSLSnapshot(snapshot *SSLSnapshot, file string) error {
+	content, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(content, '\n'), 0644)
+}
+
+// LoadSSLSnapshot reads a snapshot previously saved with SaveSSLSnapshot
+func LoadSSLSnapshot(file string) (*SSLSnapshot, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	res := &SSLSnapshot{}
+	if err := json.Unmarshal(content, res); err != nil {
+		return nil, fmt.Errorf("error parsing snapshot %s: %v", file, err)
+	}
+	return res, nil
+}
+
+// compareValue appends a change if a value differs between snapshots
+func compareValue(changes []SnapshotChange, item, before, after string) []SnapshotChange {
+	if before != after {
+		changes = append(changes, SnapshotChange{"changed", item, before, after})
+	}
+	return changes
+}
+
+// DiffSSLSnapshots lists the items added, removed or changed from a previous snapshot to the current one
+func DiffSSLSnapshots(previous, current *SSLSnapshot) []SnapshotChange {
+	res := []SnapshotChange{}
+	res = compareValue(res, "SSLProtocol", previous.Protocols, current.Protocols)
+	res = compareValue(res, "SSLCipherSuite", previous.Ciphers, current.Ciphers)
+
+	oldVHosts := map[string]SSLVirtualHost{}
+	for _, vh := range previous.VirtualHosts {
+		oldVHosts[vh.key()] = vh
+	}
+	newVHosts := map[string]bool{}
+	for _, vh := range current.VirtualHosts {
+		newVHosts[vh.key()] = true
+		before, ok := oldVHosts[vh.key()]
+		if !ok {
+			res = append(res, SnapshotChange{"added", vh.key(), "", vh.CertificateFile})
+			continue
+		}
+		res = compareValue(res, vh.key()+" SSLCertificateFile", before.CertificateFile, vh.CertificateFile)
+		res = compareValue(res, vh.key()+" SSLCertificateKeyFile", before.KeyFile, vh.KeyFile)
+		res = compareValue(res, vh.key()+" SSLCertificateChainFile", before.ChainFile, vh.ChainFile)
+		res = compareValue(res, vh.key()+" SSLProtocol", before.Protocols, vh.Protocols)
+		res = compareValue(res, vh.key()+" SSLCipherSuite", before.Ciphers, vh.Ciphers)
+		res = compareValue(res, vh.key()+" certificate fingerprint", before.Certificate.Fingerprint, vh.Certificate.Fingerprint)
+		res = compareValue(res, vh.key()+" certificate error", before.Certificate.Error, vh.Certificate.Error)
+	}
+	for _, vh := range previous.VirtualHosts {
+		if !newVHosts[vh.key()] {
+			res = append(res, SnapshotChange{"removed", vh.key(), vh.CertificateFile, ""})
+		}
+	}
+
+	oldFiles := map[string]string{}
+	for _, f := range previous.Files {
+		oldFiles[f.Path] = f.SHA256
+	}
+	newFiles := map[string]bool{}
+	for _, f := range current.Files {
+		newFiles[f.Path] = true
+		before, ok := oldFiles[f.Path]
+		if !ok {
+			res = append(res, SnapshotChange{"added", "File " + f.Path, "", f.SHA256})
+			continue
+		}
+		res = compareValue(res, "File "+f.Path, before, f.SHA256)
+	}
+	for _, f := range previous.Files {
+		if !newFiles[f.Path] {
+			res = append(res, SnapshotChange{"removed", "File " + f.Path, f.SHA256, ""})
+		}
+	}
+	return res
+}
+
+// RunSnapshotChecks saves the current SSL configuration to a snapshot file and/or compares it with a previous one.
+// It returns the number of changes found since the previous snapshot
+func RunSnapshotChecks(confFile, apacheRoot, snapshotFile, diffFile string) (int, error) {
+	current, err := TakeSSLSnapshot(confFile, apacheRoot)
+	if err != nil {
+		return 0, err
+	}
+	changes := []SnapshotChange{}
+	if diffFile != "" {
+		previous, err := LoadSSLSnapshot(diffFile)
+		if err != nil {
+			return 0, err
+		}
+		fmt.Printf("Comparing with the snapshot taken at %s\n", previous.CreatedAt.Format(time.RFC3339))
+		changes = DiffSSLSnapshots(previous, current)
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+		if len(changes) > 0 {
+			fmt.Printf("Found %d changes in the SSL configuration\n", len(changes))
+		} else {
+			fmt.Println("No changes in the SSL configuration")
+		}
+	}
+	if snapshotFile != "" {
+		if err := SaveSSLSnapshot(current, snapshotFile); err != nil {
+			return 0, err
+		}
+		fmt.Printf("SSL configuration snapshot saved to %q\n", snapshotFile)
+	}
+	return len(changes), nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSSLSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	confFile := filepath.Join(dir, "httpd.conf")
+	sslConfFile := filepath.Join(dir, "httpd-ssl.conf")
+	writeFile := func(file, content string) {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(certFile, testCertificate)
+	writeFile(keyFile, testKey)
+	writeFile(confFile, `
+SSLProtocol all -SSLv3
+Include "httpd-ssl.conf"
+<VirtualHost *:80>
+    ServerName example.com
+</VirtualHost>
+`)
+	writeFile(sslConfFile, `
+<VirtualHost *:443>
+    ServerName example.com
+    SSLEngine on
+    SSLCertificateFile "server.crt"
+    SSLCertificateKeyFile "server.key"
+</VirtualHost>
+`)
+
+	previous, err := TakeSSLSnapshot(confFile, dir)
+	if err != nil {
+		t.Fatalf("Error taking SSL snapshot: %v", err)
+	}
+
+	t.Run("Check snapshot content", func(t *testing.T) {
+		if len(previous.VirtualHosts) != 1 {
+			t.Fatalf("Incorrect number of SSL virtual hosts detected, expected: 1, got: %d", len(previous.VirtualHosts))
+		}
+		vh := previous.VirtualHosts[0]
+		if vh.CertificateFile != certFile || vh.KeyFile != keyFile || vh.Protocols != "all -SSLv3" {
+			t.Errorf("Incorrect SSL virtual host detected, got: %+v", vh)
+		}
+		if vh.Certificate.Subject != "CN=example.com" || vh.Certificate.NotAfter == nil || len(vh.Certificate.Fingerprint) != 64 {
+			t.Errorf("Incorrect certificate detected, got: %+v", vh.Certificate)
+		}
+		if len(previous.Files) != 2 || previous.Files[1].Path != sslConfFile {
+			t.Errorf("Incorrect configuration files detected, got: %+v", previous.Files)
+		}
+	})
+
+	t.Run("Check saved snapshot", func(t *testing.T) {
+		snapshotFile := filepath.Join(dir, "snapshot.json")
+		if err := SaveSSLSnapshot(previous, snapshotFile); err != nil {
+			t.Fatalf("Error saving SSL snapshot: %v", err)
+		}
+		loaded, err := LoadSSLSnapshot(snapshotFile)
+		if err != nil {
+			t.Fatalf("Error loading SSL snapshot: %v", err)
+		}
+		if changes := DiffSSLSnapshots(previous, loaded); len(changes) != 0 {
+			t.Errorf("Unexpected changes detected in the saved snapshot: %v", changes)
+		}
+	})
+
+	t.Run("Check snapshot differences", func(t *testing.T) {
+		writeFile(sslConfFile, `
+SSLProtocol TLSv1.2
+<VirtualHost *:443>
+    ServerName example.com
+    SSLEngine on
+    SSLCertificateFile "server.crt"
+    SSLCertificateKeyFile "other.key"
+</VirtualHost>
+<VirtualHost *:8443>
+    ServerName example.com
+    SSLEngine on
+    SSLCertificateFile "server.crt"
+</VirtualHost>
+`)
+		current, err := TakeSSLSnapshot(confFile, dir)
+		if err != nil {
+			t.Fatalf("Error taking SSL snapshot: %v", err)
+		}
+		expected := []string{
+			`~ SSLProtocol: "all -SSLv3" -> "TLSv1.2"`,
+			`~ VirtualHost *:443 (example.com) SSLCertificateKeyFile: "` + keyFile + `" -> "` + filepath.Join(dir, "other.key") + `"`,
+			`~ VirtualHost *:443 (example.com) SSLProtocol: "all -SSLv3" -> "TLSv1.2"`,
+			`+ VirtualHost *:8443 (example.com): ` + certFile,
+			`~ File ` + sslConfFile + `: "` + previous.Files[1].SHA256 + `" -> "` + current.Files[1].SHA256 + `"`,
+		}
+		changes := DiffSSLSnapshots(previous, current)
+		if len(changes) != len(expected) {
+			t.Fatalf("Incorrect number of changes detected, expected: %d, got: %d (%v)", len(expected), len(changes), changes)
+		}
+		for i, c := range changes {
+			if c.String() != expected[i] {
+				t.Errorf("Incorrect change detected, expected: %s, got: %s", expected[i], c)
+			}
+		}
+	})
+
+	t.Run("Check snapshot checks report the changes", func(t *testing.T) {
+		snapshotFile := filepath.Join(dir, "previous.json")
+		if err := SaveSSLSnapshot(previous, snapshotFile); err != nil {
+			t.Fatalf("Error saving SSL snapshot: %v", err)
+		}
+		changes, err := RunSnapshotChecks(confFile, dir, "", snapshotFile)
+		if err != nil {
+			t.Fatalf("Error running snapshot checks: %v", err)
+		}
+		if changes != 5 {
+			t.Errorf("Incorrect number of changes reported, expected: 5, got: %d", changes)
+		}
+	})
+
+	t.Run("Check certificate errors omit the expiration date", func(t *testing.T) {
+		content, err := json.Marshal(getCertificateInfo(filepath.Join(dir, "missing.crt")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(content), "not_after") {
+			t.Errorf("Unexpected expiration date in certificate without data: %s", content)
+		}
+	})
+}
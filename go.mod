@@ -1,20 +1,20 @@
 module github.com/bitnami/healthcheck-tools
 
-go 1.19
+go 1.23.0
 
 require (
-	github.com/andybalholm/crlf v0.0.0-20171020200849-670099aa064f
 	github.com/beevik/ntp v0.3.0
 	github.com/ghodss/yaml v1.0.0
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/juju/errors v1.0.0
 	github.com/mkmik/multierror v0.3.0
 	github.com/yvasiyarov/php_session_decoder v0.0.0-20180803065642-a065a3b0b7d1
+	golang.org/x/crypto v0.36.0
+	golang.org/x/net v0.38.0
 )
 
 require (
 	github.com/stretchr/testify v1.8.4 // indirect
-	golang.org/x/net v0.38.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
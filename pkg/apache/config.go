@@ -0,0 +1,395 @@
+package apache
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Directive is a single Apache configuration directive. Sections (e.g. <VirtualHost>)
+// and Include directives hold the directives they enclose as children
+type Directive struct {
+	Name     string
+	Args     []string
+	File     string
+	Line     int
+	Section  bool
+	Children []*Directive
+}
+
+// Value returns the first argument of the directive, or an empty string if it has none
+func (d *Directive) Value() string {
+	if len(d.Args) == 0 {
+		return ""
+	}
+	return d.Args[0]
+}
+
+// Is reports whether the directive has the given name (Apache directives are case-insensitive)
+func (d *Directive) Is(name string) bool {
+	return strings.EqualFold(d.Name, name)
+}
+
+// Location returns the source location of the directive as <file>:<line>
+func (d *Directive) Location() string {
+	return fmt.Sprintf("%s:%d", d.File, d.Line)
+}
+
+func (d *Directive) String() string {
+	if d.Section {
+		return fmt.Sprintf("<%s %s>", d.Name, strings.Join(d.Args, " "))
+	}
+	return strings.TrimSpace(d.Name + " " + strings.Join(d.Args, " "))
+}
+
+// Find returns the directives with the given name in a list, without descending into sections
+func Find(directives []*Directive, name string) []*Directive {
+	res := []*Directive{}
+	for _, d := range directives {
+		if d.Is(name) {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// FindLast returns the last directive with the given name in a list, which is the one Apache
+// applies when a directive is repeated, or nil if there is none
+func FindLast(directives []*Directive, name string) *Directive {
+	found := Find(directives, name)
+	if len(found) == 0 {
+		return nil
+	}
+	return found[len(found)-1]
+}
+
+// Config is a parsed Apache configuration, with every included file expanded in place
+type Config struct {
+	File       string
+	ServerRoot string
+	Files      []string
+	Defines    map[string]string
+	Directives []*Directive
+}
+
+// ResolvePath makes a path from the configuration absolute, relative to the ServerRoot
+func (c *Config) ResolvePath(p string) string {
+	if p == "" || path.IsAbs(p) {
+		return p
+	}
+	return path.Join(c.ServerRoot, p)
+}
+
+// splitArgs splits a directive line into words, honouring single and double quotes
+func splitArgs(line string) ([]string, error) {
+	res := []string{}
+	var current strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != 0:
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\'') && !inWord:
+			quote = r
+			inWord = true
+		case quote == 0 && (r == ' ' || r == '\t'):
+			if inWord {
+				res = append(res, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quoted string")
+	}
+	if inWord {
+		res = append(res, current.String())
+	}
+	return res, nil
+}
+
+// ParseConfig parses the content of a single Apache configuration file into a tree of directives.
+// Included files are not followed, use LoadConfig for that
+func ParseConfig(text, file string) ([]*Directive, error) {
+	root := &Directive{Section: true}
+	stack := []*Directive{root}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		startLine := lineNumber
+		line := scanner.Text()
+		for strings.HasSuffix(line, "\\") && scanner.Scan() {
+			lineNumber++
+			line = strings.TrimSuffix(line, "\\") + scanner.Text()
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parent := stack[len(stack)-1]
+		switch {
+		case strings.HasPrefix(line, "</"):
+			name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "</"), ">"))
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("%s:%d: unexpected closing section </%s>", file, startLine, name)
+			}
+			if !parent.Is(name) {
+				return nil, fmt.Errorf("%s:%d: </%s> closes section <%s> opened at line %d", file, startLine, name, parent.Name, parent.Line)
+			}
+			stack = stack[:len(stack)-1]
+		case strings.HasPrefix(line, "<"):
+			if !strings.HasSuffix(line, ">") {
+				return nil, fmt.Errorf("%s:%d: section %q is not closed with '>'", file, startLine, line)
+			}
+			words, err := splitArgs(strings.TrimSuffix(strings.TrimPrefix(line, "<"), ">"))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", file, startLine, err)
+			}
+			if len(words) == 0 {
+				return nil, fmt.Errorf("%s:%d: empty section name", file, startLine)
+			}
+			section := &Directive{Name: words[0], Args: words[1:], File: file, Line: startLine, Section: true}
+			parent.Children = append(parent.Children, section)
+			stack = append(stack, section)
+		default:
+			words, err := splitArgs(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", file, startLine, err)
+			}
+			parent.Children = append(parent.Children, &Directive{Name: words[0], Args: words[1:], File: file, Line: startLine})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if len(stack) > 1 {
+		open := stack[len(stack)-1]
+		return nil, fmt.Errorf("%s:%d: section <%s> is never closed", file, open.Line, open.Name)
+	}
+	return root.Children, nil
+}
+
+var variableRe = regexp.MustCompile(`\$\{[^}]+\}`)
+
+// loader keeps the state needed while following Include directives
+type loader struct {
+	config  *Config
+	loading map[string]bool
+}
+
+// expand replaces ${VAR} references with the values set by Define or, failing that, the environment
+func (l *loader) expand(s string) string {
+	return variableRe.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		if v, ok := l.config.Defines[name]; ok {
+			return v
+		}
+		if v, ok := os.LookupEnv(name); ok {
+			return v
+		}
+		return ref
+	})
+}
+
+func (l *loader) load(file string) ([]*Directive, error) {
+	if l.loading[file] {
+		return nil, fmt.Errorf("%s: recursive Include", file)
+	}
+	text, err := OpenApacheConfigurationFile(file)
+	if err != nil {
+		return nil, err
+	}
+	directives, err := ParseConfig(text, file)
+	if err != nil {
+		return nil, err
+	}
+	l.config.Files = append(l.config.Files, file)
+	l.loading[file] = true
+	defer delete(l.loading, file)
+	return directives, l.process(directives)
+}
+
+// process applies the directives that affect the loading itself (ServerRoot, Define, Include) in order
+func (l *loader) process(directives []*Directive) error {
+	for _, d := range directives {
+		for i, arg := range d.Args {
+			d.Args[i] = l.expand(arg)
+		}
+		switch {
+		case d.Is("ServerRoot"):
+			l.config.ServerRoot = d.Value()
+		case d.Is("Define") && len(d.Args) > 0:
+			l.config.Defines[d.Args[0]] = strings.Join(d.Args[1:], " ")
+		case d.Is("UnDefine"):
+			delete(l.config.Defines, d.Value())
+		case d.Is("Include") || d.Is("IncludeOptional"):
+			if err := l.include(d); err != nil {
+				return err
+			}
+		case d.Section:
+			if err := l.process(d.Children); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *loader) include(d *Directive) error {
+	pattern := l.config.ResolvePath(d.Value())
+	optional := d.Is("IncludeOptional")
+	files := []string{pattern}
+	if strings.ContainsAny(pattern, "*?[") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid Include pattern %q: %v", d.Location(), pattern, err)
+		}
+		sort.Strings(matches)
+		files = matches
+		optional = true
+	}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			if optional {
+				continue
+			}
+			return fmt.Errorf("%s: %v", d.Location(), err)
+		}
+		if info.IsDir() {
+			continue
+		}
+		children, err := l.load(file)
+		if err != nil {
+			return err
+		}
+		d.Children = append(d.Children, children...)
+	}
+	return nil
+}
+
+// LoadConfig parses an Apache configuration file and all the files it includes
+func LoadConfig(confPath, apacheRoot string) (*Config, error) {
+	l := &loader{
+		config: &Config{
+			File:       confPath,
+			ServerRoot: apacheRoot,
+			Defines:    map[string]string{},
+		},
+		loading: map[string]bool{},
+	}
+	directives, err := l.load(confPath)
+	if err != nil {
+		return nil, err
+	}
+	l.config.Directives = directives
+	return l.config, nil
+}
+
+// staticModules are compiled into every Apache build and never appear in LoadModule
+var staticModules = []string{"core_module", "core.c", "http_module", "http_core.c", "so_module", "mod_so.c"}
+
+// evaluator keeps the state needed to evaluate conditional sections in configuration order
+type evaluator struct {
+	config  *Config
+	modules map[string]bool
+}
+
+func (e *evaluator) loadModule(d *Directive) {
+	if len(d.Args) < 2 {
+		return
+	}
+	e.modules[d.Args[0]] = true
+	e.modules[strings.TrimSuffix(path.Base(d.Args[1]), ".so")+".c"] = true
+}
+
+// condition evaluates the argument of a conditional section; the second return value
+// is false when the section is not a configuration-time conditional
+func (e *evaluator) condition(d *Directive) (bool, bool) {
+	arg := d.Value()
+	negate := strings.HasPrefix(arg, "!")
+	arg = strings.TrimPrefix(arg, "!")
+	var res bool
+	switch {
+	case d.Is("IfModule"):
+		res = e.modules[arg]
+	case d.Is("IfDefine"):
+		_, res = e.config.Defines[arg]
+	case d.Is("IfFile"):
+		_, err := os.Stat(e.config.ResolvePath(arg))
+		res = err == nil
+	case d.Is("IfVersion"), d.Is("IfDirective"), d.Is("IfSection"):
+		return true, true
+	default:
+		return false, false
+	}
+	return res != negate, true
+}
+
+func (e *evaluator) evaluate(directives []*Directive) []*Directive {
+	res := []*Directive{}
+	for _, d := range directives {
+		if d.Is("LoadModule") {
+			e.loadModule(d)
+		}
+		if d.Is("Include") || d.Is("IncludeOptional") {
+			res = append(res, e.evaluate(d.Children)...)
+			continue
+		}
+		if !d.Section {
+			res = append(res, d)
+			continue
+		}
+		if active, ok := e.condition(d); ok {
+			if active {
+				res = append(res, e.evaluate(d.Children)...)
+			}
+			continue
+		}
+		section := *d
+		section.Children = e.evaluate(d.Children)
+		res = append(res, &section)
+	}
+	return res
+}
+
+func (c *Config) evaluate() ([]*Directive, map[string]bool) {
+	e := &evaluator{config: c, modules: map[string]bool{}}
+	for _, m := range staticModules {
+		e.modules[m] = true
+	}
+	return e.evaluate(c.Directives), e.modules
+}
+
+// Effective returns the directives Apache would apply: included files are spliced in place
+// and conditional sections (<IfModule>, <IfDefine>...) are either flattened into their parent or
+// dropped, depending on the loaded modules and defined parameters
+func (c *Config) Effective() []*Directive {
+	directives, _ := c.evaluate()
+	return directives
+}
+
+// LoadedModules returns the modules loaded by the configuration, both by identifier (ssl_module)
+// and by source file name (mod_ssl.c), as accepted by <IfModule>
+func (c *Config) LoadedModules() map[string]bool {
+	_, modules := c.evaluate()
+	return modules
+}
@@ -0,0 +1,154 @@
+package apache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	file := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestParseConfig(t *testing.T) {
+	t.Run("Check parsed directives and sections", func(t *testing.T) {
+		directives, err := ParseConfig(`
+# Comment
+Listen 80
+<VirtualHost *:80>
+    ServerName "example.com"
+    ServerAlias www.example.com \
+        example.net
+    <Directory "/opt/bitnami/apache/htdocs">
+        Require all granted
+    </Directory>
+</VirtualHost>
+`, "httpd.conf")
+		if err != nil {
+			t.Fatalf("Error parsing configuration: %v", err)
+		}
+		if len(directives) != 2 {
+			t.Fatalf("Incorrect number of directives detected, expected: 2, got: %d", len(directives))
+		}
+		if directives[0].String() != "Listen 80" || directives[0].Line != 3 {
+			t.Errorf("Incorrect directive detected, expected: Listen 80 at line 3, got: %s at line %d", directives[0], directives[0].Line)
+		}
+		vhost := directives[1]
+		if !vhost.Section || !vhost.Is("virtualhost") || vhost.Value() != "*:80" {
+			t.Errorf("Incorrect section detected, expected: <VirtualHost *:80>, got: %s", vhost)
+		}
+		if name := FindLast(vhost.Children, "ServerName"); name == nil || name.Value() != "example.com" {
+			t.Errorf("Incorrect ServerName detected, expected: example.com, got: %v", name)
+		}
+		alias := FindLast(vhost.Children, "ServerAlias")
+		if alias == nil || len(alias.Args) != 2 || alias.Args[1] != "example.net" || alias.Line != 6 {
+			t.Errorf("Incorrect ServerAlias detected, expected: www.example.com example.net at line 6, got: %v", alias)
+		}
+		directory := FindLast(vhost.Children, "Directory")
+		if directory == nil || directory.Value() != "/opt/bitnami/apache/htdocs" || len(directory.Children) != 1 {
+			t.Errorf("Incorrect Directory section detected, got: %v", directory)
+		}
+	})
+
+	t.Run("Check errors on unbalanced sections", func(t *testing.T) {
+		for _, in := range []string{
+			"<VirtualHost *:80>\nServerName example.com\n",
+			"</VirtualHost>\n",
+			"<VirtualHost *:80>\n</Directory>\n",
+			"ServerName \"example.com\n",
+		} {
+			if _, err := ParseConfig(in, "httpd.conf"); err == nil {
+				t.Errorf("Expected error parsing configuration: %s", in)
+			}
+		}
+	})
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	conf := writeTestFile(t, dir, "conf/httpd.conf", `
+ServerRoot "`+dir+`"
+Define VHOSTS_DIR conf/vhosts
+LoadModule ssl_module modules/mod_ssl.so
+Include "conf/extra/httpd-ssl.conf"
+IncludeOptional "${VHOSTS_DIR}/*.conf"
+IncludeOptional "conf/missing/*.conf"
+<IfModule mod_ssl.c>
+    Listen 443
+</IfModule>
+<IfModule !ssl_module>
+    Listen 8443
+</IfModule>
+<IfModule rewrite_module>
+    RewriteEngine on
+</IfModule>
+<IfDefine VHOSTS_DIR>
+    ServerName example.com
+</IfDefine>
+`)
+	writeTestFile(t, dir, "conf/extra/httpd-ssl.conf", "SSLProtocol all -SSLv3\n")
+	writeTestFile(t, dir, "conf/vhosts/b.conf", "<VirtualHost *:80>\nServerName b.example.com\n</VirtualHost>\n")
+	writeTestFile(t, dir, "conf/vhosts/a.conf", "<VirtualHost *:80>\nServerName a.example.com\n</VirtualHost>\n")
+
+	config, err := LoadConfig(conf, "/opt/bitnami/apache")
+	if err != nil {
+		t.Fatalf("Error loading configuration: %v", err)
+	}
+
+	t.Run("Check loaded files", func(t *testing.T) {
+		expected := []string{conf,
+			filepath.Join(dir, "conf/extra/httpd-ssl.conf"),
+			filepath.Join(dir, "conf/vhosts/a.conf"),
+			filepath.Join(dir, "conf/vhosts/b.conf")}
+		if !testEq(expected, config.Files) {
+			t.Errorf("Incorrect loaded files detected, expected: %q, got: %q", expected, config.Files)
+		}
+		if config.ServerRoot != dir {
+			t.Errorf("Incorrect ServerRoot detected, expected: %s, got: %s", dir, config.ServerRoot)
+		}
+	})
+
+	t.Run("Check effective directives", func(t *testing.T) {
+		effective := config.Effective()
+		if d := FindLast(effective, "SSLProtocol"); d == nil || d.File != filepath.Join(dir, "conf/extra/httpd-ssl.conf") {
+			t.Errorf("Included directive not found in effective configuration: %v", d)
+		}
+		listen := Find(effective, "Listen")
+		if len(listen) != 1 || listen[0].Value() != "443" {
+			t.Errorf("Incorrect Listen directives detected, expected: [Listen 443], got: %v", listen)
+		}
+		if d := FindLast(effective, "RewriteEngine"); d != nil {
+			t.Errorf("Directive from a module not loaded detected: %v", d)
+		}
+		if d := FindLast(effective, "ServerName"); d == nil || d.Value() != "example.com" {
+			t.Errorf("Incorrect ServerName detected, expected: example.com, got: %v", d)
+		}
+		vhosts := Find(effective, "VirtualHost")
+		if len(vhosts) != 2 || FindLast(vhosts[0].Children, "ServerName").Value() != "a.example.com" {
+			t.Errorf("Incorrect virtual hosts detected, expected: a.example.com and b.example.com, got: %v", vhosts)
+		}
+	})
+
+	t.Run("Check loaded modules", func(t *testing.T) {
+		modules := config.LoadedModules()
+		for _, m := range []string{"ssl_module", "mod_ssl.c", "core_module"} {
+			if !modules[m] {
+				t.Errorf("Module %s not detected as loaded", m)
+			}
+		}
+	})
+
+	t.Run("Check missing Include", func(t *testing.T) {
+		missing := writeTestFile(t, dir, "conf/missing.conf", "Include conf/does-not-exist.conf\n")
+		if _, err := LoadConfig(missing, dir); err == nil {
+			t.Errorf("Expected error loading configuration with a missing Include")
+		}
+	})
+}
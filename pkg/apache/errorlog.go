@@ -0,0 +1,183 @@
+package apache
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrorLogEntry is a single entry of the Apache error log
+type ErrorLogEntry struct {
+	Time    time.Time
+	Module  string
+	Level   string
+	Message string
+}
+
+// errorLogTimeLayouts are the timestamp layouts of the error log in Apache 2.4 and 2.2
+var errorLogTimeLayouts = []string{"Mon Jan 02 15:04:05.000000 2006", "Mon Jan 02 15:04:05 2006"}
+
+var errorLogLineRe = regexp.MustCompile(`^\[([^\]]+)\] \[([^\]]+)\] (.*)$`)
+
+// ParseErrorLogLine parses a line of the error log in the default ErrorLogFormat. It returns
+// false when the line does not start with a timestamp, e.g. for messages written to stderr by modules
+func ParseErrorLogLine(line string) (ErrorLogEntry, bool) {
+	matches := errorLogLineRe.FindStringSubmatch(line)
+	if matches == nil {
+		return ErrorLogEntry{}, false
+	}
+	res := ErrorLogEntry{Message: matches[3]}
+	var err error
+	for _, layout := range errorLogTimeLayouts {
+		if res.Time, err = time.ParseInLocation(layout, matches[1], time.Local); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return ErrorLogEntry{}, false
+	}
+	// Apache 2.4 logs [module:level], Apache 2.2 only [level]
+	if module, level, ok := strings.Cut(matches[2], ":"); ok {
+		res.Module, res.Level = module, level
+	} else {
+		res.Level = matches[2]
+	}
+	return res, true
+}
+
+var strftimeRe = regexp.MustCompile(`%[a-zA-Z]`)
+
+// errorLogPath obtains the file path of an ErrorLog value. Piped logs are supported when they use
+// rotatelogs, and a glob pattern is returned for the time-based names it generates
+func (c *Config) errorLogPath(value string) string {
+	if strings.HasPrefix(value, "syslog") {
+		return ""
+	}
+	if strings.HasPrefix(value, "|") {
+		words, err := splitArgs(strings.TrimPrefix(strings.TrimPrefix(value, "|"), "$"))
+		if err != nil || len(words) < 2 || !strings.Contains(words[0], "rotatelogs") {
+			return ""
+		}
+		for _, w := range words[1:] {
+			if !strings.HasPrefix(w, "-") {
+				return strftimeRe.ReplaceAllString(c.ResolvePath(w), "*")
+			}
+		}
+		return ""
+	}
+	return c.ResolvePath(value)
+}
+
+// ErrorLogs returns the paths of the error logs set by ErrorLog directives in the main server
+// and the virtual hosts. Logs sent to syslog or to programs other than rotatelogs are skipped
+func ErrorLogs(c *Config) []string {
+	res := []string{}
+	seen := map[string]bool{}
+	directives := c.Effective()
+	logs := Find(directives, "ErrorLog")
+	for _, section := range Find(directives, "VirtualHost") {
+		logs = append(logs, Find(section.Children, "ErrorLog")...)
+	}
+	for _, d := range logs {
+		p := c.errorLogPath(d.Value())
+		if p != "" && !seen[p] {
+			seen[p] = true
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// rotationSuffixRe matches the suffixes added to the rotated logs by logrotate (.1, .1.gz, -20230101...)
+// and by the rotation scripts using dates (.2023-01-01...)
+var rotationSuffixRe = regexp.MustCompile(`[.-](\d+|\d{4}-\d{2}-\d{2})(\.gz)?$`)
+
+// isLogFile reports whether a file name is the one of a log, given as a glob pattern, or of one of its
+// rotated files. Other logs with the same prefix, e.g. error_log_ssl for error_log, are not matched
+func isLogFile(pattern string, name string) bool {
+	if ok, _ := filepath.Match(pattern, name); ok {
+		return true
+	}
+	loc := rotationSuffixRe.FindStringIndex(name)
+	if loc == nil {
+		return false
+	}
+	ok, _ := filepath.Match(pattern, name[:loc[0]])
+	return ok
+}
+
+// RotatedLogFiles returns the files of a log, including the ones created by logrotate or rotatelogs
+// (error_log.1, error_log-20230101.gz...) sorted from oldest to newest
+func RotatedLogFiles(logPath string) ([]string, error) {
+	dirs, err := filepath.Glob(filepath.Dir(logPath))
+	if err != nil {
+		return nil, err
+	}
+	pattern := filepath.Base(logPath)
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	matches := []string{}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if isLogFile(pattern, e.Name()) {
+				matches = append(matches, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	type logFile struct {
+		path    string
+		modTime time.Time
+	}
+	files := []logFile{}
+	for _, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, logFile{m, info.ModTime()})
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	res := []string{}
+	for _, f := range files {
+		res = append(res, f.path)
+	}
+	return res, nil
+}
+
+// gzipReadCloser closes both the gzip reader and the underlying file
+type gzipReadCloser struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// OpenLogFile opens a log file, decompressing it if it is gzipped
+func OpenLogFile(logPath string) (io.ReadCloser, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(logPath, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return gzipReadCloser{gz, f}, nil
+}
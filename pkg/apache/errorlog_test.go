@@ -0,0 +1,126 @@
+package apache
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseErrorLogLine(t *testing.T) {
+	testData := []struct {
+		in      string
+		ok      bool
+		time    time.Time
+		module  string
+		level   string
+		message string
+	}{
+		{"[Tue Mar 14 10:20:30.123456 2023] [ssl:emerg] [pid 1234] AH02572: Failed to configure at least one certificate and key for localhost:443",
+			true, time.Date(2023, 3, 14, 10, 20, 30, 123456000, time.Local), "ssl", "emerg",
+			"[pid 1234] AH02572: Failed to configure at least one certificate and key for localhost:443"},
+		{"[Tue Mar 14 10:20:30 2023] [error] [client 127.0.0.1] File does not exist",
+			true, time.Date(2023, 3, 14, 10, 20, 30, 0, time.Local), "", "error", "[client 127.0.0.1] File does not exist"},
+		{"AH00558: httpd: Could not reliably determine the server's fully qualified domain name", false, time.Time{}, "", "", ""},
+		{"[not a date] [core:notice] message", false, time.Time{}, "", "", ""},
+	}
+	t.Run("Check parsed error log lines", func(t *testing.T) {
+		for _, tt := range testData {
+			entry, ok := ParseErrorLogLine(tt.in)
+			if ok != tt.ok {
+				t.Errorf("Incorrect parse result for %q, expected: %t, got: %t", tt.in, tt.ok, ok)
+				continue
+			}
+			if !entry.Time.Equal(tt.time) || entry.Module != tt.module || entry.Level != tt.level || entry.Message != tt.message {
+				t.Errorf("Incorrect entry detected for %q, got: %+v", tt.in, entry)
+			}
+		}
+	})
+}
+
+func TestErrorLogs(t *testing.T) {
+	t.Run("Check detected error logs", func(t *testing.T) {
+		directives, err := ParseConfig(`
+ErrorLog "logs/error_log"
+<VirtualHost *:80>
+    ErrorLog "|bin/rotatelogs -l /var/log/apache/example-error.%Y-%m-%d 86400"
+</VirtualHost>
+<VirtualHost *:443>
+    ErrorLog logs/error_log
+</VirtualHost>
+<VirtualHost *:8080>
+    ErrorLog syslog:local7
+</VirtualHost>
+`, "httpd.conf")
+		if err != nil {
+			t.Fatalf("Error parsing configuration: %v", err)
+		}
+		logs := ErrorLogs(&Config{ServerRoot: "/opt/bitnami/apache", Directives: directives})
+		expected := []string{"/opt/bitnami/apache/logs/error_log", "/var/log/apache/example-error.*-*-*"}
+		if !testEq(expected, logs) {
+			t.Errorf("Incorrect error logs detected, expected: %q, got: %q", expected, logs)
+		}
+	})
+}
+
+func TestRotatedLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	logPath := writeTestFile(t, dir, "error_log", "current\n")
+	rotated := writeTestFile(t, dir, "error_log.1", "rotated\n")
+	dated := writeTestFile(t, dir, "error_log-20230101", "dated\n")
+	// Other logs sharing the prefix of the file name are not rotated files
+	writeTestFile(t, dir, "error_log_ssl", "ssl\n")
+	writeTestFile(t, dir, "error_log_ssl.1", "ssl rotated\n")
+	compressed := filepath.Join(dir, "error_log.2.gz")
+	f, err := os.Create(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte("compressed\n"))
+	gz.Close()
+	f.Close()
+	now := time.Now()
+	os.Chtimes(compressed, now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+	os.Chtimes(dated, now.Add(-3*time.Hour), now.Add(-3*time.Hour))
+	os.Chtimes(rotated, now.Add(-time.Hour), now.Add(-time.Hour))
+
+	t.Run("Check rotated log files", func(t *testing.T) {
+		files, err := RotatedLogFiles(logPath)
+		if err != nil {
+			t.Fatalf("Error listing rotated log files: %v", err)
+		}
+		expected := []string{dated, compressed, rotated, logPath}
+		if !testEq(expected, files) {
+			t.Errorf("Incorrect rotated log files detected, expected: %q, got: %q", expected, files)
+		}
+	})
+
+	t.Run("Check rotatelogs log files", func(t *testing.T) {
+		first := writeTestFile(t, dir, "example-error.2023-01-01", "first\n")
+		second := writeTestFile(t, dir, "example-error.2023-01-02", "second\n")
+		os.Chtimes(first, now.Add(-time.Hour), now.Add(-time.Hour))
+		files, err := RotatedLogFiles(filepath.Join(dir, "example-error.*-*-*"))
+		if err != nil {
+			t.Fatalf("Error listing rotated log files: %v", err)
+		}
+		expected := []string{first, second}
+		if !testEq(expected, files) {
+			t.Errorf("Incorrect rotated log files detected, expected: %q, got: %q", expected, files)
+		}
+	})
+
+	t.Run("Check gzipped log file", func(t *testing.T) {
+		r, err := OpenLogFile(compressed)
+		if err != nil {
+			t.Fatalf("Error opening gzipped log file: %v", err)
+		}
+		defer r.Close()
+		content, err := io.ReadAll(r)
+		if err != nil || string(content) != "compressed\n" {
+			t.Errorf("Incorrect gzipped log content, expected: %q, got: %q (%v)", "compressed\n", content, err)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package apache
+
+import (
+	"sort"
+	"strings"
+)
+
+// directiveModules maps (lowercase) directive names to the identifier of the module providing them
+var directiveModules = map[string]string{
+	"alias":                   "alias_module",
+	"aliasmatch":              "alias_module",
+	"redirect":                "alias_module",
+	"redirectmatch":           "alias_module",
+	"redirectpermanent":       "alias_module",
+	"redirecttemp":            "alias_module",
+	"scriptalias":             "alias_module",
+	"scriptaliasmatch":        "alias_module",
+	"authname":                "authn_core_module",
+	"authtype":                "authn_core_module",
+	"authbasicprovider":       "auth_basic_module",
+	"authuserfile":            "authn_file_module",
+	"authgroupfile":           "authz_groupfile_module",
+	"require":                 "authz_core_module",
+	"requireall":              "authz_core_module",
+	"requireany":              "authz_core_module",
+	"requirenone":             "authz_core_module",
+	"order":                   "access_compat_module",
+	"allow":                   "access_compat_module",
+	"deny":                    "access_compat_module",
+	"satisfy":                 "access_compat_module",
+	"addtype":                 "mime_module",
+	"addhandler":              "mime_module",
+	"addencoding":             "mime_module",
+	"addcharset":              "mime_module",
+	"addoutputfilter":         "mime_module",
+	"typesconfig":             "mime_module",
+	"addoutputfilterbytype":   "filter_module",
+	"directoryindex":          "dir_module",
+	"directoryslash":          "dir_module",
+	"fallbackresource":        "dir_module",
+	"customlog":               "log_config_module",
+	"logformat":               "log_config_module",
+	"transferlog":             "log_config_module",
+	"header":                  "headers_module",
+	"requestheader":           "headers_module",
+	"setenvif":                "setenvif_module",
+	"setenvifnocase":          "setenvif_module",
+	"browsermatch":            "setenvif_module",
+	"setenv":                  "env_module",
+	"unsetenv":                "env_module",
+	"passenv":                 "env_module",
+	"balancermember":          "proxy_module",
+	"proxyhtmlenable":         "proxy_html_module",
+	"proxyhtmlurlmap":         "proxy_html_module",
+	"user":                    "unixd_module",
+	"group":                   "unixd_module",
+	"extendedstatus":          "status_module",
+	"userdir":                 "userdir_module",
+	"davlockdb":               "dav_fs_module",
+	"deflatecompressionlevel": "deflate_module",
+}
+
+// directivePrefixes maps directive name prefixes to the identifier of the module providing them
+var directivePrefixes = map[string]string{
+	"ssl":       "ssl_module",
+	"rewrite":   "rewrite_module",
+	"proxy":     "proxy_module",
+	"expires":   "expires_module",
+	"deflate":   "deflate_module",
+	"brotli":    "brotli_module",
+	"php_":      "php_module",
+	"pagespeed": "pagespeed_module",
+	"sec":       "security2_module",
+	"session":   "session_module",
+}
+
+// moduleAliases lists the identifiers a module has had across versions
+var moduleAliases = map[string][]string{
+	"php_module": {"php_module", "php7_module", "php5_module"},
+}
+
+// DirectiveModule returns the identifier of the module that provides a directive (e.g. ssl_module for
+// SSLEngine), or an empty string for core directives and directives it does not know about
+func DirectiveModule(name string) string {
+	name = strings.ToLower(name)
+	if module, ok := directiveModules[name]; ok {
+		return module
+	}
+	prefixes := []string{}
+	for prefix := range directivePrefixes {
+		prefixes = append(prefixes, prefix)
+	}
+	// Try the longest prefixes first
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return directivePrefixes[prefix]
+		}
+	}
+	return ""
+}
+
+// ModuleLoaded reports whether a module identifier, as returned by DirectiveModule, is in a set of
+// loaded modules. An empty identifier is always considered loaded
+func ModuleLoaded(module string, modules map[string]bool) bool {
+	if module == "" {
+		return true
+	}
+	aliases, ok := moduleAliases[module]
+	if !ok {
+		aliases = []string{module}
+	}
+	for _, m := range aliases {
+		if modules[m] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package apache
+
+import (
+	"testing"
+)
+
+func TestDirectiveModule(t *testing.T) {
+	testData := []struct {
+		in  string
+		out string
+	}{
+		{"SSLEngine", "ssl_module"},
+		{"SSLProxyEngine", "ssl_module"},
+		{"RewriteRule", "rewrite_module"},
+		{"ProxyPass", "proxy_module"},
+		{"ProxyHTMLEnable", "proxy_html_module"},
+		{"header", "headers_module"},
+		{"php_value", "php_module"},
+		{"SecRuleEngine", "security2_module"},
+		{"SecRule", "security2_module"},
+		{"SessionCookieName", "session_module"},
+		{"DocumentRoot", ""},
+		{"ServerName", ""},
+	}
+	t.Run("Check detected modules", func(t *testing.T) {
+		for _, tt := range testData {
+			if module := DirectiveModule(tt.in); module != tt.out {
+				t.Errorf("Incorrect module detected for %s, expected: %q, got: %q", tt.in, tt.out, module)
+			}
+		}
+	})
+}
+
+func TestModuleLoaded(t *testing.T) {
+	modules := map[string]bool{"ssl_module": true, "php7_module": true}
+	testData := []struct {
+		in  string
+		out bool
+	}{
+		{"", true},
+		{"ssl_module", true},
+		{"php_module", true},
+		{"rewrite_module", false},
+	}
+	t.Run("Check loaded modules", func(t *testing.T) {
+		for _, tt := range testData {
+			if loaded := ModuleLoaded(tt.in, modules); loaded != tt.out {
+				t.Errorf("Incorrect loaded status for %q, expected: %t, got: %t", tt.in, tt.out, loaded)
+			}
+		}
+	})
+}
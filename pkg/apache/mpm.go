@@ -0,0 +1,86 @@
+package apache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MPMSettings contains the Multi-Processing Module settings that limit how many requests Apache can serve
+type MPMSettings struct {
+	Module            string `json:"module"`
+	StartServers      int    `json:"start_servers"`
+	ServerLimit       int    `json:"server_limit"`
+	ThreadsPerChild   int    `json:"threads_per_child"`
+	MaxRequestWorkers int    `json:"max_request_workers"`
+}
+
+// mpmDefaults contains the compiled-in defaults of each MPM
+var mpmDefaults = map[string]MPMSettings{
+	"event":   {Module: "event", StartServers: 3, ServerLimit: 16, ThreadsPerChild: 25},
+	"worker":  {Module: "worker", StartServers: 3, ServerLimit: 16, ThreadsPerChild: 25},
+	"prefork": {Module: "prefork", StartServers: 5, ServerLimit: 256, ThreadsPerChild: 1},
+}
+
+// intDirective returns the integer value of the last directive with the given name, or def if it is not set
+func intDirective(directives []*Directive, name string, def int) (int, error) {
+	d := FindLast(directives, name)
+	if d == nil {
+		return def, nil
+	}
+	value, err := strconv.Atoi(d.Value())
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid %s value %q", d.Location(), d.Name, d.Value())
+	}
+	return value, nil
+}
+
+// ReadMPMSettings obtains the settings of the MPM loaded by the configuration, applying the defaults
+// of the MPM for the directives that are not set
+func ReadMPMSettings(c *Config) (MPMSettings, error) {
+	directives, modules := c.evaluate()
+	module := ""
+	for name := range mpmDefaults {
+		if modules["mpm_"+name+"_module"] {
+			module = name
+		}
+	}
+	if module == "" {
+		return MPMSettings{}, fmt.Errorf("no MPM module loaded in the Apache configuration")
+	}
+	res := mpmDefaults[module]
+	var err error
+	if res.StartServers, err = intDirective(directives, "StartServers", res.StartServers); err != nil {
+		return res, err
+	}
+	if res.ServerLimit, err = intDirective(directives, "ServerLimit", res.ServerLimit); err != nil {
+		return res, err
+	}
+	if module != "prefork" {
+		if res.ThreadsPerChild, err = intDirective(directives, "ThreadsPerChild", res.ThreadsPerChild); err != nil {
+			return res, err
+		}
+	}
+	// MaxClients is the name MaxRequestWorkers had before Apache 2.3.13
+	maxWorkers := res.ServerLimit * res.ThreadsPerChild
+	if maxWorkers, err = intDirective(directives, "MaxClients", maxWorkers); err != nil {
+		return res, err
+	}
+	if res.MaxRequestWorkers, err = intDirective(directives, "MaxRequestWorkers", maxWorkers); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// String returns a description of the MPM settings
+func (s MPMSettings) String() string {
+	parts := []string{
+		fmt.Sprintf("MPM: %s", s.Module),
+		fmt.Sprintf("MaxRequestWorkers: %d", s.MaxRequestWorkers),
+		fmt.Sprintf("ServerLimit: %d", s.ServerLimit),
+	}
+	if s.Module != "prefork" {
+		parts = append(parts, fmt.Sprintf("ThreadsPerChild: %d", s.ThreadsPerChild))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,62 @@
+package apache
+
+import (
+	"testing"
+)
+
+func TestReadMPMSettings(t *testing.T) {
+	testData := []struct {
+		in  string
+		out MPMSettings
+	}{
+		{`
+LoadModule mpm_event_module modules/mod_mpm_event.so
+`, MPMSettings{Module: "event", StartServers: 3, ServerLimit: 16, ThreadsPerChild: 25, MaxRequestWorkers: 400}},
+		{`
+LoadModule mpm_prefork_module modules/mod_mpm_prefork.so
+<IfModule mpm_prefork_module>
+    StartServers 10
+    MaxRequestWorkers 150
+</IfModule>
+<IfModule mpm_event_module>
+    MaxRequestWorkers 1000
+</IfModule>
+`, MPMSettings{Module: "prefork", StartServers: 10, ServerLimit: 256, ThreadsPerChild: 1, MaxRequestWorkers: 150}},
+		{`
+LoadModule mpm_worker_module modules/mod_mpm_worker.so
+ServerLimit 4
+ThreadsPerChild 50
+MaxClients 100
+`, MPMSettings{Module: "worker", StartServers: 3, ServerLimit: 4, ThreadsPerChild: 50, MaxRequestWorkers: 100}},
+	}
+	t.Run("Check MPM settings", func(t *testing.T) {
+		for _, tt := range testData {
+			directives, err := ParseConfig(tt.in, "httpd.conf")
+			if err != nil {
+				t.Fatalf("Error parsing configuration: %v", err)
+			}
+			settings, err := ReadMPMSettings(&Config{Directives: directives})
+			if err != nil {
+				t.Errorf("Error reading MPM settings: %v", err)
+			}
+			if settings != tt.out {
+				t.Errorf("Incorrect MPM settings detected for configuration: %s\n\n expected: %+v, got: %+v", tt.in, tt.out, settings)
+			}
+		}
+	})
+
+	t.Run("Check errors in MPM settings", func(t *testing.T) {
+		for _, in := range []string{
+			"ServerLimit 4\n",
+			"LoadModule mpm_event_module modules/mod_mpm_event.so\nMaxRequestWorkers many\n",
+		} {
+			directives, err := ParseConfig(in, "httpd.conf")
+			if err != nil {
+				t.Fatalf("Error parsing configuration: %v", err)
+			}
+			if _, err := ReadMPMSettings(&Config{Directives: directives}); err == nil {
+				t.Errorf("Expected error reading MPM settings for configuration: %s", in)
+			}
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package apache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scoreboardStates maps the mod_status scoreboard characters to their meaning
+var scoreboardStates = map[rune]string{
+	'_': "Waiting for Connection",
+	'S': "Starting up",
+	'R': "Reading Request",
+	'W': "Sending Reply",
+	'K': "Keepalive",
+	'D': "DNS Lookup",
+	'C': "Closing connection",
+	'L': "Logging",
+	'G': "Gracefully finishing",
+	'I': "Idle cleanup of worker",
+	'.': "Open slot with no current process",
+}
+
+// ServerStatus contains the machine readable output of mod_status (server-status?auto)
+type ServerStatus struct {
+	ServerVersion string         `json:"server_version"`
+	ServerMPM     string         `json:"server_mpm"`
+	Uptime        time.Duration  `json:"uptime"`
+	TotalAccesses int            `json:"total_accesses"`
+	BusyWorkers   int            `json:"busy_workers"`
+	IdleWorkers   int            `json:"idle_workers"`
+	Scoreboard    string         `json:"scoreboard"`
+	States        map[string]int `json:"states"`
+}
+
+// Slots returns the number of worker slots in the scoreboard, which is the maximum number of
+// workers the running server can have
+func (s ServerStatus) Slots() int {
+	return len(s.Scoreboard)
+}
+
+// ParseServerStatus parses the output of server-status?auto
+func ParseServerStatus(r io.Reader) (*ServerStatus, error) {
+	res := &ServerStatus{States: map[string]int{}}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	found := false
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		var err error
+		switch key {
+		case "ServerVersion":
+			res.ServerVersion = value
+		case "ServerMPM":
+			res.ServerMPM = value
+		case "Uptime":
+			var seconds int
+			seconds, err = strconv.Atoi(value)
+			res.Uptime = time.Duration(seconds) * time.Second
+		case "Total Accesses":
+			res.TotalAccesses, err = strconv.Atoi(value)
+		case "BusyWorkers":
+			res.BusyWorkers, err = strconv.Atoi(value)
+			found = true
+		case "IdleWorkers":
+			res.IdleWorkers, err = strconv.Atoi(value)
+		case "Scoreboard":
+			res.Scoreboard = value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q", key, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("BusyWorkers not found, is it the output of server-status?auto?")
+	}
+	for _, r := range res.Scoreboard {
+		state, ok := scoreboardStates[r]
+		if !ok {
+			state = fmt.Sprintf("Unknown (%c)", r)
+		}
+		res.States[state]++
+	}
+	return res, nil
+}
+
+// FetchServerStatus queries the server-status page of mod_status in machine readable format
+func FetchServerStatus(url string, timeout time.Duration) (*ServerStatus, error) {
+	if !strings.Contains(url, "?") {
+		url += "?auto"
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %q from %s, check mod_status is enabled and allows requests from this host", resp.Status, url)
+	}
+	return ParseServerStatus(resp.Body)
+}
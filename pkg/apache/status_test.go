@@ -0,0 +1,76 @@
+package apache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testServerStatus = `localhost
+ServerVersion: Apache/2.4.57 (Unix) OpenSSL/3.0.2
+ServerMPM: event
+Server Built: Apr  6 2023 10:00:00
+Uptime: 3600
+Total Accesses: 1520
+Total kBytes: 20480
+BusyWorkers: 3
+IdleWorkers: 2
+Scoreboard: _WW_K......
+`
+
+func TestParseServerStatus(t *testing.T) {
+	t.Run("Check parsed server status", func(t *testing.T) {
+		status, err := ParseServerStatus(strings.NewReader(testServerStatus))
+		if err != nil {
+			t.Fatalf("Error parsing server status: %v", err)
+		}
+		if status.ServerMPM != "event" || status.Uptime != time.Hour || status.TotalAccesses != 1520 {
+			t.Errorf("Incorrect server status detected, got: %+v", status)
+		}
+		if status.BusyWorkers != 3 || status.IdleWorkers != 2 || status.Slots() != 11 {
+			t.Errorf("Incorrect workers detected, expected: 3 busy, 2 idle, 11 slots, got: %d busy, %d idle, %d slots",
+				status.BusyWorkers, status.IdleWorkers, status.Slots())
+		}
+		if status.States["Sending Reply"] != 2 || status.States["Open slot with no current process"] != 6 {
+			t.Errorf("Incorrect scoreboard states detected, got: %v", status.States)
+		}
+	})
+
+	t.Run("Check errors parsing server status", func(t *testing.T) {
+		for _, in := range []string{"<html>Forbidden</html>", "BusyWorkers: many\n"} {
+			if _, err := ParseServerStatus(strings.NewReader(in)); err == nil {
+				t.Errorf("Expected error parsing server status: %s", in)
+			}
+		}
+	})
+}
+
+func TestFetchServerStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/server-status" || r.URL.RawQuery != "auto" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, testServerStatus)
+	}))
+	defer server.Close()
+
+	t.Run("Check fetched server status", func(t *testing.T) {
+		status, err := FetchServerStatus(server.URL+"/server-status", time.Second)
+		if err != nil {
+			t.Fatalf("Error fetching server status: %v", err)
+		}
+		if status.BusyWorkers != 3 {
+			t.Errorf("Incorrect busy workers detected, expected: 3, got: %d", status.BusyWorkers)
+		}
+	})
+
+	t.Run("Check error status", func(t *testing.T) {
+		if _, err := FetchServerStatus(server.URL+"/other-status", time.Second); err == nil {
+			t.Errorf("Expected error fetching a forbidden status page")
+		}
+	})
+}
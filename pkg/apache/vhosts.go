@@ -0,0 +1,152 @@
+package apache
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// VirtualHost contains the settings of a <VirtualHost> section, including the ones
+// it inherits from the main server configuration
+type VirtualHost struct {
+	Addresses     []string     `json:"addresses"`
+	ServerName    string       `json:"server_name"`
+	ServerAliases []string     `json:"server_aliases"`
+	DocumentRoot  string       `json:"document_root"`
+	SSL           bool         `json:"ssl"`
+	File          string       `json:"file"`
+	Line          int          `json:"line"`
+	Directives    []*Directive `json:"-"`
+}
+
+// Location returns the source location of the virtual host as <file>:<line>
+func (vh *VirtualHost) Location() string {
+	return fmt.Sprintf("%s:%d", vh.File, vh.Line)
+}
+
+// AddressMapping contains the virtual hosts that answer requests on an address:port, in the
+// order Apache tries them. The first one is the default server for that address
+type AddressMapping struct {
+	Address         string         `json:"address"`
+	Port            string         `json:"port"`
+	NameVirtualHost bool           `json:"name_virtual_host"`
+	Default         *VirtualHost   `json:"default"`
+	VirtualHosts    []*VirtualHost `json:"virtual_hosts"`
+}
+
+// MainServer contains the settings of the main server, used for requests not handled by any virtual host
+type MainServer struct {
+	ServerName   string `json:"server_name"`
+	DocumentRoot string `json:"document_root"`
+	SSL          bool   `json:"ssl"`
+}
+
+// VirtualHostMap is the equivalent of the output of `apachectl -S`
+type VirtualHostMap struct {
+	ServerRoot   string           `json:"server_root"`
+	MainServer   MainServer       `json:"main_server"`
+	Listen       []string         `json:"listen"`
+	Addresses    []AddressMapping `json:"addresses"`
+	VirtualHosts []*VirtualHost   `json:"virtual_hosts"`
+}
+
+// SplitAddress splits an Apache address (e.g. *:443, [::1]:80, example.com) into host and port.
+// The port is "*" when it is not set, as Apache then matches any port
+func SplitAddress(address string) (string, string) {
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		return host, port
+	}
+	return strings.Trim(address, "[]"), "*"
+}
+
+// normalizeAddress returns the address key Apache uses to group name-based virtual hosts
+func normalizeAddress(address string) string {
+	host, port := SplitAddress(address)
+	if host == "_default_" {
+		host = "*"
+	}
+	return net.JoinHostPort(strings.ToLower(host), port)
+}
+
+// hostName strips the scheme and port from a ServerName value
+func hostName(serverName string) string {
+	if i := strings.Index(serverName, "://"); i >= 0 {
+		serverName = serverName[i+3:]
+	}
+	if host, _, err := net.SplitHostPort(serverName); err == nil {
+		return host
+	}
+	return serverName
+}
+
+// sslEnabled reports whether the last SSLEngine directive in a list turns SSL on
+func sslEnabled(directives []*Directive, inherited bool) bool {
+	d := FindLast(directives, "SSLEngine")
+	if d == nil {
+		return inherited
+	}
+	return strings.EqualFold(d.Value(), "on")
+}
+
+// ResolveVirtualHosts computes which virtual hosts Apache serves on each address:port from a configuration
+func ResolveVirtualHosts(c *Config) *VirtualHostMap {
+	directives := c.Effective()
+	res := &VirtualHostMap{
+		ServerRoot:   c.ServerRoot,
+		Listen:       []string{},
+		Addresses:    []AddressMapping{},
+		VirtualHosts: []*VirtualHost{},
+	}
+	if d := FindLast(directives, "ServerName"); d != nil {
+		res.MainServer.ServerName = hostName(d.Value())
+	}
+	if d := FindLast(directives, "DocumentRoot"); d != nil {
+		res.MainServer.DocumentRoot = c.ResolvePath(d.Value())
+	}
+	res.MainServer.SSL = sslEnabled(directives, false)
+	for _, d := range Find(directives, "Listen") {
+		res.Listen = append(res.Listen, d.Value())
+	}
+
+	mappings := map[string]*AddressMapping{}
+	order := []string{}
+	for _, section := range Find(directives, "VirtualHost") {
+		vh := &VirtualHost{
+			Addresses:     section.Args,
+			ServerName:    res.MainServer.ServerName,
+			ServerAliases: []string{},
+			DocumentRoot:  res.MainServer.DocumentRoot,
+			SSL:           sslEnabled(section.Children, res.MainServer.SSL),
+			File:          section.File,
+			Line:          section.Line,
+			Directives:    section.Children,
+		}
+		if d := FindLast(section.Children, "ServerName"); d != nil {
+			vh.ServerName = hostName(d.Value())
+		}
+		for _, d := range Find(section.Children, "ServerAlias") {
+			vh.ServerAliases = append(vh.ServerAliases, d.Args...)
+		}
+		if d := FindLast(section.Children, "DocumentRoot"); d != nil {
+			vh.DocumentRoot = c.ResolvePath(d.Value())
+		}
+		res.VirtualHosts = append(res.VirtualHosts, vh)
+
+		for _, address := range section.Args {
+			key := normalizeAddress(address)
+			mapping, ok := mappings[key]
+			if !ok {
+				_, port := SplitAddress(key)
+				mapping = &AddressMapping{Address: key, Port: port, Default: vh}
+				mappings[key] = mapping
+				order = append(order, key)
+			}
+			mapping.VirtualHosts = append(mapping.VirtualHosts, vh)
+			mapping.NameVirtualHost = len(mapping.VirtualHosts) > 1
+		}
+	}
+	for _, key := range order {
+		res.Addresses = append(res.Addresses, *mappings[key])
+	}
+	return res
+}
@@ -0,0 +1,98 @@
+package apache
+
+import (
+	"testing"
+)
+
+func TestSplitAddress(t *testing.T) {
+	testData := []struct {
+		in   string
+		host string
+		port string
+	}{
+		{"*:443", "*", "443"},
+		{"_default_:80", "_default_", "80"},
+		{"[::1]:8080", "::1", "8080"},
+		{"example.com", "example.com", "*"},
+		{"[::1]", "::1", "*"},
+	}
+	t.Run("Check split addresses", func(t *testing.T) {
+		for _, tt := range testData {
+			host, port := SplitAddress(tt.in)
+			if host != tt.host || port != tt.port {
+				t.Errorf("Incorrect address split for %q, expected: %s %s, got: %s %s", tt.in, tt.host, tt.port, host, port)
+			}
+		}
+	})
+}
+
+func TestResolveVirtualHosts(t *testing.T) {
+	dir := t.TempDir()
+	conf := writeTestFile(t, dir, "conf/httpd.conf", `
+ServerName localhost:80
+DocumentRoot "htdocs"
+Listen 80
+Listen 443
+LoadModule ssl_module modules/mod_ssl.so
+<VirtualHost *:80>
+    ServerName https://example.com:80
+    ServerAlias www.example.com example.net
+    DocumentRoot "/opt/bitnami/wordpress"
+</VirtualHost>
+<VirtualHost _default_:80>
+    ServerName other.com
+</VirtualHost>
+<IfModule ssl_module>
+<VirtualHost *:443 [::]:443>
+    ServerName example.com
+    SSLEngine on
+    DocumentRoot "/opt/bitnami/wordpress"
+</VirtualHost>
+</IfModule>
+`)
+	config, err := LoadConfig(conf, dir)
+	if err != nil {
+		t.Fatalf("Error loading configuration: %v", err)
+	}
+	vhosts := ResolveVirtualHosts(config)
+
+	t.Run("Check main server", func(t *testing.T) {
+		if vhosts.MainServer.ServerName != "localhost" {
+			t.Errorf("Incorrect main ServerName detected, expected: localhost, got: %s", vhosts.MainServer.ServerName)
+		}
+		if vhosts.MainServer.DocumentRoot != dir+"/htdocs" {
+			t.Errorf("Incorrect main DocumentRoot detected, expected: %s/htdocs, got: %s", dir, vhosts.MainServer.DocumentRoot)
+		}
+		if !testEq([]string{"80", "443"}, vhosts.Listen) {
+			t.Errorf("Incorrect Listen detected, expected: [80 443], got: %q", vhosts.Listen)
+		}
+	})
+
+	t.Run("Check address mappings", func(t *testing.T) {
+		if len(vhosts.Addresses) != 3 {
+			t.Fatalf("Incorrect number of addresses detected, expected: 3, got: %d", len(vhosts.Addresses))
+		}
+		http := vhosts.Addresses[0]
+		if http.Address != "*:80" || !http.NameVirtualHost || len(http.VirtualHosts) != 2 {
+			t.Errorf("Incorrect mapping for *:80 detected, got: %+v", http)
+		}
+		if http.Default.ServerName != "example.com" {
+			t.Errorf("Incorrect default server for *:80 detected, expected: example.com, got: %s", http.Default.ServerName)
+		}
+		if !testEq([]string{"www.example.com", "example.net"}, http.Default.ServerAliases) {
+			t.Errorf("Incorrect aliases detected, expected: [www.example.com example.net], got: %q", http.Default.ServerAliases)
+		}
+		if http.VirtualHosts[1].DocumentRoot != dir+"/htdocs" || http.VirtualHosts[1].SSL {
+			t.Errorf("Incorrect inherited settings detected for other.com, got: %+v", http.VirtualHosts[1])
+		}
+		for i, address := range []string{"*:443", "[::]:443"} {
+			mapping := vhosts.Addresses[i+1]
+			if mapping.Address != address || mapping.Port != "443" || mapping.NameVirtualHost {
+				t.Errorf("Incorrect mapping for %s detected, got: %+v", address, mapping)
+			}
+			if !mapping.Default.SSL || mapping.Default.Line != 16 {
+				t.Errorf("Incorrect SSL virtual host detected for %s, got: %+v", address, mapping.Default)
+			}
+		}
+	})
+}
@@ -4,6 +4,10 @@ package mysql
 import (
 	"database/sql"
 	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
 
 	// mysql implementation of go's database/sql/driver interface.
 	_ "github.com/go-sql-driver/mysql"
@@ -14,9 +18,11 @@ import (
 type Database struct {
 	Host string
 	Port int
-	Name string
-	User string
-	Pass string
+	// Socket is the Unix socket of the server, used instead of Host and Port when set
+	Socket string
+	Name   string
+	User   string
+	Pass   string
 }
 
 // Query is a structure that contains the query database
@@ -25,25 +31,112 @@ type Query struct {
 	Column string
 	Key    string
 	Value  string
+	// Filters are other columns the row must have the given values in
+	Filters map[string]string
+}
+
+// sql returns the statement of the query and its arguments
+func (q Query) sql() (string, []interface{}) {
+	conditions := []string{fmt.Sprintf("%q=?", q.Key)}
+	args := []interface{}{q.Value}
+	columns := make([]string, 0, len(q.Filters))
+	for column := range q.Filters {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		conditions = append(conditions, fmt.Sprintf("%q=?", column))
+		args = append(args, q.Filters[column])
+	}
+	return fmt.Sprintf("SELECT %q FROM %q WHERE %s", q.Column, q.Table, strings.Join(conditions, " AND ")), args
+}
+
+// address returns the network address of the server in the DSN format
+func (d Database) address() string {
+	if d.Socket != "" {
+		return fmt.Sprintf("unix(%s)", d.Socket)
+	}
+	return fmt.Sprintf("tcp(%s)", net.JoinHostPort(d.Host, strconv.Itoa(d.Port)))
+}
+
+// RowsQuery is a structure that contains a query of
+// several columns of all the rows of a table
+type RowsQuery struct {
+	Table   string
+	Columns []string
+}
+
+// open connects to the database using ANSI quotes for the identifiers
+func (d Database) open() (*sql.DB, error) {
+	dsn := fmt.Sprintf("%s:%s@%s/%s", d.User, d.Pass, d.address(), d.Name)
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("SET sql_mode='ANSI_QUOTES'"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
 // MySQLQuery returns the result of a MySQL query
 func (d Database) MySQLQuery(q Query) (result string, err error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", d.User, d.Pass, d.Host, d.Port, d.Name)
-	db, err := sql.Open("mysql", dsn)
+	db, err := d.open()
 	if err != nil {
 		return "", err
 	}
 	defer db.Close()
-	if _, err := db.Exec("SET sql_mode='ANSI_QUOTES'"); err != nil {
+	query, args := q.sql()
+	rows, err := db.Query(query, args...)
+	if err != nil {
 		return "", err
 	}
-	query := fmt.Sprintf("SELECT %q FROM %q WHERE %q=?", q.Column, q.Table, q.Key)
-	rows, err := db.Query(query, q.Value)
-	rows.Next()
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		return "", sql.ErrNoRows
+	}
 	err = rows.Scan(&result)
 	if err != nil {
 		return "", err
 	}
 	return result, nil
 }
+
+// MySQLQueryRows returns the values of the columns of all the rows of a table
+func (d Database) MySQLQueryRows(q RowsQuery) ([][]string, error) {
+	db, err := d.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	columns := make([]string, len(q.Columns))
+	for i, column := range q.Columns {
+		columns[i] = fmt.Sprintf("%q", column)
+	}
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %q", strings.Join(columns, ", "), q.Table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res [][]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(q.Columns))
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(values))
+		for i, value := range values {
+			row[i] = value.String
+		}
+		res = append(res, row)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,39 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuerySQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    Query
+		expected string
+		args     []interface{}
+	}{
+		{
+			"query by key",
+			Query{Table: "wp_options", Column: "option_value", Key: "option_name", Value: "wp_mail_smtp"},
+			`SELECT "option_value" FROM "wp_options" WHERE "option_name"=?`,
+			[]interface{}{"wp_mail_smtp"},
+		},
+		{
+			"query with filters",
+			Query{Table: "config", Column: "data", Key: "name", Value: "smtp.settings", Filters: map[string]string{"collection": "", "a": "b"}},
+			`SELECT "data" FROM "config" WHERE "name"=? AND "a"=? AND "collection"=?`,
+			[]interface{}{"smtp.settings", "b", ""},
+		},
+	}
+	for _, test := range tests {
+		t.Run("Check "+test.name, func(t *testing.T) {
+			statement, args := test.query.sql()
+			if statement != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, statement)
+			}
+			if !reflect.DeepEqual(args, test.args) {
+				t.Errorf("expected arguments %v, got %v", test.args, args)
+			}
+		})
+	}
+}